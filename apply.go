@@ -0,0 +1,193 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"fmt"
+
+	"github.com/google/btree"
+	"github.com/google/godata/group"
+	"github.com/google/godata/row"
+)
+
+// groupOf returns the Group in the group.Column of a row of a grouped Frame.
+func groupOf(data row.Data) (group.Group, error) {
+	col, ok := data[group.Column]
+	if !ok {
+		return nil, fmt.Errorf("row %v has no column %q", data, group.Column)
+	}
+	g, ok := col.(group.Group)
+	if !ok {
+		return nil, fmt.Errorf("column %q containing %v is not a Group", group.Column, col)
+	}
+	return g, nil
+}
+
+// Apply calls the action for the Group of each row of a Frame returned by
+// GroupBy, in index order, and returns a new Frame containing the rows of the
+// Frames returned by the action. The returned Frame has the indexer of the
+// first Frame returned, and allows duplicates, so that rows of different
+// groups with the same index are all kept; nil Frames are skipped. If no Frame
+// is returned, then the returned Frame is empty and has the indexer of the
+// grouped Frame. Stops at the first error returned by the action or by
+// indexing a row, which is returned.
+func (f *Frame) Apply(action func(group.Group) (*Frame, error)) (*Frame, error) {
+	var (
+		nf        *Frame
+		returnErr error
+	)
+	f.bt.Ascend(func(item btree.Item) bool {
+		g, err := groupOf(f.out(item.(row.Row).Data))
+		if err != nil {
+			returnErr = fmt.Errorf("Apply: %v", err)
+			return false
+		}
+		result, err := action(g)
+		if err != nil || result == nil {
+			returnErr = err
+			return err == nil
+		}
+		if nf == nil {
+			nf = NewFrame(result.indexer, AllowDuplicates(), Degree(f.degree))
+		}
+		result.bt.Ascend(func(item btree.Item) bool {
+			if _, returnErr = nf.Put(result.out(item.(row.Row).Data)); returnErr != nil {
+				returnErr = fmt.Errorf("Apply: %v", returnErr)
+			}
+			return returnErr == nil
+		})
+		return returnErr == nil
+	})
+	if returnErr != nil {
+		return nil, returnErr
+	}
+	if nf == nil {
+		nf = NewFrame(f.indexer, AllowDuplicates(), Degree(f.degree))
+	}
+	return nf, nil
+}
+
+// Transform returns a new Frame with the same indexer and options, in which the
+// given column of each row is set to a value computed over the group of the
+// row, as grouped by the given indexer. The action is called with the Group of
+// each index, whose rows are in index order, and returns a value for each of
+// them, in the same order. For example, the action may return the z-score of a
+// value within its group, or repeat the total of the group for every row. A
+// nil value removes the column. Returns the first error returned by the action
+// or by indexing a row, or an error if the action returns the wrong number of
+// values. Rows are indexed again once the column is set, so the column may be
+// indexed, as with WithColumn, and secondary indexes are not copied to the
+// returned Frame.
+func (f *Frame) Transform(indexer row.Indexer, column string, action func(group.Group) ([]interface{}, error)) (*Frame, error) {
+	var (
+		rows      []row.Data
+		groups    = btree.New(DefaultDegree)
+		returnErr error
+	)
+	// The rows are copies that are shared with the groups, so that setting the
+	// column of a group's rows sets it in the rows put in the new Frame.
+	f.bt.Ascend(func(item btree.Item) bool {
+		data := f.out(item.(row.Row).Data).Copy()
+		if returnErr = addToGroup(groups, indexer, data); returnErr != nil {
+			return false
+		}
+		rows = append(rows, data)
+		return true
+	})
+	if returnErr != nil {
+		return nil, fmt.Errorf("Transform: %v", returnErr)
+	}
+	groups.Ascend(func(item btree.Item) bool {
+		g := item.(row.Row).Data[group.Column].(group.Group)
+		var vals []interface{}
+		vals, returnErr = action(g)
+		if returnErr != nil {
+			return false
+		}
+		if len(vals) != len(g) {
+			returnErr = fmt.Errorf("Transform: %d values for a group of %d rows", len(vals), len(g))
+			return false
+		}
+		for i, data := range g {
+			if vals[i] == nil {
+				delete(data, column)
+			} else {
+				data[column] = vals[i]
+			}
+		}
+		return true
+	})
+	if returnErr != nil {
+		return nil, returnErr
+	}
+	nf := f.Empty()
+	for _, data := range rows {
+		if _, err := nf.Put(data); err != nil {
+			return nil, fmt.Errorf("Transform: %v", err)
+		}
+	}
+	return nf, nil
+}
+
+// Having returns a new Frame with the same indexer and options, containing the
+// rows of a Frame returned by GroupBy whose Group satisfies the predicate, such
+// as groups with more than a number of rows, or whose Sum exceeds a total. Stops
+// at the first error returned by the predicate, which is returned. Rows are
+// shared with the existing Frame. To filter groups by aggregates computed
+// once, add them as columns with WithColumn and an Aggregate's Action, and use
+// Filter.
+func (f *Frame) Having(predicate func(group.Group) (bool, error)) (*Frame, error) {
+	return f.Filter(func(data row.Data) (bool, error) {
+		g, err := groupOf(data)
+		if err != nil {
+			return false, fmt.Errorf("Having: %v", err)
+		}
+		return predicate(g)
+	})
+}
+
+// Flatten returns a new Frame indexed by the given indexer, containing the rows
+// of the groups of a Frame returned by GroupBy, such as the groups that remain
+// after Having. The rows of subgroups are flattened in turn. Returns error if
+// indexing a row fails. See NewFrame for details on the arguments. Rows are
+// shared with the existing Frame.
+func (f *Frame) Flatten(indexer row.Indexer, args ...frameArg) (*Frame, error) {
+	nf := NewFrame(indexer, args...)
+	var flatten func(g group.Group) error
+	flatten = func(g group.Group) error {
+		for _, data := range g {
+			if sub, ok := data[group.Column].(group.Group); ok {
+				if err := flatten(sub); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := nf.Put(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := f.ForEach(func(data row.Data) error {
+		g, err := groupOf(data)
+		if err != nil {
+			return err
+		}
+		return flatten(g)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Flatten: %v", err)
+	}
+	return nf, nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata/group"
+	"github.com/google/godata/row"
+)
+
+func TestApply(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("k", "i"))
+	f.Put(row.Of("k", "a", "i", 0, "v", 3))
+	f.Put(row.Of("k", "a", "i", 1, "v", 5))
+	f.Put(row.Of("k", "b", "i", 0, "v", 4))
+	f.Put(row.Of("k", "c", "i", 0, "v", 1))
+	grouped, err := f.GroupBy(row.NewColumnIndexer("k"))
+	if err != nil {
+		t.Fatalf("GroupBy: %v", err)
+	}
+
+	// Each group is replaced by its row with the greatest value, and groups
+	// with a single row are dropped.
+	applied, err := grouped.Apply(func(g group.Group) (*Frame, error) {
+		if len(g) < 2 {
+			return nil, nil
+		}
+		best := g[0]
+		for _, data := range g {
+			if data["v"].(int) > best["v"].(int) {
+				best = data
+			}
+		}
+		nf := NewFrame(row.NewColumnIndexer("v"))
+		_, err := nf.Put(row.Of("k", best["k"], "v", best["v"]))
+		return nf, err
+	})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if got, want := applied.String(), "0: map[k:a v:5]\n"; got != want {
+		t.Errorf("Apply = %q; want %q", got, want)
+	}
+
+	if _, err := f.Apply(func(group.Group) (*Frame, error) { return nil, nil }); err == nil {
+		t.Errorf("Apply on an ungrouped Frame = nil error; want error")
+	}
+}
+
+func TestTransform(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("k", "i"))
+	f.Put(row.Of("k", "a", "i", 0, "v", 1.0))
+	f.Put(row.Of("k", "a", "i", 1, "v", 3.0))
+	f.Put(row.Of("k", "b", "i", 0, "v", 2.0))
+	f.Put(row.Of("k", "b", "i", 1, "v", 4.0))
+	f.Put(row.Of("k", "b", "i", 2, "v", 6.0))
+
+	zscore := func(g group.Group) ([]interface{}, error) {
+		var sum, squares float64
+		for _, data := range g {
+			sum += data["v"].(float64)
+		}
+		mean := sum / float64(len(g))
+		for _, data := range g {
+			d := data["v"].(float64) - mean
+			squares += d * d
+		}
+		stddev := math.Sqrt(squares / float64(len(g)))
+		vals := make([]interface{}, len(g))
+		for i, data := range g {
+			vals[i] = (data["v"].(float64) - mean) / stddev
+		}
+		return vals, nil
+	}
+	transformed, err := f.Transform(row.NewColumnIndexer("k"), "z", zscore)
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	if transformed.Indexer() != f.Indexer() || transformed.Len() != f.Len() {
+		t.Errorf("Transform = %v; want the indexer and rows of %v", transformed, f)
+	}
+	var got []float64
+	transformed.ForEach(func(data row.Data) error {
+		got = append(got, math.Round(data["z"].(float64)*1000)/1000)
+		return nil
+	})
+	if want := []float64{-1, 1, -1.225, 0, 1.225}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Transform z = %v; want %v", got, want)
+	}
+	if data, _ := f.Get(row.Of("k", "a", "i", 0)); data["z"] != nil {
+		t.Errorf("Transform modified the Frame: %v", data)
+	}
+
+	_, err = f.Transform(row.NewColumnIndexer("k"), "z", func(group.Group) ([]interface{}, error) {
+		return []interface{}{1}, nil
+	})
+	if err == nil {
+		t.Errorf("Transform with too few values = nil error; want error")
+	}
+
+	// Setting an index column moves the rows to their new indices.
+	reversed, err := f.Transform(row.NewColumnIndexer("k"), "i", func(g group.Group) ([]interface{}, error) {
+		vals := make([]interface{}, len(g))
+		for i := range g {
+			vals[i] = len(g) - 1 - i
+		}
+		return vals, nil
+	})
+	if err != nil {
+		t.Fatalf("Transform of an index column: %v", err)
+	}
+	if data, _ := reversed.Get(row.Of("k", "b", "i", 0)); data["v"] != 6.0 {
+		t.Errorf("Get(k = b, i = 0) after Transform of i = %v; want v = 6", data)
+	}
+}
+
+func TestHaving(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("k", "i"))
+	f.Put(row.Of("k", "a", "i", 0, "v", 3))
+	f.Put(row.Of("k", "a", "i", 1, "v", 5))
+	f.Put(row.Of("k", "b", "i", 0, "v", 4))
+	f.Put(row.Of("k", "c", "i", 0, "v", 1))
+	f.Put(row.Of("k", "c", "i", 1, "v", 1))
+	grouped, err := f.GroupBy(row.NewColumnIndexer("k"))
+	if err != nil {
+		t.Fatalf("GroupBy: %v", err)
+	}
+
+	// Groups of more than one row, whose total exceeds 5.
+	having, err := grouped.Having(func(g group.Group) (bool, error) {
+		sum, err := group.Sum("v")(g)
+		return len(g) > 1 && sum.(int) > 5, err
+	})
+	if err != nil {
+		t.Fatalf("Having: %v", err)
+	}
+	if having.Len() != 1 {
+		t.Fatalf("Having.Len() = %d; want 1", having.Len())
+	}
+	flat, err := having.Flatten(f.Indexer())
+	if err != nil {
+		t.Fatalf("Flatten: %v", err)
+	}
+	want, _ := f.Filter(func(data row.Data) (bool, error) { return data["k"] == "a", nil })
+	if flat.String() != want.String() {
+		t.Errorf("Flatten = %v; want %v", flat, want)
+	}
+
+	// Aggregates added as columns are filtered like any other column.
+	totals, err := grouped.WithColumn("total", group.Sum("v").Action)
+	if err != nil {
+		t.Fatalf("WithColumn: %v", err)
+	}
+	small, err := totals.Filter(func(data row.Data) (bool, error) { return data["total"].(int) < 5, nil })
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+	var keys []interface{}
+	small.ForEach(func(data row.Data) error {
+		keys = append(keys, data["k"])
+		return nil
+	})
+	if want := []interface{}{"b", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Filter(total < 5) = %v; want %v", keys, want)
+	}
+
+	// Subgroups are flattened in turn.
+	nested, err := f.GroupBy(row.NewColumnIndexer("k"), row.NewColumnIndexer("v"))
+	if err != nil {
+		t.Fatalf("GroupBy: %v", err)
+	}
+	if flat, err := nested.Flatten(f.Indexer()); err != nil || flat.String() != f.String() {
+		t.Errorf("Flatten = %v, %v; want %v", flat, err, f)
+	}
+}
@@ -0,0 +1,474 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package arrowio converts between Frames and Apache Arrow record batches, and
+// reads and writes Frames in the Arrow IPC stream and file formats.
+//
+// Column types are mapped as follows when writing a Frame:
+//
+//	int, int64    Int64
+//	int32         Int32
+//	uint64        Uint64
+//	float64       Float64
+//	float32       Float32
+//	bool          Boolean
+//	string        String
+//	[]byte        Binary
+//	time.Time     Timestamp (nanoseconds, UTC)
+//
+// A column containing only nil values is written as Null. Nil values and
+// columns missing from a row are written as nulls. When reading, integer types
+// other than Uint64 are read as int (see row.NewIndex), and null values are
+// left out of the row.
+//
+// The columns of a ColumnIndexer are written first and recorded in the schema
+// metadata, so that a Frame read back is indexed by the same columns.
+package arrowio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+)
+
+const (
+	// IndexMetadataKey is the schema metadata key that lists the index columns
+	// of the Frame, as a JSON array of column names.
+	IndexMetadataKey = "godata.index"
+
+	// DefaultBatchSize is the default number of rows in each record batch.
+	DefaultBatchSize = 64 * 1024
+)
+
+// Options configures the conversion between Frames and Arrow records. A nil
+// *Options uses the defaults.
+type Options struct {
+	// BatchSize is the maximum number of rows in each record batch written.
+	// Zero means DefaultBatchSize.
+	BatchSize int
+
+	// Allocator allocates the memory of records. Nil means a Go allocator.
+	Allocator memory.Allocator
+
+	// Indexer indexes the Frame read from Arrow records. If nil, then the
+	// Frame is indexed by the columns listed in the schema metadata.
+	Indexer row.Indexer
+
+	// AllowDuplicates creates the Frame read from Arrow records with the
+	// godata.AllowDuplicates option.
+	AllowDuplicates bool
+}
+
+func (o *Options) batchSize() int {
+	if o == nil || o.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return o.BatchSize
+}
+
+func (o *Options) allocator() memory.Allocator {
+	if o == nil || o.Allocator == nil {
+		return memory.NewGoAllocator()
+	}
+	return o.Allocator
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// dataType returns the Arrow type for values of the Go type.
+func dataType(typ reflect.Type) (arrow.DataType, bool) {
+	switch typ {
+	case nil:
+		return arrow.Null, true
+	case timeType:
+		return &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"}, true
+	case bytesType:
+		return arrow.BinaryTypes.Binary, true
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int64:
+		return arrow.PrimitiveTypes.Int64, true
+	case reflect.Int32:
+		return arrow.PrimitiveTypes.Int32, true
+	case reflect.Uint64:
+		return arrow.PrimitiveTypes.Uint64, true
+	case reflect.Float64:
+		return arrow.PrimitiveTypes.Float64, true
+	case reflect.Float32:
+		return arrow.PrimitiveTypes.Float32, true
+	case reflect.Bool:
+		return arrow.FixedWidthTypes.Boolean, true
+	case reflect.String:
+		return arrow.BinaryTypes.String, true
+	}
+	return nil, false
+}
+
+// Schema returns the Arrow schema of the Frame. Index columns come first in
+// index order, followed by the other columns in name order. The type of each
+// column is determined by its non-nil values. Returns error if a column
+// contains values of different types, or of a type that cannot be converted.
+func Schema(f *godata.Frame) (*arrow.Schema, error) {
+	types := make(map[string]reflect.Type)
+	err := f.ForEach(func(data row.Data) error {
+		for col, val := range data {
+			typ, ok := types[col]
+			if val == nil || typ == reflect.TypeOf(val) {
+				if !ok {
+					types[col] = nil
+				}
+				continue
+			}
+			if typ != nil {
+				return fmt.Errorf("Schema: column %q has values of types %v and %T", col, typ, val)
+			}
+			types[col] = reflect.TypeOf(val)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index := row.IndexColumns(f.Indexer())
+	var columns []string
+	for col := range types {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	position := make(map[string]int, len(index))
+	for i, col := range index {
+		position[col] = i - len(index)
+	}
+	sort.SliceStable(columns, func(i, j int) bool {
+		return position[columns[i]] < position[columns[j]]
+	})
+
+	fields := make([]arrow.Field, 0, len(columns))
+	for _, col := range columns {
+		dt, ok := dataType(types[col])
+		if !ok {
+			return nil, fmt.Errorf("Schema: column %q has unsupported type %v", col, types[col])
+		}
+		fields = append(fields, arrow.Field{Name: col, Type: dt, Nullable: true})
+	}
+
+	var metadata *arrow.Metadata
+	if index != nil {
+		b, err := json.Marshal(index)
+		if err != nil {
+			return nil, err
+		}
+		md := arrow.NewMetadata([]string{IndexMetadataKey}, []string{string(b)})
+		metadata = &md
+	}
+	return arrow.NewSchema(fields, metadata), nil
+}
+
+// Records converts the Frame into record batches of at most Options.BatchSize
+// rows in index order, and calls fn for each of them. The record is released
+// when fn returns, so fn must call Retain to keep it. Returns the first error
+// returned by fn.
+func Records(f *godata.Frame, opts *Options, fn func(array.Record) error) error {
+	schema, err := Schema(f)
+	if err != nil {
+		return err
+	}
+	return records(f, schema, opts, fn)
+}
+
+// records converts the Frame into record batches of the given schema.
+func records(f *godata.Frame, schema *arrow.Schema, opts *Options, fn func(array.Record) error) error {
+	b := array.NewRecordBuilder(opts.allocator(), schema)
+	defer b.Release()
+
+	var (
+		size = opts.batchSize()
+		rows int
+	)
+	flush := func() error {
+		rec := b.NewRecord()
+		defer rec.Release()
+		rows = 0
+		return fn(rec)
+	}
+	err := f.ForEach(func(data row.Data) error {
+		for i, field := range schema.Fields() {
+			if err := appendValue(b.Field(i), data[field.Name]); err != nil {
+				return fmt.Errorf("column %q: %v", field.Name, err)
+			}
+		}
+		if rows++; rows == size {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if rows > 0 || f.Len() == 0 {
+		return flush()
+	}
+	return nil
+}
+
+// appendValue appends the value to the builder of its column.
+func appendValue(b array.Builder, val interface{}) error {
+	if val == nil {
+		b.AppendNull()
+		return nil
+	}
+	ok := true
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		switch v := val.(type) {
+		case int:
+			b.Append(int64(v))
+		case int64:
+			b.Append(v)
+		default:
+			ok = false
+		}
+	case *array.Int32Builder:
+		var v int32
+		if v, ok = val.(int32); ok {
+			b.Append(v)
+		}
+	case *array.Uint64Builder:
+		var v uint64
+		if v, ok = val.(uint64); ok {
+			b.Append(v)
+		}
+	case *array.Float64Builder:
+		var v float64
+		if v, ok = val.(float64); ok {
+			b.Append(v)
+		}
+	case *array.Float32Builder:
+		var v float32
+		if v, ok = val.(float32); ok {
+			b.Append(v)
+		}
+	case *array.BooleanBuilder:
+		var v bool
+		if v, ok = val.(bool); ok {
+			b.Append(v)
+		}
+	case *array.StringBuilder:
+		var v string
+		if v, ok = val.(string); ok {
+			b.Append(v)
+		}
+	case *array.BinaryBuilder:
+		var v []byte
+		if v, ok = val.([]byte); ok {
+			b.Append(v)
+		}
+	case *array.TimestampBuilder:
+		var v time.Time
+		if v, ok = val.(time.Time); ok {
+			b.Append(arrow.Timestamp(v.UnixNano()))
+		}
+	default:
+		ok = false
+	}
+	if !ok {
+		return fmt.Errorf("cannot append %v of type %T", val, val)
+	}
+	return nil
+}
+
+// WriteStream writes the Frame to w in the Arrow IPC stream format.
+func WriteStream(w io.Writer, f *godata.Frame, opts *Options) error {
+	schema, err := Schema(f)
+	if err != nil {
+		return err
+	}
+	iw := ipc.NewWriter(w, ipc.WithSchema(schema), ipc.WithAllocator(opts.allocator()))
+	if err := records(f, schema, opts, iw.Write); err != nil {
+		iw.Close()
+		return err
+	}
+	return iw.Close()
+}
+
+// WriteFile writes the Frame to w in the Arrow IPC file format.
+func WriteFile(w io.WriteSeeker, f *godata.Frame, opts *Options) error {
+	schema, err := Schema(f)
+	if err != nil {
+		return err
+	}
+	fw, err := ipc.NewFileWriter(w, ipc.WithSchema(schema), ipc.WithAllocator(opts.allocator()))
+	if err != nil {
+		return err
+	}
+	if err := records(f, schema, opts, fw.Write); err != nil {
+		fw.Close()
+		return err
+	}
+	return fw.Close()
+}
+
+// ReadRecords returns a Frame containing the rows of every record read from r.
+// The Frame is indexed by Options.Indexer if given, or else by the index
+// columns in the schema metadata. Returns a godata.ErrRows if any row cannot be
+// indexed, together with a Frame containing the other rows.
+func ReadRecords(r array.RecordReader, opts *Options) (*godata.Frame, error) {
+	b, err := newBuilder(r.Schema(), opts)
+	if err != nil {
+		return nil, err
+	}
+	for r.Next() {
+		if err := addRecord(b, r.Record()); err != nil {
+			return nil, err
+		}
+	}
+	if err, ok := r.(interface{ Err() error }); ok && err.Err() != nil {
+		return nil, err.Err()
+	}
+	return b.Frame()
+}
+
+// ReadStream reads a Frame from r in the Arrow IPC stream format. See
+// ReadRecords.
+func ReadStream(r io.Reader, opts *Options) (*godata.Frame, error) {
+	ir, err := ipc.NewReader(r, ipc.WithAllocator(opts.allocator()))
+	if err != nil {
+		return nil, err
+	}
+	defer ir.Release()
+	return ReadRecords(ir, opts)
+}
+
+// ReadFile reads a Frame from r in the Arrow IPC file format. See ReadRecords.
+func ReadFile(r ipc.ReadAtSeeker, opts *Options) (*godata.Frame, error) {
+	fr, err := ipc.NewFileReader(r, ipc.WithAllocator(opts.allocator()))
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	b, err := newBuilder(fr.Schema(), opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < fr.NumRecords(); i++ {
+		rec, err := fr.Record(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := addRecord(b, rec); err != nil {
+			return nil, err
+		}
+	}
+	return b.Frame()
+}
+
+// newBuilder returns a Builder for a Frame read from records of the schema.
+func newBuilder(schema *arrow.Schema, opts *Options) (*godata.Builder, error) {
+	var indexer row.Indexer
+	if opts != nil && opts.Indexer != nil {
+		indexer = opts.Indexer
+	} else {
+		md := schema.Metadata()
+		i := md.FindKey(IndexMetadataKey)
+		if i < 0 {
+			return nil, fmt.Errorf("no indexer given and no %q in schema metadata", IndexMetadataKey)
+		}
+		var columns []string
+		if err := json.Unmarshal([]byte(md.Values()[i]), &columns); err != nil {
+			return nil, fmt.Errorf("invalid %q in schema metadata: %v", IndexMetadataKey, err)
+		}
+		indexer = row.NewColumnIndexer(columns...)
+	}
+	if opts != nil && opts.AllowDuplicates {
+		return godata.NewBuilder(indexer, godata.AllowDuplicates()), nil
+	}
+	return godata.NewBuilder(indexer), nil
+}
+
+// addRecord adds the rows of the record to the Builder.
+func addRecord(b *godata.Builder, rec array.Record) error {
+	rows := make([]row.Data, rec.NumRows())
+	for i := range rows {
+		rows[i] = make(row.Data, rec.NumCols())
+	}
+	for j, col := range rec.Columns() {
+		if _, ok := col.(*array.Null); ok {
+			continue
+		}
+		name := rec.ColumnName(j)
+		for i := range rows {
+			if col.IsNull(i) {
+				continue
+			}
+			val, err := value(col, i)
+			if err != nil {
+				return fmt.Errorf("column %q: %v", name, err)
+			}
+			rows[i][name] = val
+		}
+	}
+	b.Add(rows...)
+	return nil
+}
+
+// value returns the Go value of the non-null element i of the array. Strings
+// and byte slices are copied, since the memory of the array may be reused.
+func value(arr array.Interface, i int) (interface{}, error) {
+	switch arr := arr.(type) {
+	case *array.Int8:
+		return int(arr.Value(i)), nil
+	case *array.Int16:
+		return int(arr.Value(i)), nil
+	case *array.Int32:
+		return int(arr.Value(i)), nil
+	case *array.Int64:
+		return int(arr.Value(i)), nil
+	case *array.Uint8:
+		return int(arr.Value(i)), nil
+	case *array.Uint16:
+		return int(arr.Value(i)), nil
+	case *array.Uint32:
+		return int(arr.Value(i)), nil
+	case *array.Uint64:
+		return arr.Value(i), nil
+	case *array.Float32:
+		return arr.Value(i), nil
+	case *array.Float64:
+		return arr.Value(i), nil
+	case *array.Boolean:
+		return arr.Value(i), nil
+	case *array.String:
+		return string([]byte(arr.Value(i))), nil
+	case *array.Binary:
+		return append([]byte(nil), arr.Value(i)...), nil
+	case *array.Timestamp:
+		unit := arr.DataType().(*arrow.TimestampType).Unit
+		return time.Unix(0, int64(arr.Value(i))*int64(unit.Multiplier())).UTC(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", arr.DataType())
+}
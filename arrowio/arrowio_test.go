@@ -0,0 +1,174 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package arrowio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+)
+
+// testFrame returns a Frame with n rows of every supported column type.
+func testFrame(n int) *godata.Frame {
+	f := godata.NewFrame(row.NewColumnIndexer("s", "i"))
+	for i := 0; i < n; i++ {
+		data := row.Of(
+			"s", string(rune('a'+i%3)),
+			"i", i,
+			"f", float64(i)/2,
+			"f32", float32(i),
+			"b", i%2 == 0,
+			"bytes", []byte{byte(i)},
+			"t", time.Unix(int64(i), 0).UTC(),
+			"u", uint64(i),
+			"none", nil,
+		)
+		if i%4 == 0 {
+			delete(data, "f")
+		}
+		f.Put(data)
+	}
+	return f
+}
+
+// checkFrame fails the test unless the Frames have the same rows. Missing and
+// nil values are considered equal.
+func checkFrame(t *testing.T, got, want *godata.Frame) {
+	t.Helper()
+	wantRows, _ := want.GetRange()
+	for _, data := range wantRows {
+		for col, val := range data {
+			if val == nil {
+				delete(data, col)
+			}
+		}
+	}
+	gotRows, err := got.GetRange()
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	if !reflect.DeepEqual(gotRows, wantRows) {
+		t.Errorf("GetRange = %v; want %v", gotRows, wantRows)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := Schema(testFrame(4))
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	var names []string
+	for _, field := range schema.Fields() {
+		names = append(names, field.Name)
+	}
+	want := []string{"s", "i", "b", "bytes", "f", "f32", "none", "t", "u"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Schema columns = %v; want %v", names, want)
+	}
+	for _, c := range []struct {
+		col string
+		typ arrow.DataType
+	}{
+		{"i", arrow.PrimitiveTypes.Int64},
+		{"s", arrow.BinaryTypes.String},
+		{"none", arrow.Null},
+		{"b", arrow.FixedWidthTypes.Boolean},
+	} {
+		fields, _ := schema.FieldsByName(c.col)
+		if len(fields) != 1 || !arrow.TypeEqual(fields[0].Type, c.typ) {
+			t.Errorf("Schema %q = %v; want %v", c.col, fields, c.typ)
+		}
+	}
+
+	f := godata.NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 0, "data", "foo"))
+	f.Put(row.Of("i", 1, "data", 1))
+	if _, err := Schema(f); err == nil {
+		t.Errorf("Schema succeeded for column of mixed types; want error")
+	}
+}
+
+func TestRecords(t *testing.T) {
+	var sizes []int64
+	err := Records(testFrame(10), &Options{BatchSize: 4}, func(rec array.Record) error {
+		sizes = append(sizes, rec.NumRows())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Records: %v", err)
+	}
+	if want := []int64{4, 4, 2}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("Records batch sizes = %v; want %v", sizes, want)
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	f := testFrame(10)
+	var buf bytes.Buffer
+	if err := WriteStream(&buf, f, &Options{BatchSize: 3}); err != nil {
+		t.Fatalf("WriteStream: %v", err)
+	}
+	nf, err := ReadStream(&buf, nil)
+	if err != nil {
+		t.Fatalf("ReadStream: %v", err)
+	}
+	checkFrame(t, nf, f)
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	f := testFrame(10)
+	file, err := os.Create(filepath.Join(t.TempDir(), "frame.arrow"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer file.Close()
+	if err := WriteFile(file, f, &Options{BatchSize: 3}); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	nf, err := ReadFile(file, nil)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	checkFrame(t, nf, f)
+}
+
+func TestReadIndexer(t *testing.T) {
+	f := godata.NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 0, "user", "b"))
+	f.Put(row.Of("i", 1, "user", "a"))
+	f.Put(row.Of("i", 2, "user", "a"))
+
+	var buf bytes.Buffer
+	if err := WriteStream(&buf, f, nil); err != nil {
+		t.Fatalf("WriteStream: %v", err)
+	}
+	nf, err := ReadStream(&buf, &Options{
+		Indexer:         row.NewColumnIndexer("user"),
+		AllowDuplicates: true,
+	})
+	if err != nil {
+		t.Fatalf("ReadStream: %v", err)
+	}
+	if rows, _ := nf.GetAll(row.Of("user", "a")); len(rows) != 2 {
+		t.Errorf("GetAll = %v; want 2 rows", rows)
+	}
+}
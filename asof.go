@@ -0,0 +1,220 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/google/btree"
+	"github.com/google/godata/row"
+)
+
+// AsOfDirection selects the rows matched by AsOfJoin.
+type AsOfDirection int
+
+const (
+	// Backward matches the last row at or before the key.
+	Backward AsOfDirection = iota
+
+	// Forward matches the first row at or after the key.
+	Forward
+
+	// Nearest matches the closest row before or after the key, preferring
+	// the row before on ties.
+	Nearest
+)
+
+var asOfDirectionNames = []string{"Backward", "Forward", "Nearest"}
+
+func (d AsOfDirection) String() string {
+	if d < 0 || int(d) >= len(asOfDirectionNames) {
+		return fmt.Sprintf("AsOfDirection(%d)", int(d))
+	}
+	return asOfDirectionNames[d]
+}
+
+// AsOfOptions configure AsOfJoin. A nil *AsOfOptions matches backward, with no
+// By columns and no tolerance.
+type AsOfOptions struct {
+	// By are columns whose values must be equal in the rows joined, such as
+	// a ticker symbol.
+	By []string
+
+	// Direction selects the row matched for each key.
+	Direction AsOfDirection
+
+	// Tolerance is the greatest distance between the keys of the rows
+	// joined if it is positive, in which case the keys must be ints.
+	Tolerance int
+}
+
+// AsOfJoin returns a new Frame with the same indexer and options, in which each
+// row is merged with the row of the given Frame whose value of the on column
+// is nearest to its own in the given direction, among the rows with equal
+// values of the By columns. For example, joining trades with quotes backward
+// on time by symbol matches each trade with the latest quote for the symbol at
+// or before the time of the trade. Columns present in both rows keep the value
+// of the row of the Frame. Rows without a match, or missing one of the
+// columns, are kept unchanged. If several rows of the given Frame share the
+// matched key, then the last row added is matched.
+//
+// The given Frame must be indexed by a ColumnIndexer on the By columns
+// followed by the on column, so that each row is matched by a btree lookup.
+// Returns error if the values of the columns in a row have different types
+// than the index of the given Frame. Secondary indexes are not copied to the
+// returned Frame.
+func (f *Frame) AsOfJoin(frame *Frame, on string, opts *AsOfOptions) (*Frame, error) {
+	if opts == nil {
+		opts = &AsOfOptions{}
+	}
+	columns := append(append([]string(nil), opts.By...), on)
+	if !reflect.DeepEqual(row.IndexColumns(frame.indexer), columns) {
+		return nil, fmt.Errorf("AsOfJoin: Frame is not indexed by columns %v", columns)
+	}
+
+	// The values of each row are checked against the types of the index,
+	// since indices of different types cannot be compared.
+	var types []reflect.Type
+	if first := frame.bt.Min(); first != nil {
+		for _, col := range columns {
+			types = append(types, reflect.TypeOf(first.(row.Row).Data[col]))
+		}
+	}
+	if (opts.Direction == Nearest || opts.Tolerance > 0) && types != nil && types[len(types)-1] != reflect.TypeOf(0) {
+		return nil, fmt.Errorf("AsOfJoin: column %q has type %v, but Nearest and Tolerance require ints", on, types[len(types)-1])
+	}
+
+	var (
+		nf        = f.Empty()
+		returnErr error
+	)
+	f.bt.Ascend(func(item btree.Item) bool {
+		r := item.(row.Row)
+		vals := make([]interface{}, len(columns))
+		for i, col := range columns {
+			val, ok := r.Data[col]
+			if !ok || val == nil || types == nil {
+				nf.bt.ReplaceOrInsert(row.Row{Index: r.Index, Data: f.out(r.Data)})
+				return true
+			}
+			if typ := reflect.TypeOf(val); typ != types[i] {
+				returnErr = fmt.Errorf("AsOfJoin: %q has type %v but saw %v of type %v", col, types[i], val, typ)
+				return false
+			}
+			vals[i] = val
+		}
+		match, err := frame.asOf(on, vals, opts)
+		if err != nil {
+			returnErr = fmt.Errorf("AsOfJoin: %v", err)
+			return false
+		}
+		if match != nil {
+			data := match.Copy()
+			for col, val := range r.Data {
+				data[col] = val
+			}
+			r = row.Row{Index: r.Index, Data: data}
+		} else {
+			r = row.Row{Index: r.Index, Data: f.out(r.Data)}
+		}
+		nf.bt.ReplaceOrInsert(r)
+		return true
+	})
+	if returnErr != nil {
+		return nil, returnErr
+	}
+	return nf, nil
+}
+
+// asOf returns the row matched for the values of the By and on columns, or nil
+// if there is no match.
+func (f *Frame) asOf(on string, vals []interface{}, opts *AsOfOptions) (row.Data, error) {
+	index, err := row.NewIndex(vals...)
+	if err != nil {
+		return nil, err
+	}
+	by := vals[:len(vals)-1]
+	key := vals[len(vals)-1]
+
+	// matches returns the row of the item if its By columns are equal, and its
+	// key is within the tolerance.
+	matches := func(item btree.Item) row.Data {
+		data := item.(row.Row).Data
+		for i, col := range opts.By {
+			if data[col] != by[i] {
+				return nil
+			}
+		}
+		if opts.Tolerance > 0 && distance(key.(int), data[on].(int)) > opts.Tolerance {
+			return nil
+		}
+		return data
+	}
+
+	var before, after row.Data
+	if opts.Direction != Forward {
+		// The last of the rows that share the key sorts before the greatest
+		// sequence number.
+		var pivot btree.Item = index
+		if f.duplicates {
+			pivot = sequencedIndex{index: index, seq: math.MaxUint64}
+		}
+		f.bt.DescendLessOrEqual(pivot, func(item btree.Item) bool {
+			before = matches(item)
+			return false
+		})
+	}
+	if opts.Direction != Backward {
+		var next btree.Item
+		f.bt.AscendGreaterOrEqual(f.pivot(index), func(item btree.Item) bool {
+			next = item
+			return false
+		})
+		if next != nil && f.duplicates {
+			// The first row found has the least key that is not less, but the
+			// last of the rows that share that key is matched.
+			last := sequencedIndex{index: next.(row.Row).Index.(sequencedIndex).index, seq: math.MaxUint64}
+			f.bt.DescendLessOrEqual(last, func(item btree.Item) bool {
+				next = item
+				return false
+			})
+		}
+		if next != nil {
+			after = matches(next)
+		}
+	}
+	switch {
+	case before == nil:
+		return after, nil
+	case after == nil:
+		return before, nil
+	case distance(key.(int), after[on].(int)) < distance(key.(int), before[on].(int)):
+		return after, nil
+	}
+	return before, nil
+}
+
+// distance returns the distance between two ints, or math.MaxInt if it
+// overflows.
+func distance(a, b int) int {
+	if a < b {
+		a, b = b, a
+	}
+	if d := uint(a) - uint(b); d <= math.MaxInt {
+		return int(d)
+	}
+	return math.MaxInt
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+func TestAsOfJoin(t *testing.T) {
+	trades := NewFrame(row.NewColumnIndexer("id"))
+	trades.Put(row.Of("id", 1, "sym", "A", "time", 10))
+	trades.Put(row.Of("id", 2, "sym", "A", "time", 14))
+	trades.Put(row.Of("id", 3, "sym", "B", "time", 14))
+	trades.Put(row.Of("id", 4, "sym", "B", "time", 1))
+	trades.Put(row.Of("id", 5, "sym", "C", "time", 5))
+	trades.Put(row.Of("id", 6, "sym", "A"))
+
+	quotes := NewFrame(row.NewColumnIndexer("sym", "time"), AllowDuplicates())
+	quotes.Put(row.Of("sym", "A", "time", 8, "bid", 1))
+	quotes.Put(row.Of("sym", "A", "time", 10, "bid", 2))
+	quotes.Put(row.Of("sym", "A", "time", 10, "bid", 3))
+	quotes.Put(row.Of("sym", "A", "time", 20, "bid", 4))
+	quotes.Put(row.Of("sym", "B", "time", 2, "bid", 5))
+	quotes.Put(row.Of("sym", "B", "time", 12, "bid", 6))
+
+	tests := []struct {
+		opts *AsOfOptions
+		bids []interface{}
+	}{
+		{&AsOfOptions{By: []string{"sym"}}, []interface{}{3, 3, 6, nil, nil, nil}},
+		{&AsOfOptions{By: []string{"sym"}, Direction: Forward}, []interface{}{3, 4, nil, 5, nil, nil}},
+		{&AsOfOptions{By: []string{"sym"}, Direction: Nearest}, []interface{}{3, 3, 6, 5, nil, nil}},
+		{&AsOfOptions{By: []string{"sym"}, Direction: Nearest, Tolerance: 1}, []interface{}{3, nil, nil, 5, nil, nil}},
+		{&AsOfOptions{By: []string{"sym"}, Tolerance: 2}, []interface{}{3, nil, 6, nil, nil, nil}},
+	}
+	for _, test := range tests {
+		joined, err := trades.AsOfJoin(quotes, "time", test.opts)
+		if err != nil {
+			t.Fatalf("AsOfJoin(%+v): %v", test.opts, err)
+		}
+		var bids []interface{}
+		joined.ForEach(func(data row.Data) error {
+			bids = append(bids, data["bid"])
+			return nil
+		})
+		if !reflect.DeepEqual(bids, test.bids) {
+			t.Errorf("AsOfJoin(%+v) bids = %v; want %v", test.opts, bids, test.bids)
+		}
+	}
+
+	// Without By columns, every row of the given Frame is a candidate.
+	prices := NewFrame(row.NewColumnIndexer("time"))
+	prices.Put(row.Of("time", 3, "price", 30, "sym", "X"))
+	prices.Put(row.Of("time", 12, "price", 120))
+	joined, err := trades.AsOfJoin(prices, "time", nil)
+	if err != nil {
+		t.Fatalf("AsOfJoin: %v", err)
+	}
+	got, _ := joined.Get(row.Of("id", 5))
+	if want := row.Of("id", 5, "sym", "C", "time", 5, "price", 30); !reflect.DeepEqual(got, want) {
+		t.Errorf("AsOfJoin.Get(5) = %v; want %v", got, want)
+	}
+	if got, _ := trades.Get(row.Of("id", 5)); got["price"] != nil {
+		t.Errorf("AsOfJoin modified the Frame: %v", got)
+	}
+
+	if _, err := trades.AsOfJoin(quotes, "time", nil); err == nil {
+		t.Errorf("AsOfJoin succeeded without By columns of the index; want error")
+	}
+	if _, err := trades.AsOfJoin(quotes, "sym", &AsOfOptions{By: []string{"time"}}); err == nil {
+		t.Errorf("AsOfJoin succeeded with columns in the wrong order; want error")
+	}
+	byTime := NewFrame(row.NewColumnIndexer("sym"))
+	byTime.Put(row.Of("sym", "A"))
+	if _, err := trades.AsOfJoin(byTime, "sym", &AsOfOptions{Direction: Nearest}); err == nil {
+		t.Errorf("AsOfJoin succeeded for Nearest strings; want error")
+	}
+	trades.Put(row.Of("id", 7, "sym", "A", "time", "late"))
+	if _, err := trades.AsOfJoin(quotes, "time", &AsOfOptions{By: []string{"sym"}}); err == nil {
+		t.Errorf("AsOfJoin succeeded for a time of the wrong type; want error")
+	}
+}
+
+func TestAsOfJoinDuplicates(t *testing.T) {
+	trades := NewFrame(row.NewColumnIndexer("time"))
+	for _, time := range []int{5, 10, 15, 25} {
+		trades.Put(row.Of("time", time))
+	}
+	quotes := NewFrame(row.NewColumnIndexer("time"), AllowDuplicates())
+	quotes.Put(row.Of("time", 10, "bid", 1))
+	quotes.Put(row.Of("time", 10, "bid", 2))
+	quotes.Put(row.Of("time", 20, "bid", 3))
+	quotes.Put(row.Of("time", 20, "bid", 4))
+
+	// Whichever direction a key is found in, the last row with that key is
+	// matched.
+	for _, test := range []struct {
+		direction AsOfDirection
+		bids      []interface{}
+	}{
+		{Backward, []interface{}{nil, 2, 2, 4}},
+		{Forward, []interface{}{2, 2, 4, nil}},
+		{Nearest, []interface{}{2, 2, 2, 4}},
+	} {
+		joined, err := trades.AsOfJoin(quotes, "time", &AsOfOptions{Direction: test.direction})
+		if err != nil {
+			t.Fatalf("AsOfJoin(%v): %v", test.direction, err)
+		}
+		var bids []interface{}
+		joined.ForEach(func(data row.Data) error {
+			bids = append(bids, data["bid"])
+			return nil
+		})
+		if !reflect.DeepEqual(bids, test.bids) {
+			t.Errorf("AsOfJoin(%v) bids = %v; want %v", test.direction, bids, test.bids)
+		}
+	}
+}
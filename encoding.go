@@ -0,0 +1,215 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"github.com/google/godata/row"
+)
+
+// The binary encoding of a Frame consists of a fixed header followed by a gob
+// stream. The header is the magic string "GODT", then the major and minor
+// format versions as big-endian uint16s. The gob stream contains an
+// encodedFrame, followed by one encodedRow for each row in index order.
+//
+// Compatibility rules:
+//   - Readers reject encodings with a major version newer than formatMajor.
+//   - Minor versions only add fields to encodedFrame and encodedRow. Readers
+//     ignore fields they do not know, and fields missing from older encodings
+//     decode as zero values, so any minor version of a major version may be
+//     read.
+//   - Indexers, Index types and column values are encoded as gob interface
+//     values, and so must be registered with gob.Register by both the writer
+//     and the reader. The types defined by godata and its subpackages are
+//     registered already.
+const (
+	formatMagic = "GODT"
+	formatMajor = 1
+	formatMinor = 0
+)
+
+// encodedFrame is the configuration of an encoded Frame.
+type encodedFrame struct {
+	Indexer         row.Indexer
+	AllowDuplicates bool
+	Degree          int
+	Seq             uint64
+	Indexes         map[string]row.Indexer
+	Rows            int
+}
+
+// encodedRow is a row of an encoded Frame.
+type encodedRow struct {
+	Index row.Index
+
+	// Seq orders rows with the same index in Frames that allow duplicates.
+	Seq uint64
+
+	Data row.Data
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// byteReader is a Reader that gob reads from without buffering.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r byteReader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// WriteTo writes the binary encoding of the Frame, including its configuration
+// and secondary indexes, to w. Returns the number of bytes written. Returns
+// error if the indexers or any column value cannot be encoded.
+func (f *Frame) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	var header [8]byte
+	copy(header[:4], formatMagic)
+	binary.BigEndian.PutUint16(header[4:6], formatMajor)
+	binary.BigEndian.PutUint16(header[6:8], formatMinor)
+	if _, err := cw.Write(header[:]); err != nil {
+		return cw.n, err
+	}
+
+	indexes := make(map[string]row.Indexer, len(f.secondary))
+	for name, s := range f.secondary {
+		indexes[name] = s.indexer
+	}
+	enc := gob.NewEncoder(cw)
+	err := enc.Encode(encodedFrame{
+		Indexer:         f.indexer,
+		AllowDuplicates: f.duplicates,
+		Degree:          f.degree,
+		Seq:             f.seq,
+		Indexes:         indexes,
+		Rows:            f.bt.Len(),
+	})
+	if err != nil {
+		return cw.n, fmt.Errorf("WriteTo: %v", err)
+	}
+
+	_, err = f.forRange(&rangeOptions{}, func(r row.Row) (interface{}, error) {
+		er := encodedRow{
+			Index: r.Index,
+			Data:  r.Data,
+		}
+		if s, ok := r.Index.(sequencedIndex); ok {
+			er.Index, er.Seq = s.index, s.seq
+		}
+		return nil, enc.Encode(er)
+	})
+	if err != nil {
+		return cw.n, fmt.Errorf("WriteTo: %v", err)
+	}
+	return cw.n, nil
+}
+
+// ReadFrom replaces the contents and configuration of the Frame with a Frame
+// encoded by WriteTo, and returns the number of bytes read. A zero Frame may be
+// used as the receiver. Rows are restored with their encoded indices rather
+// than being indexed again. Unless r implements io.ByteReader, ReadFrom may
+// read past the end of the encoded Frame.
+func (f *Frame) ReadFrom(r io.Reader) (int64, error) {
+	if f.readOnly {
+		return 0, ErrReadOnly
+	}
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	cr := &countingReader{r: br}
+
+	var header [8]byte
+	if _, err := io.ReadFull(cr, header[:]); err != nil {
+		return cr.n, fmt.Errorf("ReadFrom: %v", err)
+	}
+	if string(header[:4]) != formatMagic {
+		return cr.n, fmt.Errorf("ReadFrom: not an encoded Frame")
+	}
+	if major := binary.BigEndian.Uint16(header[4:6]); major > formatMajor {
+		return cr.n, fmt.Errorf("ReadFrom: unsupported format version %d", major)
+	}
+
+	dec := gob.NewDecoder(cr)
+	var ef encodedFrame
+	if err := dec.Decode(&ef); err != nil {
+		return cr.n, fmt.Errorf("ReadFrom: %v", err)
+	}
+	if ef.Indexer == nil {
+		return cr.n, fmt.Errorf("ReadFrom: no indexer")
+	}
+	if ef.Degree < 2 {
+		return cr.n, fmt.Errorf("ReadFrom: invalid btree degree %d", ef.Degree)
+	}
+	nf := NewFrame(ef.Indexer, Degree(ef.Degree))
+	nf.duplicates = ef.AllowDuplicates
+	nf.seq = ef.Seq
+
+	for i := 0; i < ef.Rows; i++ {
+		var er encodedRow
+		if err := dec.Decode(&er); err != nil {
+			return cr.n, fmt.Errorf("ReadFrom: row %d: %v", i, err)
+		}
+		index := er.Index
+		if nf.duplicates {
+			index = sequencedIndex{index: index, seq: er.Seq}
+		}
+		nf.bt.ReplaceOrInsert(row.Row{
+			Index: index,
+			Data:  er.Data,
+		})
+	}
+	for name, indexer := range ef.Indexes {
+		if err := nf.AddIndex(name, indexer); err != nil {
+			return cr.n, fmt.Errorf("ReadFrom: %v", err)
+		}
+	}
+
+	*f = *nf
+	return cr.n, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata/group"
+	"github.com/google/godata/row"
+)
+
+// roundTrip encodes and decodes the Frame.
+func roundTrip(t *testing.T, f *Frame) *Frame {
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo = %d; wrote %d bytes", n, buf.Len())
+	}
+
+	var nf Frame
+	m, err := nf.ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if m != n {
+		t.Errorf("ReadFrom = %d; want %d", m, n)
+	}
+	return &nf
+}
+
+func TestEncodeFrame(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("s", "i"), AllowDuplicates(), Degree(4))
+	f.AddIndex("data", row.NewColumnIndexer("data"))
+	f.Put(row.Of("s", "a", "i", 1, "data", "foo"))
+	f.Put(row.Of("s", "a", "i", 1, "data", "bar"))
+	f.Put(row.Of("s", "b", "i", 0, "data", "baz", "extra", 1.5))
+
+	nf := roundTrip(t, f)
+	want, _ := f.GetRange()
+	got, err := nf.GetRange()
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRange = %v; want %v", got, want)
+	}
+	if rows, _ := nf.GetBy("data", row.Of("data", "baz")); len(rows) != 1 {
+		t.Errorf("GetBy = %v; want secondary index restored", rows)
+	}
+
+	// New rows are added after the decoded duplicates.
+	nf.Put(row.Of("s", "a", "i", 1, "data", "qux"))
+	if rows, _ := nf.GetAll(row.Of("s", "a", "i", 1)); len(rows) != 3 || rows[2]["data"] != "qux" {
+		t.Errorf("GetAll = %v; want qux last", rows)
+	}
+}
+
+func TestEncodeCells(t *testing.T) {
+	f1 := NewFrame(row.NewColumnIndexer("i"))
+	f2 := NewFrame(row.NewColumnIndexer("i"))
+	f1.Put(row.Of("i", 0, "data", "foo"))
+	f2.Put(row.Of("i", 0, "data", "bar"))
+	f2.Put(row.Of("i", 1, "data", "baz"))
+	joined, err := f1.Joined(f2)
+	if err != nil {
+		t.Fatalf("Joined: %v", err)
+	}
+	grouped, err := f2.GroupBy(row.NewColumnIndexer("data"))
+	if err != nil {
+		t.Fatalf("GroupBy: %v", err)
+	}
+
+	for _, f := range []*Frame{joined, grouped} {
+		want, _ := f.GetRange()
+		got, err := roundTrip(t, f).GetRange()
+		if err != nil {
+			t.Fatalf("GetRange: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetRange = %v; want %v", got, want)
+		}
+	}
+
+	got, _ := roundTrip(t, grouped).Get(row.Of(group.Column, group.New(row.Of("data", "baz"))))
+	if got == nil {
+		t.Errorf("Get on decoded grouped Frame = nil; want group")
+	}
+}
+
+func TestDecodeNewerVersion(t *testing.T) {
+	var buf bytes.Buffer
+	NewFrame(row.NewColumnIndexer("i")).WriteTo(&buf)
+	b := buf.Bytes()
+	b[5] = formatMajor + 1
+
+	var f Frame
+	if _, err := f.ReadFrom(bytes.NewReader(b)); err == nil {
+		t.Errorf("ReadFrom succeeded for newer major version; want error")
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/godata/row"
+)
+
+// ErrDuplicateKey is returned when data cannot be added to a Frame because a
+// row with the same index already exists.
+type ErrDuplicateKey struct {
+	// Index is the index shared by the rows.
+	Index row.Index
+
+	// Existing contains the row that is already in the Frame.
+	Existing row.Data
+
+	// Data contains the row that could not be added.
+	Data row.Data
+}
+
+// Error returns the string representation of the error.
+func (e *ErrDuplicateKey) Error() string {
+	return fmt.Sprintf("duplicate key %v: %v conflicts with %v", e.Index, e.Data, e.Existing)
+}
+
+// ErrMissingKey is returned when a row is expected to exist for an index, but
+// the Frame contains no such row.
+type ErrMissingKey struct {
+	// Index is the index that does not exist.
+	Index row.Index
+}
+
+// Error returns the string representation of the error.
+func (e *ErrMissingKey) Error() string {
+	return fmt.Sprintf("missing key %v", e.Index)
+}
+
+// ErrCollisions lists every row that could not be added to a Frame because an
+// earlier row has the same index. See ReportCollisions.
+type ErrCollisions []*ErrDuplicateKey
+
+// Error returns the string representation of the error.
+func (e ErrCollisions) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%d collisions, first: %v", len(e), e[0])
+}
+
+// ErrRow describes a row that could not be added to a Frame.
+type ErrRow struct {
+	// Position is the position of the row in the input.
+	Position int
+
+	// Data contains the row that could not be added.
+	Data row.Data
+
+	// Err is the reason the row could not be added.
+	Err error
+}
+
+// Error returns the string representation of the error.
+func (e *ErrRow) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Position, e.Err)
+}
+
+// ErrRows lists every row of an input that could not be added to a Frame. See
+// PutAll.
+type ErrRows []*ErrRow
+
+// Error returns the string representation of the error.
+func (e ErrRows) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%d rows failed, first: %v", len(e), e[0])
+}
+
+// ErrReadOnly is returned when modifying a Frame returned by Snapshot.
+var ErrReadOnly = errors.New("godata: Frame is a read-only snapshot")
+
+// ErrConflict is returned when committing a Txn that touched rows which were
+// changed in the Frame after the Txn began.
+var ErrConflict = errors.New("godata: transaction conflicts with a concurrent change")
+
+// ErrTxnDone is returned when using a Txn that was committed or rolled back.
+var ErrTxnDone = errors.New("godata: transaction has already been committed or rolled back")
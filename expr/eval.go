@@ -0,0 +1,239 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// node is a type checked expression.
+type node interface {
+	typ() Type
+	eval(data row.Data) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (l *literal) typ() Type {
+	return TypeOf(l.value)
+}
+
+func (l *literal) eval(row.Data) (interface{}, error) {
+	return l.value, nil
+}
+
+type column struct {
+	name string
+	t    Type
+}
+
+func (c *column) typ() Type {
+	return c.t
+}
+
+func (c *column) eval(data row.Data) (interface{}, error) {
+	return data[c.name], nil
+}
+
+type unary struct {
+	op string
+	x  node
+	t  Type
+}
+
+func (u *unary) typ() Type {
+	return u.t
+}
+
+func (u *unary) eval(data row.Data) (interface{}, error) {
+	x, err := u.x.eval(data)
+	if err != nil || x == nil {
+		return nil, err
+	}
+	switch x := value.Normalize(x).(type) {
+	case bool:
+		if u.op == "!" {
+			return !x, nil
+		}
+	case int:
+		if u.op == "-" {
+			return -x, nil
+		}
+	case float64:
+		if u.op == "-" {
+			return -x, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid operation: %s%T", u.op, x)
+}
+
+type binary struct {
+	op   string
+	x, y node
+	t    Type
+}
+
+func (b *binary) typ() Type {
+	return b.t
+}
+
+func (b *binary) eval(data row.Data) (interface{}, error) {
+	if b.op == "&&" || b.op == "||" {
+		// The result is nil unless the operands that are not nil decide it.
+		decisive := b.op == "||"
+		x, err := truth(b.x, data)
+		if err != nil || x == decisive {
+			return x, err
+		}
+		y, err := truth(b.y, data)
+		if err != nil || y == decisive {
+			return y, err
+		}
+		if x == nil || y == nil {
+			return nil, nil
+		}
+		return !decisive, nil
+	}
+
+	x, err := b.x.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	y, err := b.y.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	if b.op == "==" || b.op == "!=" {
+		if x == nil || y == nil {
+			return (x == nil && y == nil) == (b.op == "=="), nil
+		}
+		cmp, err := value.Compare(x, y)
+		return (cmp == 0) == (b.op == "=="), err
+	}
+	if x == nil || y == nil {
+		return nil, nil
+	}
+	switch b.op {
+	case "<", "<=", ">", ">=":
+		cmp, err := Compare(x, y)
+		if err != nil {
+			return nil, err
+		}
+		switch b.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		}
+		return cmp >= 0, nil
+	case "+":
+		if s, ok := x.(string); ok {
+			if t, ok := y.(string); ok {
+				return s + t, nil
+			}
+		}
+	}
+	return arith(b.op, x, y)
+}
+
+// truth evaluates a boolean node, returning nil if it is nil.
+func truth(n node, data row.Data) (interface{}, error) {
+	v, err := n.eval(data)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	if _, ok := v.(bool); !ok {
+		return nil, fmt.Errorf("%v of type %T is not a bool", v, v)
+	}
+	return v, nil
+}
+
+type call struct {
+	name string
+	fn   *function
+	args []node
+	t    Type
+}
+
+func (c *call) typ() Type {
+	return c.t
+}
+
+func (c *call) eval(data row.Data) (interface{}, error) {
+	args := make([]interface{}, len(c.args))
+	for i, arg := range c.args {
+		v, err := arg.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil && !c.fn.nullable {
+			return nil, nil
+		}
+		v = value.Normalize(v)
+		if t := TypeOf(v); !accepts(c.fn.param(i), t) || t == Any && c.fn.param(i) != Any {
+			return nil, fmt.Errorf("argument %d of %s is %T, not %v", i+1, c.name, v, c.fn.param(i))
+		}
+		args[i] = v
+	}
+	return c.fn.call(args)
+}
+
+// arith applies an arithmetic operator. Operations on ints return an int, and
+// operations involving a float64 return a float64.
+func arith(op string, x, y interface{}) (interface{}, error) {
+	x, y = value.Normalize(x), value.Normalize(y)
+	if a, ok := x.(int); ok {
+		if b, ok := y.(int); ok {
+			switch op {
+			case "+":
+				return a + b, nil
+			case "-":
+				return a - b, nil
+			case "*":
+				return a * b, nil
+			}
+			if b == 0 {
+				return nil, fmt.Errorf("integer division by zero")
+			}
+			if op == "/" {
+				return a / b, nil
+			}
+			return a % b, nil
+		}
+	}
+	a, aok := value.ToFloat(x)
+	b, bok := value.ToFloat(y)
+	if !aok || !bok {
+		return nil, fmt.Errorf("invalid operation: %T %s %T", x, op, y)
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		return a / b, nil
+	}
+	return math.Mod(a, b), nil
+}
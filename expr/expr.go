@@ -0,0 +1,246 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package expr compiles expressions over the columns of a row, such as
+//
+//	price * qty > 100 && region == "EU"
+//
+// into Predicates and RowActions for Frame operations like Filter and
+// WithColumn.
+//
+// The syntax follows Go. Operands are column names, integer and floating
+// point numbers, "interpreted" and `raw` strings, true, false, nil, and calls
+// of the functions below. The operators, by decreasing precedence, are
+//
+//	unary - and !
+//	*  /  %
+//	+  -          (+ also concatenates strings)
+//	==  !=  <  <=  >  >=
+//	&&
+//	||
+//
+// The functions are
+//
+//	len(s)                 the number of characters of the string
+//	lower(s), upper(s)     the string in lower or upper case
+//	trim(s)                the string without leading and trailing spaces
+//	contains(s, sub)       true if the string contains sub
+//	hasPrefix(s, prefix)   true if the string starts with prefix
+//	hasSuffix(s, suffix)   true if the string ends with suffix
+//	replace(s, old, new)   the string with every old replaced by new
+//	substr(s, start, n)    n characters of the string from the start character
+//	abs(x)                 the absolute value of the number
+//	int(x), float(x)       the number, boolean or string converted to int or float64
+//	string(x)              the value formatted as a string
+//	isnull(x)              true if the value is nil
+//	coalesce(x, ...)       the first argument that is not nil
+//
+// Missing columns and nil values are nil. Integers of every size are computed
+// as int, and mixed with floating point numbers as float64. Arithmetic,
+// ordering comparisons and functions other than isnull and coalesce are nil
+// if an argument is nil, while == and != compare nil like any other value.
+// Logic is three-valued: a && b is false if either operand is false, a || b
+// is true if either operand is true, and both are otherwise nil if an operand
+// is nil. Predicates are false for nil.
+//
+// Expressions are type checked when compiled against a Schema, which may be
+// derived from a Frame by SchemaOf. Values are checked again when evaluated,
+// since the columns of a Frame are not typed.
+package expr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+)
+
+// Type is the type of a column or expression.
+type Type int
+
+const (
+	// Any is the type of columns whose values have different or unsupported
+	// types, and of expressions whose type is only known when evaluated.
+	Any Type = iota
+	Null
+	Bool
+	Int
+	Float
+	String
+	Time
+)
+
+var typeNames = []string{"any", "nil", "bool", "int", "float", "string", "time"}
+
+func (t Type) String() string {
+	if t < 0 || int(t) >= len(typeNames) {
+		return fmt.Sprintf("Type(%d)", int(t))
+	}
+	return typeNames[t]
+}
+
+// numeric returns true if values of the type may be numbers.
+func (t Type) numeric() bool {
+	return t == Int || t == Float || t == Any || t == Null
+}
+
+// TypeOf returns the Type of a value. Integers of every size are Int, and
+// floating point numbers are Float.
+func TypeOf(v interface{}) Type {
+	switch v.(type) {
+	case nil:
+		return Null
+	case bool:
+		return Bool
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return Int
+	case float32, float64:
+		return Float
+	case string:
+		return String
+	case time.Time:
+		return Time
+	}
+	return Any
+}
+
+// Schema maps column names to their types. Compiling an expression against a
+// nil Schema gives every column the type Any.
+type Schema map[string]Type
+
+// SchemaOf returns the Schema of the Frame, which contains every column of its
+// rows. Columns with both integer and floating point values have type Float,
+// and columns whose values otherwise have different types have type Any.
+func SchemaOf(f *godata.Frame) Schema {
+	s := make(Schema)
+	f.ForEach(func(data row.Data) error {
+		for col, v := range data {
+			s.add(col, TypeOf(v))
+		}
+		return nil
+	})
+	return s
+}
+
+// add adds a value of the type to the column.
+func (s Schema) add(col string, t Type) {
+	old, ok := s[col]
+	switch {
+	case !ok || old == Null:
+		s[col] = t
+	case t == Null || t == old:
+	case t.numeric() && old.numeric() && t != Any && old != Any:
+		s[col] = Float
+	default:
+		s[col] = Any
+	}
+}
+
+// ErrSyntax is returned for expressions that cannot be parsed.
+type ErrSyntax struct {
+	// Offset is the byte offset of the error in the expression.
+	Offset int
+
+	// Msg describes the error.
+	Msg string
+}
+
+func (e *ErrSyntax) Error() string {
+	return fmt.Sprintf("expr: syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// ErrType is returned for expressions that do not type check.
+type ErrType struct {
+	// Offset is the byte offset of the ill-typed subexpression.
+	Offset int
+
+	// Msg describes the error.
+	Msg string
+}
+
+func (e *ErrType) Error() string {
+	return fmt.Sprintf("expr: type error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// Expr is a compiled expression. An Expr may be evaluated concurrently.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses the expression and type checks it against the Schema.
+// Returns an *ErrSyntax or *ErrType if the expression is invalid.
+func Compile(src string, schema Schema) (*Expr, error) {
+	root, err := parse(src, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// MustCompile is like Compile, but panics if the expression is invalid.
+func MustCompile(src string, schema Schema) *Expr {
+	e, err := Compile(src, schema)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Type returns the type of the expression.
+func (e *Expr) Type() Type {
+	return e.root.typ()
+}
+
+// Eval evaluates the expression for the row. Returns error if a value has an
+// unexpected type.
+func (e *Expr) Eval(data row.Data) (interface{}, error) {
+	v, err := e.root.eval(data)
+	if err != nil {
+		return nil, fmt.Errorf("expr: %s: %v", e.src, err)
+	}
+	return v, nil
+}
+
+// RowAction returns a RowAction that evaluates the expression, for example to
+// compute a column with Frame.WithColumn.
+func (e *Expr) RowAction() godata.RowAction {
+	return e.Eval
+}
+
+// Predicate returns a Predicate that is true for the rows for which the
+// expression is true. Returns an *ErrType if the expression is not boolean.
+func (e *Expr) Predicate() (godata.Predicate, error) {
+	switch t := e.Type(); t {
+	case Bool, Any, Null:
+	default:
+		return nil, &ErrType{0, fmt.Sprintf("%s is %v, not bool", e.src, t)}
+	}
+	return func(data row.Data) (bool, error) {
+		v, err := e.Eval(data)
+		if err != nil || v == nil {
+			return false, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return false, fmt.Errorf("expr: %s: %v of type %T is not a bool", e.src, v, v)
+		}
+		return b, nil
+	}, nil
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+)
+
+// testFrame returns a Frame of orders indexed by id.
+func testFrame() *godata.Frame {
+	f := godata.NewFrame(row.NewColumnIndexer("id"))
+	f.Put(row.Of("id", 1, "price", 10.0, "qty", 20, "region", "EU", "name", " Ann "))
+	f.Put(row.Of("id", 2, "price", 99.5, "qty", int32(1), "region", "US", "name", "bob"))
+	f.Put(row.Of("id", 3, "price", 5, "qty", 30, "region", "EU"))
+	f.Put(row.Of("id", 4, "price", 2.5, "region", nil, "name", "Dan", "misc", "x"))
+	f.Put(row.Of("id", 5, "price", 1.0, "qty", 1, "misc", 1))
+	return f
+}
+
+func TestSchemaOf(t *testing.T) {
+	got := SchemaOf(testFrame())
+	want := Schema{"id": Int, "price": Float, "qty": Int, "region": String, "name": String, "misc": Any}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaOf = %v; want %v", got, want)
+	}
+}
+
+func TestEval(t *testing.T) {
+	data := row.Of("i", 7, "j", int64(2), "f", 1.5, "s", "Hello", "b", true, "n", nil)
+	tests := []struct {
+		src  string
+		want interface{}
+		typ  Type
+	}{
+		{"i / j * 2 + i % j", 7, Int},
+		{"-i + f", -5.5, Float},
+		{"i / 2.0", 3.5, Float},
+		{"0x10 + 1e1", 26.0, Float},
+		{"s + \" \" + `world`", "Hello world", String},
+		{"i > j && s == \"Hello\"", true, Bool},
+		{"!b || i < 0", false, Bool},
+		{"i == 7.0", true, Bool},
+		{"n == nil", true, Bool},
+		{"missing != nil", false, Bool},
+		{"i + n", nil, Any},
+		{"n > 1", nil, Bool},
+		{"n > 1 && false", false, Bool},
+		{"n > 1 || true", true, Bool},
+		{"n > 1 || false", nil, Bool},
+		{"len(s) + len(\"日本\")", 7, Int},
+		{"upper(s) + lower(s)", "HELLOhello", String},
+		{"trim(\"  x \")", "x", String},
+		{"contains(s, \"ell\") && hasPrefix(s, \"He\") && !hasSuffix(s, \"x\")", true, Bool},
+		{"replace(s, \"l\", \"L\")", "HeLLo", String},
+		{"substr(s, 1, 3) + substr(s, 4, 10) + substr(s, 9, 1)", "ello", String},
+		{"abs(-i) + abs(-f)", 8.5, Float},
+		{"int(f) + int(\"12\") + int(b)", 14, Int},
+		{"float(\" 2.5 \") * 2", 5.0, Float},
+		{"string(i) + string(f)", "71.5", String},
+		{"isnull(n) && !isnull(i)", true, Bool},
+		{"coalesce(n, missing, j)", 2, Int},
+		{"coalesce(n, missing)", nil, Null},
+		{"upper(n)", nil, String},
+	}
+	schema := Schema{"i": Int, "j": Int, "f": Float, "s": String, "b": Bool, "n": Null, "missing": Null}
+	for _, test := range tests {
+		e, err := Compile(test.src, schema)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", test.src, err)
+			continue
+		}
+		if e.Type() != test.typ {
+			t.Errorf("Compile(%q).Type() = %v; want %v", test.src, e.Type(), test.typ)
+		}
+		got, err := e.Eval(data)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Compile(%q).Eval = %v (%T), %v; want %v (%T)", test.src, got, got, err, test.want, test.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	schema := Schema{"i": Int, "s": String, "b": Bool, "a": Any}
+	tests := map[string]bool{
+		"i +":          false,
+		"(i":           false,
+		"i i":          false,
+		"\"abc":        false,
+		"\"\\q\"":      false,
+		"i # 2":        false,
+		"nope(i)":      false,
+		"1.2.3":        false,
+		"missing > 1":  true,
+		"i + s":        true,
+		"s - s":        true,
+		"i && b":       true,
+		"!i":           true,
+		"-s":           true,
+		"s == 1":       true,
+		"b < b":        true,
+		"len(i)":       true,
+		"len(s, s)":    true,
+		"substr(s, 1)": true,
+		"abs(s)":       true,
+		"coalesce()":   true,
+	}
+	for src, typeError := range tests {
+		_, err := Compile(src, schema)
+		switch err.(type) {
+		case *ErrType:
+			if !typeError {
+				t.Errorf("Compile(%q) = %v; want syntax error", src, err)
+			}
+		case *ErrSyntax:
+			if typeError {
+				t.Errorf("Compile(%q) = %v; want type error", src, err)
+			}
+		default:
+			t.Errorf("Compile(%q) = %v; want error", src, err)
+		}
+	}
+
+	// Values of columns of type Any are checked when evaluated.
+	if _, err := Compile("a + 1 > i && a", schema); err != nil {
+		t.Errorf("Compile failed for column of type any: %v", err)
+	}
+	e := MustCompile("a + 1", schema)
+	if _, err := e.Eval(row.Of("a", "x")); err == nil {
+		t.Errorf("Eval(a + 1) succeeded for a string; want error")
+	}
+	e = MustCompile("len(a)", nil)
+	if _, err := e.Eval(row.Of("a", 1)); err == nil {
+		t.Errorf("Eval(len(a)) succeeded for an int; want error")
+	}
+	if _, err := MustCompile("i / 0", nil).Eval(row.Of("i", 1)); err == nil {
+		t.Errorf("Eval(i / 0) succeeded; want error")
+	}
+	for _, src := range []string{"a < b", "b < a", "a >= b"} {
+		if _, err := MustCompile(src, nil).Eval(row.Of("a", true, "b", false)); err == nil {
+			t.Errorf("Eval(%s) succeeded for bools; want error", src)
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+	f := testFrame()
+	schema := SchemaOf(f)
+
+	e := MustCompile(`price * qty > 100 && region == "EU"`, schema)
+	pred, err := e.Predicate()
+	if err != nil {
+		t.Fatalf("Predicate: %v", err)
+	}
+	nf, err := f.Filter(pred)
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+	got, _ := nf.GetRange()
+	if len(got) != 2 || got[0]["id"] != 1 || got[1]["id"] != 3 {
+		t.Errorf("Filter = %v; want rows 1 and 3", got)
+	}
+
+	if _, err := MustCompile("price * 2", schema).Predicate(); err == nil {
+		t.Errorf("Predicate succeeded for a float expression; want error")
+	}
+
+	nf, err = f.WithColumn("label", MustCompile(`lower(trim(name)) + ":" + coalesce(region, "?")`, schema).RowAction())
+	if err != nil {
+		t.Fatalf("WithColumn: %v", err)
+	}
+	var labels []interface{}
+	nf.ForEach(func(data row.Data) error {
+		labels = append(labels, data["label"])
+		return nil
+	})
+	if want := []interface{}{"ann:EU", "bob:US", nil, "dan:?", nil}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels = %v; want %v", labels, want)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	e := MustCompile(`(a > 1 || b) && 10 >= id && !(s == "x") && len(s) < n * (2 + m)`, nil)
+	if got, want := e.Columns(), []string{"a", "b", "id", "m", "n", "s"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Columns = %v; want %v", got, want)
+	}
+	var conjuncts []string
+	for _, c := range e.Conjuncts() {
+		conjuncts = append(conjuncts, c.String())
+	}
+	want := []string{"a > 1 || b", "10 >= id", `!(s == "x")`, "len(s) < n * (2 + m)"}
+	if !reflect.DeepEqual(conjuncts, want) {
+		t.Errorf("Conjuncts = %q; want %q", conjuncts, want)
+	}
+	if col, op, v, ok := e.Conjuncts()[1].Comparison(); !ok || col != "id" || op != "<=" || v != 10 {
+		t.Errorf("Comparison = %v, %v, %v, %v; want id, <=, 10, true", col, op, v, ok)
+	}
+	for _, src := range []string{"a", "a == nil", "a + 1 > 2", "a == b"} {
+		if _, _, _, ok := MustCompile(src, nil).Comparison(); ok {
+			t.Errorf("Comparison(%q) succeeded; want false", src)
+		}
+	}
+
+	if cmp, err := Compare(int32(2), 1.5); err != nil || cmp != 1 {
+		t.Errorf("Compare(2, 1.5) = %v, %v; want 1", cmp, err)
+	}
+	if _, err := Compare(true, false); err == nil {
+		t.Errorf("Compare(true, false) succeeded; want error")
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// function is a function that may be called by expressions.
+type function struct {
+	// params are the types of the parameters. Float parameters accept ints,
+	// and Any parameters accept every type.
+	params []Type
+
+	// variadic is true if the last parameter may be repeated.
+	variadic bool
+
+	// nullable is true if the function is called with nil arguments. Other
+	// functions return nil if an argument is nil.
+	nullable bool
+
+	// result returns the type of the result for the types of the arguments.
+	result func(args []Type) Type
+
+	// call calls the function with arguments of the parameter types, with
+	// numbers normalized to int and float64.
+	call func(args []interface{}) (interface{}, error)
+}
+
+// param returns the type of the ith parameter.
+func (f *function) param(i int) Type {
+	if i >= len(f.params) {
+		return f.params[len(f.params)-1]
+	}
+	return f.params[i]
+}
+
+// accepts returns true if an argument of the type may be passed for the
+// parameter type.
+func accepts(param, arg Type) bool {
+	return param == Any || arg == Any || arg == Null || arg == param || param == Float && arg == Int
+}
+
+// returns returns a result function for functions that return the type.
+func returns(t Type) func([]Type) Type {
+	return func([]Type) Type { return t }
+}
+
+// stringFunc returns a function of strings.
+func stringFunc(result Type, fn func(args []string) interface{}, params int) *function {
+	f := &function{result: returns(result)}
+	for i := 0; i < params; i++ {
+		f.params = append(f.params, String)
+	}
+	f.call = func(args []interface{}) (interface{}, error) {
+		s := make([]string, len(args))
+		for i, arg := range args {
+			s[i] = arg.(string)
+		}
+		return fn(s), nil
+	}
+	return f
+}
+
+// functions are the functions that may be called by expressions, by name.
+var functions = map[string]*function{
+	"len": stringFunc(Int, func(s []string) interface{} {
+		return utf8.RuneCountInString(s[0])
+	}, 1),
+	"lower": stringFunc(String, func(s []string) interface{} {
+		return strings.ToLower(s[0])
+	}, 1),
+	"upper": stringFunc(String, func(s []string) interface{} {
+		return strings.ToUpper(s[0])
+	}, 1),
+	"trim": stringFunc(String, func(s []string) interface{} {
+		return strings.TrimSpace(s[0])
+	}, 1),
+	"contains": stringFunc(Bool, func(s []string) interface{} {
+		return strings.Contains(s[0], s[1])
+	}, 2),
+	"hasPrefix": stringFunc(Bool, func(s []string) interface{} {
+		return strings.HasPrefix(s[0], s[1])
+	}, 2),
+	"hasSuffix": stringFunc(Bool, func(s []string) interface{} {
+		return strings.HasSuffix(s[0], s[1])
+	}, 2),
+	"replace": stringFunc(String, func(s []string) interface{} {
+		return strings.ReplaceAll(s[0], s[1], s[2])
+	}, 3),
+	"substr": {
+		params: []Type{String, Int, Int},
+		result: returns(String),
+		call:   substr,
+	},
+	"abs": {
+		params: []Type{Float},
+		result: func(args []Type) Type {
+			if args[0] == Int || args[0] == Float {
+				return args[0]
+			}
+			return Any
+		},
+		call: func(args []interface{}) (interface{}, error) {
+			if i, ok := args[0].(int); ok {
+				if i < 0 {
+					return -i, nil
+				}
+				return i, nil
+			}
+			return math.Abs(args[0].(float64)), nil
+		},
+	},
+	"int": {
+		params: []Type{Any},
+		result: returns(Int),
+		call:   toInt,
+	},
+	"float": {
+		params: []Type{Any},
+		result: returns(Float),
+		call:   toFloat64,
+	},
+	"string": {
+		params: []Type{Any},
+		result: returns(String),
+		call: func(args []interface{}) (interface{}, error) {
+			return fmt.Sprint(args[0]), nil
+		},
+	},
+	"isnull": {
+		params:   []Type{Any},
+		nullable: true,
+		result:   returns(Bool),
+		call: func(args []interface{}) (interface{}, error) {
+			return args[0] == nil, nil
+		},
+	},
+	"coalesce": {
+		params:   []Type{Any},
+		variadic: true,
+		nullable: true,
+		result: func(args []Type) Type {
+			t := Null
+			for _, arg := range args {
+				switch {
+				case arg == Null || arg == t:
+				case t == Null:
+					t = arg
+				default:
+					return Any
+				}
+			}
+			return t
+		},
+		call: func(args []interface{}) (interface{}, error) {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		},
+	},
+}
+
+// substr returns n characters of the string from the start character, both
+// limited to the length of the string.
+func substr(args []interface{}) (interface{}, error) {
+	r := []rune(args[0].(string))
+	start, n := args[1].(int), args[2].(int)
+	if start < 0 || n < 0 {
+		return nil, fmt.Errorf("substr: negative start %d or length %d", start, n)
+	}
+	if start > len(r) {
+		start = len(r)
+	}
+	if n > len(r)-start {
+		n = len(r) - start
+	}
+	return string(r[start : start+n]), nil
+}
+
+// toInt converts a number, boolean or string to an int. Floating point numbers
+// are truncated.
+func toInt(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case int:
+		return v, nil
+	case float64:
+		if math.IsNaN(v) || math.Abs(v) >= math.MaxInt {
+			return nil, fmt.Errorf("int: %v out of range", v)
+		}
+		return int(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("int: %v", err)
+		}
+		return int(i), nil
+	}
+	return nil, fmt.Errorf("int: cannot convert %T", args[0])
+}
+
+// toFloat64 converts a number, boolean or string to a float64.
+func toFloat64(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("float: %v", err)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("float: cannot convert %T", args[0])
+}
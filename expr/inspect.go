@@ -0,0 +1,169 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/godata/internal/value"
+)
+
+// Columns returns the sorted names of the columns the expression refers to.
+func (e *Expr) Columns() []string {
+	seen := make(map[string]bool)
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case *column:
+			seen[n.name] = true
+		case *unary:
+			walk(n.x)
+		case *binary:
+			walk(n.x)
+			walk(n.y)
+		case *call:
+			for _, arg := range n.args {
+				walk(arg)
+			}
+		}
+	}
+	walk(e.root)
+	cols := make([]string, 0, len(seen))
+	for col := range seen {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// Conjuncts splits the expression into the operands of its top level &&
+// operators, so that the expression is true if and only if every conjunct is
+// true. An expression that is not a conjunction is its only conjunct.
+func (e *Expr) Conjuncts() []*Expr {
+	b, ok := e.root.(*binary)
+	if !ok || b.op != "&&" {
+		return []*Expr{e}
+	}
+	var conjuncts []*Expr
+	var split func(n node)
+	split = func(n node) {
+		if b, ok := n.(*binary); ok && b.op == "&&" {
+			split(b.x)
+			split(b.y)
+			return
+		}
+		conjuncts = append(conjuncts, &Expr{src: format(n, 0), root: n})
+	}
+	split(b)
+	return conjuncts
+}
+
+// flipped maps comparison operators to the operators comparing the operands
+// in the other order.
+var flipped = map[string]string{
+	"==": "==", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<=",
+}
+
+// Comparison returns the column, operator and value of an expression that
+// compares a column with a value other than nil, such as id >= 10. The
+// operator is one of ==, !=, <, <=, > and >=, and is reversed if the value is
+// the left operand. Returns false for other expressions.
+func (e *Expr) Comparison() (col string, op string, value interface{}, ok bool) {
+	b, isBinary := e.root.(*binary)
+	if !isBinary || flipped[b.op] == "" {
+		return "", "", nil, false
+	}
+	x, xok := b.x.(*column)
+	y, yok := b.y.(*literal)
+	if xok && yok && y.value != nil {
+		return x.name, b.op, y.value, true
+	}
+	if l, lok := b.x.(*literal); lok && l.value != nil {
+		if c, cok := b.y.(*column); cok {
+			return c.name, flipped[b.op], l.value, true
+		}
+	}
+	return "", "", nil, false
+}
+
+// Compare returns -1, 0 or 1 if x is less than, equal to or greater than y, as
+// compared by the ordering operators. Numbers of different types are compared
+// exactly by value, and NaN is equal to itself and less than every other
+// number. Returns error if the values cannot be ordered.
+func Compare(x, y interface{}) (int, error) {
+	if _, ok := x.(bool); ok {
+		if _, ok := y.(bool); ok {
+			return 0, fmt.Errorf("cannot order %T", x)
+		}
+	}
+	return value.Compare(x, y)
+}
+
+// precedence returns the precedence of a binary operator, from 1 for || to 5
+// for the multiplicative operators.
+func precedence(op string) int {
+	switch op {
+	case "||":
+		return 1
+	case "&&":
+		return 2
+	case "==", "!=", "<", "<=", ">", ">=":
+		return 3
+	case "+", "-":
+		return 4
+	}
+	return 5
+}
+
+// format formats the node as source, parenthesizing it if its operator binds
+// less tightly than the given precedence.
+func format(n node, prec int) string {
+	switch n := n.(type) {
+	case *literal:
+		switch v := n.value.(type) {
+		case nil:
+			return "nil"
+		case string:
+			return strconv.Quote(v)
+		case float64:
+			s := strconv.FormatFloat(v, 'g', -1, 64)
+			if !strings.ContainsAny(s, ".eIN") {
+				s += ".0"
+			}
+			return s
+		}
+		return fmt.Sprint(n.value)
+	case *column:
+		return n.name
+	case *unary:
+		return n.op + format(n.x, 6)
+	case *binary:
+		p := precedence(n.op)
+		s := format(n.x, p) + " " + n.op + " " + format(n.y, p+1)
+		if p < prec {
+			return "(" + s + ")"
+		}
+		return s
+	case *call:
+		args := make([]string, len(n.args))
+		for i, arg := range n.args {
+			args[i] = format(arg, 0)
+		}
+		return n.name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return fmt.Sprint(n)
+}
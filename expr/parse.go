@@ -0,0 +1,351 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+// token is a lexical token. The text of strings is unquoted.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators are the operator tokens, longest first.
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// lex splits the expression into tokens, ending with a tokEOF token.
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isLetter(c):
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		case isDigit(c) || c == '.' && i+1 < len(src) && isDigit(src[i+1]):
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i]) || src[i] == '.' ||
+				(src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E')) {
+				i++
+			}
+			toks = append(toks, token{tokNumber, src[start:i], start})
+		case c == '"' || c == '`':
+			for i++; i < len(src) && src[i] != c; i++ {
+				if c == '"' && src[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(src) {
+				return nil, &ErrSyntax{start, "unterminated string"}
+			}
+			i++
+			s, err := strconv.Unquote(src[start:i])
+			if err != nil {
+				return nil, &ErrSyntax{start, fmt.Sprintf("invalid string %s", src[start:i])}
+			}
+			toks = append(toks, token{tokString, s, start})
+		default:
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					i += len(op)
+					toks = append(toks, token{tokOp, op, start})
+					break
+				}
+			}
+			if i == start {
+				return nil, &ErrSyntax{start, fmt.Sprintf("unexpected character %q", c)}
+			}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+// parser parses and type checks a token stream. Errors are raised by
+// panicking with an *ErrSyntax or *ErrType, which parse recovers.
+type parser struct {
+	toks   []token
+	i      int
+	schema Schema
+}
+
+// parse parses and type checks the expression.
+func parse(src string, schema Schema) (n node, err error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, schema: schema}
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case *ErrSyntax:
+				n, err = nil, e
+			case *ErrType:
+				n, err = nil, e
+			default:
+				panic(r)
+			}
+		}
+	}()
+	n = p.parseOr()
+	if t := p.peek(); t.kind != tokEOF {
+		p.syntaxError(t, "unexpected %q", t.text)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) syntaxError(t token, format string, args ...interface{}) {
+	panic(&ErrSyntax{t.pos, fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) typeError(t token, format string, args ...interface{}) {
+	panic(&ErrType{t.pos, fmt.Sprintf(format, args...)})
+}
+
+// op consumes the next token if it is one of the operators, and returns it.
+func (p *parser) op(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind == tokOp {
+		for _, op := range ops {
+			if t.text == op {
+				p.i++
+				return t, true
+			}
+		}
+	}
+	return t, false
+}
+
+func (p *parser) expectOp(op string) {
+	if t, ok := p.op(op); !ok {
+		p.syntaxError(t, "expected %q", op)
+	}
+}
+
+// binaryLevel parses a left-associative sequence of operands joined by the
+// operators.
+func (p *parser) binaryLevel(operand func() node, ops ...string) node {
+	x := operand()
+	for {
+		t, ok := p.op(ops...)
+		if !ok {
+			return x
+		}
+		y := operand()
+		x = &binary{op: t.text, x: x, y: y, t: p.checkBinary(t, x.typ(), y.typ())}
+	}
+}
+
+func (p *parser) parseOr() node {
+	return p.binaryLevel(p.parseAnd, "||")
+}
+
+func (p *parser) parseAnd() node {
+	return p.binaryLevel(p.parseComparison, "&&")
+}
+
+func (p *parser) parseComparison() node {
+	return p.binaryLevel(p.parseAdditive, "==", "!=", "<", "<=", ">", ">=")
+}
+
+func (p *parser) parseAdditive() node {
+	return p.binaryLevel(p.parseMultiplicative, "+", "-")
+}
+
+func (p *parser) parseMultiplicative() node {
+	return p.binaryLevel(p.parseUnary, "*", "/", "%")
+}
+
+func (p *parser) parseUnary() node {
+	t, ok := p.op("-", "!")
+	if !ok {
+		return p.parsePrimary()
+	}
+	x := p.parseUnary()
+	u := &unary{op: t.text, x: x, t: Bool}
+	switch xt := x.typ(); {
+	case t.text == "!" && !boolean(xt):
+		p.typeError(t, "invalid operation: !%v", xt)
+	case t.text == "-" && !xt.numeric():
+		p.typeError(t, "invalid operation: -%v", xt)
+	case t.text == "-" && (xt == Int || xt == Float):
+		u.t = xt
+	case t.text == "-":
+		u.t = Any
+	}
+	return u
+}
+
+func (p *parser) parsePrimary() node {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		if n, err := strconv.ParseInt(t.text, 0, 0); err == nil {
+			return &literal{int(n)}
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.syntaxError(t, "invalid number %s", t.text)
+		}
+		return &literal{f}
+	case tokString:
+		return &literal{t.text}
+	case tokOp:
+		if t.text == "(" {
+			x := p.parseOr()
+			p.expectOp(")")
+			return x
+		}
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literal{true}
+		case "false":
+			return &literal{false}
+		case "nil":
+			return &literal{nil}
+		}
+		if _, ok := p.op("("); ok {
+			return p.parseCall(t)
+		}
+		c := &column{name: t.text}
+		if p.schema != nil {
+			typ, ok := p.schema[t.text]
+			if !ok {
+				p.typeError(t, "unknown column %q", t.text)
+			}
+			c.t = typ
+		}
+		return c
+	}
+	if t.kind == tokEOF {
+		p.syntaxError(t, "unexpected end of expression")
+	}
+	p.syntaxError(t, "unexpected %q", t.text)
+	return nil
+}
+
+// parseCall parses the arguments of a call of the function named by the token.
+func (p *parser) parseCall(t token) node {
+	fn, ok := functions[t.text]
+	if !ok {
+		p.syntaxError(t, "unknown function %s", t.text)
+	}
+	c := &call{name: t.text, fn: fn}
+	if _, ok := p.op(")"); !ok {
+		for {
+			c.args = append(c.args, p.parseOr())
+			if _, ok := p.op(","); !ok {
+				break
+			}
+		}
+		p.expectOp(")")
+	}
+
+	if len(c.args) < len(fn.params) || len(c.args) > len(fn.params) && !fn.variadic {
+		p.typeError(t, "%s takes %d arguments, not %d", t.text, len(fn.params), len(c.args))
+	}
+	types := make([]Type, len(c.args))
+	for i, arg := range c.args {
+		types[i] = arg.typ()
+		if !accepts(fn.param(i), types[i]) {
+			p.typeError(t, "argument %d of %s is %v, not %v", i+1, t.text, types[i], fn.param(i))
+		}
+	}
+	c.t = fn.result(types)
+	return c
+}
+
+// boolean returns true if values of the type may be booleans.
+func boolean(t Type) bool {
+	return t == Bool || t == Any || t == Null
+}
+
+// ordered returns true if values of the type may be ordered.
+func ordered(t Type) bool {
+	return t.numeric() || t == String || t == Time
+}
+
+// checkBinary returns the type of a binary operation on the operand types,
+// and raises an *ErrType if the operation is invalid.
+func (p *parser) checkBinary(t token, x, y Type) Type {
+	unknown := x == Any || y == Any || x == Null || y == Null
+	switch t.text {
+	case "&&", "||":
+		if boolean(x) && boolean(y) {
+			return Bool
+		}
+	case "==", "!=":
+		if unknown || x == y || x.numeric() && y.numeric() {
+			return Bool
+		}
+	case "<", "<=", ">", ">=":
+		if ordered(x) && ordered(y) && (unknown || x == y || x.numeric() && y.numeric()) {
+			return Bool
+		}
+	default:
+		switch {
+		case x == Int && y == Int:
+			return Int
+		case (x == Int || x == Float) && (y == Int || y == Float):
+			return Float
+		case t.text == "+" && (x == String && (y == String || unknown) || y == String && unknown):
+			return String
+		case x.numeric() && y.numeric():
+			return Any
+		}
+	}
+	p.typeError(t, "invalid operation: %v %s %v", x, t.text, y)
+	return Any
+}
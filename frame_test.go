@@ -14,8 +14,11 @@ limitations under the License.
 package godata
 
 import (
+	"fmt"
+	"math/rand"
 	"reflect"
 
+	"github.com/google/btree"
 	"github.com/google/godata/group"
 	"github.com/google/godata/row"
 
@@ -135,3 +138,391 @@ func TestGroupBy(t *testing.T) {
 	}
 
 }
+
+func TestGroupByKeys(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i1", "i2"))
+	f.Put(row.Of("i1", 0, "i2", 0, "v", "a"))
+	f.Put(row.Of("i1", 0, "i2", 1, "v", "b"))
+	f.Put(row.Of("i1", 1, "i2", 0, "v", "c"))
+
+	grouped, err := f.GroupBy(row.NewColumnIndexer("i1"), row.NewColumnIndexer("i2"))
+	if err != nil {
+		t.Fatalf("GroupBy: %v", err)
+	}
+	got, err := grouped.Get(row.Of("i1", 0))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got["i1"] != 0 {
+		t.Errorf("Get = %v; want key column i1 = 0", got)
+	}
+	subgroups := got[group.Column].(group.Group)
+	if len(subgroups) != 2 {
+		t.Fatalf("Group = %v; want 2 subgroups", subgroups)
+	}
+	want := row.Of("i2", 1, group.Column, group.New(row.Of("i1", 0, "i2", 1, "v", "b")))
+	if !reflect.DeepEqual(subgroups[1], want) {
+		t.Errorf("Group[1] = %v; want %v", subgroups[1], want)
+	}
+	if got, err := grouped.Get(row.Of("i1", 2)); got != nil || err != nil {
+		t.Errorf("Get(i1 = 2) = %v, %v; want no group", got, err)
+	}
+
+	// The rows of the groups are re-indexed by their key columns, since the
+	// first row of each group is a subgroup without them.
+	counted, err := grouped.WithColumn("n", group.Count().Action)
+	if err != nil {
+		t.Fatalf("WithColumn: %v", err)
+	}
+	if got, _ := counted.Get(row.Of("i1", 0)); got["n"] != 2 {
+		t.Errorf("Get(i1 = 0) after WithColumn = %v; want n = 2", got)
+	}
+}
+
+func TestAllowDuplicates(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("user"), AllowDuplicates())
+	f.Put(row.Of("user", 2, "event", "login"))
+	f.Put(row.Of("user", 1, "event", "login"))
+	f.Put(row.Of("user", 2, "event", "click"))
+	if old, err := f.Put(row.Of("user", 2, "event", "logout")); err != nil || old != nil {
+		t.Fatalf("Put = %v, %v; want nil, nil", old, err)
+	}
+
+	all, err := f.GetAll(row.Of("user", 2))
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	var events []interface{}
+	for _, r := range all {
+		events = append(events, r["event"])
+	}
+	if want := []interface{}{"login", "click", "logout"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("GetAll = %v; want %v", events, want)
+	}
+
+	got, err := f.Get(row.Of("user", 2))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got["event"] != "login" {
+		t.Errorf("Get = %v; want first row for key", got)
+	}
+
+	rows, err := f.GetRange(GreaterOrEqual(row.Of("user", 2)))
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Errorf("GetRange = %v; want 3 rows", rows)
+	}
+	rows, err = f.GetRange(LessThan(row.Of("user", 2)))
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("GetRange = %v; want 1 row", rows)
+	}
+
+	if got, _ := f.Pop(row.Of("user", 2)); got["event"] != "login" {
+		t.Errorf("Pop = %v; want first row for key", got)
+	}
+	if got, _ := f.PopAll(row.Of("user", 2)); len(got) != 2 {
+		t.Errorf("PopAll = %v; want 2 rows", got)
+	}
+	if got, _ := f.GetAll(row.Of("user", 2)); got != nil {
+		t.Errorf("GetAll after PopAll = %v; want nil", got)
+	}
+}
+
+func TestInsertAndUpdate(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	if err := f.Insert(row.Of("i", 1, "data", "foo")); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	err := f.Insert(row.Of("i", 1, "data", "bar"))
+	dup, ok := err.(*ErrDuplicateKey)
+	if !ok {
+		t.Fatalf("Insert = %v; want *ErrDuplicateKey", err)
+	}
+	if dup.Existing["data"] != "foo" || dup.Data["data"] != "bar" {
+		t.Errorf("Insert = %#v; want existing foo and data bar", dup)
+	}
+
+	old, err := f.Update(row.Of("i", 1, "data", "bar"))
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if old["data"] != "foo" {
+		t.Errorf("Update = %v; want data foo", old)
+	}
+	if got, _ := f.Get(row.Of("i", 1)); got["data"] != "bar" {
+		t.Errorf("Get after Update = %v; want data bar", got)
+	}
+
+	if _, err := f.Update(row.Of("i", 2, "data", "baz")); err == nil {
+		t.Errorf("Update of missing key succeeded; want error")
+	} else if _, ok := err.(*ErrMissingKey); !ok {
+		t.Errorf("Update = %v; want *ErrMissingKey", err)
+	}
+}
+
+func TestWithIndexerReportCollisions(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 0, "group", "a"))
+	f.Put(row.Of("i", 1, "group", "b"))
+	f.Put(row.Of("i", 2, "group", "a"))
+	f.Put(row.Of("i", 3, "group", "a"))
+
+	nf, err := f.WithIndexer(row.NewColumnIndexer("group"), ReportCollisions())
+	collisions, ok := err.(ErrCollisions)
+	if !ok {
+		t.Fatalf("WithIndexer = %v; want ErrCollisions", err)
+	}
+	if len(collisions) != 2 {
+		t.Fatalf("WithIndexer = %v; want 2 collisions", collisions)
+	}
+	for i, want := range []int{2, 3} {
+		if got := collisions[i].Data["i"]; got != want {
+			t.Errorf("collision %d has i = %v; want %d", i, got, want)
+		}
+	}
+	if got, _ := nf.Get(row.Of("group", "a")); got["i"] != 0 {
+		t.Errorf("Get = %v; want first row kept", got)
+	}
+}
+
+func TestFrameOptions(t *testing.T) {
+	freeList := btree.NewFreeList(btree.DefaultFreeListSize)
+	f1 := NewFrame(row.NewColumnIndexer("i"), Degree(2), SharedFreeList(freeList))
+	f2 := NewFrame(row.NewColumnIndexer("i"), Degree(64), SharedFreeList(freeList), SizeHint(1e5))
+	for i := 0; i < 100; i++ {
+		f1.Put(row.Of("i", i))
+		f2.Put(row.Of("i", i))
+	}
+	f1.PopRange()
+	for _, f := range []*Frame{f1, f2} {
+		if got, err := f.Get(row.Of("i", 50)); err != nil || (got == nil) != (f == f1) {
+			t.Errorf("Get = %v, %v", got, err)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Degree(1) did not panic")
+			}
+		}()
+		NewFrame(row.NewColumnIndexer("i"), Degree(1), SizeHint(1e5))
+	}()
+}
+
+func TestForEach(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	for i := 0; i < 10; i++ {
+		f.Put(row.Of("i", i))
+	}
+	if f.Len() != 10 {
+		t.Errorf("Len = %d; want 10", f.Len())
+	}
+	var got []interface{}
+	stop := fmt.Errorf("stop")
+	err := f.ForEach(func(data row.Data) error {
+		got = append(got, data["i"])
+		if data["i"] == 5 {
+			return stop
+		}
+		return nil
+	}, GreaterOrEqual(row.Of("i", 3)))
+	if err != stop || !reflect.DeepEqual(got, []interface{}{3, 4, 5}) {
+		t.Errorf("ForEach = %v, %v; want [3 4 5], stop", got, err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"), AllowDuplicates())
+	for i := 0; i < 10; i++ {
+		f.Put(row.Of("i", i%5, "j", i))
+	}
+	even := func(data row.Data) (bool, error) {
+		return data["j"].(int)%2 == 0, nil
+	}
+	nf, err := f.Filter(even, LessThan(row.Of("i", 3)))
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+	got, _ := nf.GetRange()
+	want := []row.Data{row.Of("i", 0, "j", 0), row.Of("i", 1, "j", 6), row.Of("i", 2, "j", 2)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter = %v; want %v", got, want)
+	}
+	// The filtered Frame keeps the options of the Frame.
+	nf.Put(row.Of("i", 0, "j", 10))
+	if rows, _ := nf.GetAll(row.Of("i", 0)); len(rows) != 2 || rows[1]["j"] != 10 {
+		t.Errorf("GetAll = %v; want rows 0 and 10", rows)
+	}
+	if f.Len() != 10 {
+		t.Errorf("Len = %d after Filter; want 10", f.Len())
+	}
+
+	stop := fmt.Errorf("stop")
+	if _, err := f.Filter(func(row.Data) (bool, error) { return false, stop }); err != stop {
+		t.Errorf("Filter = %v; want %v", err, stop)
+	}
+}
+
+func TestWithColumn(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	for i := 0; i < 5; i++ {
+		f.Put(row.Of("i", i, "j", i))
+	}
+	nf, err := f.WithColumn("i", func(data row.Data) (interface{}, error) {
+		return -data["j"].(int), nil
+	})
+	if err != nil {
+		t.Fatalf("WithColumn: %v", err)
+	}
+	if got, _ := nf.Get(row.Of("i", -4)); !reflect.DeepEqual(got, row.Of("i", -4, "j", 4)) {
+		t.Errorf("Get = %v; want row 4", got)
+	}
+	if got, _ := f.Get(row.Of("i", 4)); !reflect.DeepEqual(got, row.Of("i", 4, "j", 4)) {
+		t.Errorf("Get = %v; want unmodified row 4", got)
+	}
+
+	nf, err = f.WithColumn("j", func(row.Data) (interface{}, error) { return nil, nil })
+	if got, _ := nf.GetRange(); err != nil || len(got) != 5 || got[0]["j"] != nil {
+		t.Errorf("WithColumn = %v, %v; want rows without j", got, err)
+	}
+	if _, err := f.WithColumn("i", func(row.Data) (interface{}, error) { return 1.5, nil }); err == nil {
+		t.Errorf("WithColumn succeeded for invalid index; want error")
+	}
+}
+
+// benchmarkSizes are the Frame sizes used by the benchmarks.
+var benchmarkSizes = []int{1e4, 1e5, 1e6, 1e7}
+
+// benchmarkFrame returns a Frame with the given number of rows, indexed by a
+// unique column "i" and containing a column "g" with 100 distinct values.
+func benchmarkFrame(b *testing.B, rows int, args ...frameArg) *Frame {
+	data := make([]row.Data, rows)
+	for i := range data {
+		data[i] = row.Of("i", i, "g", i%100)
+	}
+	f := NewFrame(row.NewColumnIndexer("i"), args...)
+	if err := f.PutAll(data); err != nil {
+		b.Fatalf("PutAll: %v", err)
+	}
+	return f
+}
+
+// benchmarkBySize runs the benchmark against Frames of each benchmark size.
+func benchmarkBySize(b *testing.B, bench func(*testing.B, *Frame, int), args ...frameArg) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("rows=%d", size), func(b *testing.B) {
+			f := benchmarkFrame(b, size, args...)
+			b.ResetTimer()
+			bench(b, f, size)
+		})
+	}
+}
+
+func benchmarkPut(b *testing.B, f *Frame, size int) {
+	for n := 0; n < b.N; n++ {
+		i := rand.Intn(size)
+		if _, err := f.Put(row.Of("i", i, "g", i%100)); err != nil {
+			b.Fatalf("Put: %v", err)
+		}
+	}
+}
+
+func benchmarkGet(b *testing.B, f *Frame, size int) {
+	for n := 0; n < b.N; n++ {
+		if _, err := f.Get(row.Of("i", rand.Intn(size))); err != nil {
+			b.Fatalf("Get: %v", err)
+		}
+	}
+}
+
+func benchmarkGetRange(b *testing.B, f *Frame, size int) {
+	const width = 1000
+	for n := 0; n < b.N; n++ {
+		begin := rand.Intn(size - width)
+		if _, err := f.GetRange(GreaterOrEqual(row.Of("i", begin)), LessThan(row.Of("i", begin+width))); err != nil {
+			b.Fatalf("GetRange: %v", err)
+		}
+	}
+}
+
+func benchmarkGroupBy(b *testing.B, f *Frame, size int) {
+	for n := 0; n < b.N; n++ {
+		if _, err := f.GroupBy(row.NewColumnIndexer("g")); err != nil {
+			b.Fatalf("GroupBy: %v", err)
+		}
+	}
+}
+
+func BenchmarkPut(b *testing.B) {
+	benchmarkBySize(b, benchmarkPut)
+}
+
+// BenchmarkPutAll compares loading shuffled rows into an empty Frame with Put
+// and with PutAll.
+func BenchmarkPutAll(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		data := make([]row.Data, size)
+		for i, j := range rand.Perm(size) {
+			data[i] = row.Of("i", j, "g", j%100)
+		}
+		b.Run(fmt.Sprintf("rows=%d/Put", size), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				f := NewFrame(row.NewColumnIndexer("i"))
+				for _, d := range data {
+					if _, err := f.Put(d); err != nil {
+						b.Fatalf("Put: %v", err)
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("rows=%d/PutAll", size), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if err := NewFrame(row.NewColumnIndexer("i")).PutAll(data); err != nil {
+					b.Fatalf("PutAll: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchmarkBySize(b, benchmarkGet)
+}
+
+func BenchmarkGetRange(b *testing.B) {
+	benchmarkBySize(b, benchmarkGetRange)
+}
+
+func BenchmarkGroupBy(b *testing.B) {
+	benchmarkBySize(b, benchmarkGroupBy)
+}
+
+// BenchmarkDegree compares btree degrees for Frames of each benchmark size.
+func BenchmarkDegree(b *testing.B) {
+	benchmarks := []struct {
+		name  string
+		bench func(*testing.B, *Frame, int)
+	}{
+		{"Put", benchmarkPut},
+		{"Get", benchmarkGet},
+		{"GetRange", benchmarkGetRange},
+		{"GroupBy", benchmarkGroupBy},
+	}
+	for _, size := range benchmarkSizes {
+		for _, degree := range []int{2, 8, 16, 32, 64, 128} {
+			f := benchmarkFrame(b, size, Degree(degree))
+			for _, bm := range benchmarks {
+				b.Run(fmt.Sprintf("%s/rows=%d/degree=%d", bm.name, size, degree), func(b *testing.B) {
+					bm.bench(b, f, size)
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"fmt"
+
+	"github.com/google/godata/internal/value"
+	row "github.com/google/godata/row"
+)
+
+// Aggregate computes a value over the rows of a Group, such as the number of
+// rows or the total of a column.
+type Aggregate func(Group) (interface{}, error)
+
+// Action returns the aggregate of the Group in the Column of the row, so that
+// the aggregate may be added to a grouped Frame as a column by WithColumn, and
+// then filtered like any other column.
+func (a Aggregate) Action(data row.Data) (interface{}, error) {
+	col, ok := data[Column]
+	if !ok {
+		return nil, fmt.Errorf("row %v has no column %q", data, Column)
+	}
+	group, ok := col.(Group)
+	if !ok {
+		return nil, fmt.Errorf("Column %q containing %v is not a Group", Column, col)
+	}
+	return a(group)
+}
+
+// Count returns an Aggregate of the number of rows of a Group.
+func Count() Aggregate {
+	return func(g Group) (interface{}, error) {
+		return len(g), nil
+	}
+}
+
+// Sum returns an Aggregate of the total of the column, ignoring rows without
+// the column. Integers of any size are summed as ints, and the total is an int
+// if every value is an integer, and a float64 otherwise. Returns error if a
+// value is not a number.
+func Sum(column string) Aggregate {
+	return func(g Group) (interface{}, error) {
+		var (
+			sum   int
+			fsum  float64
+			float bool
+		)
+		for _, data := range g {
+			switch v := value.Normalize(data[column]).(type) {
+			case nil:
+			case int:
+				sum += v
+			case float64:
+				fsum += v
+				float = true
+			default:
+				return nil, fmt.Errorf("cannot sum %v of type %T in column %q", v, v, column)
+			}
+		}
+		if float {
+			return fsum + float64(sum), nil
+		}
+		return sum, nil
+	}
+}
+
+// Mean returns an Aggregate of the mean of the column as a float64, ignoring
+// rows without the column, or nil if no row has the column. Returns error if a
+// value is not a number.
+func Mean(column string) Aggregate {
+	return func(g Group) (interface{}, error) {
+		var (
+			sum float64
+			n   int
+		)
+		for _, data := range g {
+			v := data[column]
+			if v == nil {
+				continue
+			}
+			f, ok := value.ToFloat(value.Normalize(v))
+			if !ok {
+				return nil, fmt.Errorf("cannot average %v of type %T in column %q", v, v, column)
+			}
+			sum += f
+			n++
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		return sum / float64(n), nil
+	}
+}
+
+// Min returns an Aggregate of the least value of the column, ignoring rows
+// without the column, or nil if no row has the column. Values are compared by
+// Compare.
+func Min(column string) Aggregate {
+	return extreme(column, -1)
+}
+
+// Max returns an Aggregate of the greatest value of the column, ignoring rows
+// without the column, or nil if no row has the column. Values are compared by
+// Compare.
+func Max(column string) Aggregate {
+	return extreme(column, 1)
+}
+
+// extreme returns an Aggregate of the value of the column that compares with
+// the others as the sign.
+func extreme(column string, sign int) Aggregate {
+	return func(g Group) (interface{}, error) {
+		var best interface{}
+		for _, data := range g {
+			v := data[column]
+			if v == nil {
+				continue
+			}
+			if best == nil {
+				if _, err := Compare(v, v); err != nil {
+					return nil, err
+				}
+				best = v
+				continue
+			}
+			cmp, err := Compare(v, best)
+			if err != nil {
+				return nil, err
+			}
+			if cmp == sign {
+				best = v
+			}
+		}
+		return best, nil
+	}
+}
+
+// Compare returns -1, 0 or 1 if x is less than, equal to or greater than y.
+// Numbers of different types and sizes are compared exactly by value, and NaN
+// is equal to itself and less than every other number, so that numbers are
+// totally ordered. Strings, byte slices, booleans and times are compared with
+// values of the same type, and false is less than true. Returns error for other
+// values.
+func Compare(x, y interface{}) (int, error) {
+	return value.Compare(x, y)
+}
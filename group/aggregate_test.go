@@ -0,0 +1,84 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"math"
+	"testing"
+
+	row "github.com/google/godata/row"
+)
+
+func TestAggregate(t *testing.T) {
+	g := New(
+		row.Of("i", 2, "f", 1.5, "s", "b"),
+		row.Of("i", 1, "s", "c"),
+		row.Of("i", 3, "f", 0.5, "s", "a"),
+	)
+	tests := []struct {
+		name string
+		agg  Aggregate
+		want interface{}
+	}{
+		{"Count", Count(), 3},
+		{"Sum(i)", Sum("i"), 6},
+		{"Sum(f)", Sum("f"), 2.0},
+		{"Mean(i)", Mean("i"), 2.0},
+		{"Mean(f)", Mean("f"), 1.0},
+		{"Mean(x)", Mean("x"), nil},
+		{"Min(i)", Min("i"), 1},
+		{"Max(f)", Max("f"), 1.5},
+		{"Min(s)", Min("s"), "a"},
+		{"Max(x)", Max("x"), nil},
+	}
+	for _, test := range tests {
+		if got, err := test.agg(g); err != nil || got != test.want {
+			t.Errorf("%s = %v, %v; want %v", test.name, got, err, test.want)
+		}
+	}
+
+	mixed := New(row.Of("v", 1), row.Of("v", "a"))
+	for _, agg := range []Aggregate{Sum("v"), Mean("v"), Min("v"), Max("v")} {
+		if _, err := agg(mixed); err == nil {
+			t.Errorf("Aggregate(%v) = nil error; want error", mixed)
+		}
+	}
+
+	sized := New(row.Of("v", int32(1), "f", float32(0.5)), row.Of("v", int64(2), "f", math.NaN()), row.Of("v", uint8(3), "f", -1.0))
+	for _, test := range []struct {
+		name string
+		agg  Aggregate
+		want interface{}
+	}{
+		{"Sum(v)", Sum("v"), 6},
+		{"Mean(v)", Mean("v"), 2.0},
+		{"Max(v)", Max("v"), uint8(3)},
+		{"Max(f)", Max("f"), float32(0.5)},
+	} {
+		if got, err := test.agg(sized); err != nil || got != test.want {
+			t.Errorf("%s of sized values = %v, %v; want %v", test.name, got, err, test.want)
+		}
+	}
+	// NaN is less than every other number.
+	if got, err := Min("f")(sized); err != nil || !math.IsNaN(got.(float64)) {
+		t.Errorf("Min(f) of sized values = %v, %v; want NaN", got, err)
+	}
+	if cmp, err := Compare(1<<53+1, float64(1<<53)); err != nil || cmp != 1 {
+		t.Errorf("Compare(1<<53 + 1, float64(1<<53)) = %v, %v; want 1", cmp, err)
+	}
+
+	if got, err := Sum("v").Action(row.Of(Column, New(row.Of("v", 2)))); err != nil || got != 2 {
+		t.Errorf("Sum.Action = %v, %v; want 2", got, err)
+	}
+}
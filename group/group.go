@@ -16,7 +16,17 @@ limitations under the License.
 // contains a list of rows, each with the same index.
 package group
 
-import row "github.com/google/godata/row"
+import (
+	"encoding/gob"
+
+	row "github.com/google/godata/row"
+)
+
+func init() {
+	gob.Register(Group{})
+	gob.Register(Indexer{})
+	gob.Register(SubtotalIndexer{})
+}
 
 // Column is the Frame column in which the group is stored.
 const Column = "Group"
@@ -0,0 +1,79 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"fmt"
+
+	"github.com/google/godata/internal/value"
+	row "github.com/google/godata/row"
+)
+
+// Incremental is an aggregate of a column that is maintained by accumulating
+// the value of each row as it is added to or removed from a group, rather than
+// computed over a whole Group like an Aggregate.
+type Incremental struct {
+	op     value.Op
+	column string
+}
+
+// IncrementalCount returns an Incremental of the number of rows.
+func IncrementalCount() Incremental {
+	return Incremental{op: value.Count}
+}
+
+// IncrementalSum returns an Incremental of the total of the column, like Sum,
+// except that the total of a group without values is nil. Retracting floats
+// may accumulate rounding errors.
+func IncrementalSum(column string) Incremental {
+	return Incremental{op: value.Sum, column: column}
+}
+
+// IncrementalMin returns an Incremental of the least value of the column, like
+// Min. Unlike Min, values of different types may be mixed, in which case
+// numbers are less than strings, which are less than byte slices, booleans and
+// times, in that order.
+func IncrementalMin(column string) Incremental {
+	return Incremental{op: value.Min, column: column}
+}
+
+// IncrementalMax returns an Incremental of the greatest value of the column,
+// like IncrementalMin.
+func IncrementalMax(column string) Incremental {
+	return Incremental{op: value.Max, column: column}
+}
+
+// Check returns error if the row cannot be aggregated.
+func (i Incremental) Check(data row.Data) error {
+	acc := value.Accumulator{Op: i.op}
+	if err := acc.Check(i.Arg(data)); err != nil {
+		return fmt.Errorf("column %q: %v", i.column, err)
+	}
+	return nil
+}
+
+// Arg returns the value of the row that is added to the Accumulators of the
+// Incremental, which is non-nil for every row of a count.
+func (i Incremental) Arg(data row.Data) interface{} {
+	if i.op == value.Count {
+		return true
+	}
+	return data[i.column]
+}
+
+// New returns an Accumulator of the Incremental with no values, from which
+// values may be removed if it is retractable.
+func (i Incremental) New(retractable bool) *value.Accumulator {
+	return &value.Accumulator{Op: i.op, Retractable: retractable}
+}
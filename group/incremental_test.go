@@ -0,0 +1,80 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"testing"
+
+	row "github.com/google/godata/row"
+)
+
+func TestIncremental(t *testing.T) {
+	rows := []row.Data{
+		row.Of("v", 2),
+		row.Of("v", 5),
+		row.Of("v", 5),
+		row.Of("v", 1.5),
+		row.Of("v", "b"),
+		row.Of(),
+	}
+	tests := []struct {
+		name string
+		inc  Incremental
+		// want is the value after adding every row, and after removing each
+		// row in turn.
+		want []interface{}
+	}{
+		{"Count", IncrementalCount(), []interface{}{6, 5, 4, 3, 2, 1, 0}},
+		{"Min", IncrementalMin("v"), []interface{}{1.5, 1.5, 1.5, 1.5, "b", nil, nil}},
+		{"Max", IncrementalMax("v"), []interface{}{"b", "b", "b", "b", "b", nil, nil}},
+	}
+	for _, test := range tests {
+		acc := test.inc.New(true)
+		for _, data := range rows {
+			if err := test.inc.Check(data); err != nil {
+				t.Fatalf("%s.Check(%v): %v", test.name, data, err)
+			}
+			acc.Add(test.inc.Arg(data))
+		}
+		got := []interface{}{acc.Result()}
+		for _, data := range rows {
+			acc.Remove(test.inc.Arg(data))
+			got = append(got, acc.Result())
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s = %v; want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+
+	sum := IncrementalSum("v")
+	if err := sum.Check(row.Of("v", "b")); err == nil {
+		t.Errorf("Sum.Check(b) = nil error; want error")
+	}
+	acc := sum.New(true)
+	acc.Add(2)
+	acc.Add(0.5)
+	if got := acc.Result(); got != 2.5 {
+		t.Errorf("Sum = %v; want 2.5", got)
+	}
+	acc.Remove(0.5)
+	if got := acc.Result(); got != 2 {
+		t.Errorf("Sum = %v after removing the float; want int 2", got)
+	}
+	if err := IncrementalMax("v").Check(row.Of("v", struct{}{})); err == nil {
+		t.Errorf("Max.Check(struct{}{}) = nil error; want error")
+	}
+}
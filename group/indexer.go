@@ -20,22 +20,40 @@ import (
 	row "github.com/google/godata/row"
 )
 
+// Indexer indexes the rows of a grouped Frame by the index of their groups,
+// as given by the RowIndexer.
 type Indexer struct {
 	RowIndexer index.Indexer
 }
 
-// Index returns the index of the first row in a collection of rows.
+// Index returns the index of a row of a grouped Frame. Rows containing every
+// key column of a ColumnIndexer, such as the rows of groups and the key
+// columns of a group given to Frame.Get, are indexed by the RowIndexer
+// directly. Other rows are indexed by the first row of their Group, or
+// directly if they have no Group or an empty Group.
 func (i Indexer) Index(data row.Data) (index.Index, error) {
+	if columns := index.IndexColumns(i.RowIndexer); len(columns) > 0 {
+		keyed := true
+		for _, col := range columns {
+			if _, ok := data[col]; !ok {
+				keyed = false
+				break
+			}
+		}
+		if keyed {
+			return i.RowIndexer.Index(data)
+		}
+	}
 	col, ok := data[Column]
 	if !ok {
-		return nil, fmt.Errorf("Row %v does not contain %q", data, Column)
+		return i.RowIndexer.Index(data)
 	}
 	group, ok := col.(Group)
 	if !ok {
 		return nil, fmt.Errorf("Column %q containing %v is not a Group", Column, col)
 	}
 	if len(group) == 0 {
-		return i.RowIndexer.Index(nil)
+		return i.RowIndexer.Index(data)
 	}
 	return i.RowIndexer.Index(group[0])
 }
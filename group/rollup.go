@@ -0,0 +1,189 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/godata/internal/value"
+	index "github.com/google/godata/row"
+	row "github.com/google/godata/row"
+)
+
+// SubtotalIndexer indexes the rows returned by Rollup and Cube by the grouping
+// columns. A nil value of a column marks a subtotal over every value of the
+// column, and sorts after the values, so that each subtotal follows the rows it
+// totals, and the grand total is last.
+type SubtotalIndexer struct {
+	Columns []string
+}
+
+// Index returns the index of the grouping columns of the row. Returns error if
+// a value cannot be converted into an index.
+func (s SubtotalIndexer) Index(data row.Data) (index.Index, error) {
+	indices := make([]index.Index, len(s.Columns))
+	for i, col := range s.Columns {
+		v := data[col]
+		if v == nil {
+			indices[i] = index.NewMultiIndex(index.IntIndex(1))
+			continue
+		}
+		ind, err := index.NewIndex(v)
+		if err != nil {
+			return nil, err
+		}
+		indices[i] = index.NewMultiIndex(index.IntIndex(0), ind)
+	}
+	return index.NewMultiIndex(indices...), nil
+}
+
+// Rollup returns a row for each combination of values of the grouping columns
+// in the Group, and a subtotal row for each combination of values of every
+// prefix of the columns, down to a grand total over all rows. For example,
+// rolling up region, country and city adds subtotals by region and country,
+// by region, and overall. Each row contains the grouping columns, which are
+// nil in subtotal rows for the columns totaled over, and a column for each of
+// the aggregates, computed over the rows of the combination. The rows are in
+// the order of the SubtotalIndexer for the columns. Rows without a grouping
+// column are only aggregated in the subtotals over that column. Returns the
+// first error returned by an aggregate or by indexing a row, or an error if an
+// aggregate has the name of a grouping column.
+func Rollup(g Group, columns []string, aggs map[string]Aggregate) (Group, error) {
+	var sets [][]bool
+	for n := len(columns); n >= 0; n-- {
+		set := make([]bool, len(columns))
+		for i := 0; i < n; i++ {
+			set[i] = true
+		}
+		sets = append(sets, set)
+	}
+	return subtotals(g, columns, sets, aggs)
+}
+
+// Cube returns the rows of Rollup for every subset of the grouping columns
+// rather than every prefix, so that there are subtotals over every combination
+// of the columns. There are 2^n subsets of n columns.
+func Cube(g Group, columns []string, aggs map[string]Aggregate) (Group, error) {
+	var sets [][]bool
+	for mask := 0; mask < 1<<uint(len(columns)); mask++ {
+		set := make([]bool, len(columns))
+		for i := range columns {
+			set[i] = mask&(1<<uint(i)) == 0
+		}
+		sets = append(sets, set)
+	}
+	return subtotals(g, columns, sets, aggs)
+}
+
+// subtotals returns the aggregated rows for each set of grouping columns,
+// given by whether each column is grouped by.
+func subtotals(g Group, columns []string, sets [][]bool, aggs map[string]Aggregate) (Group, error) {
+	// Indices of different types cannot be compared.
+	for _, col := range columns {
+		if _, ok := aggs[col]; ok {
+			return nil, fmt.Errorf("aggregate %q is also a grouping column", col)
+		}
+		var typ reflect.Type
+		for _, data := range g {
+			if v := data[col]; v != nil {
+				if typ == nil {
+					typ = reflect.TypeOf(v)
+				} else if reflect.TypeOf(v) != typ {
+					return nil, fmt.Errorf("%q has type %v but saw %v of type %T", col, typ, v, v)
+				}
+			}
+		}
+	}
+
+	var (
+		out     Group
+		indices []index.Index
+		indexer = SubtotalIndexer{Columns: columns}
+	)
+	for _, set := range sets {
+		var keys []string
+		groups := make(map[string]Group)
+	rows:
+		for _, data := range g {
+			var vals []interface{}
+			for i, col := range columns {
+				if !set[i] {
+					continue
+				}
+				v := data[col]
+				if v == nil {
+					continue rows
+				}
+				vals = append(vals, v)
+			}
+			key := value.Key(vals)
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], data)
+		}
+		if len(g) == 0 && !contains(set, true) {
+			// The grand total is kept for an empty Group.
+			keys = append(keys, "")
+		}
+
+		for _, key := range keys {
+			members := groups[key]
+			data := make(row.Data, len(columns)+len(aggs))
+			for i, col := range columns {
+				data[col] = nil
+				if set[i] {
+					data[col] = members[0][col]
+				}
+			}
+			for col, agg := range aggs {
+				v, err := agg(members)
+				if err != nil {
+					return nil, err
+				}
+				data[col] = v
+			}
+			ind, err := indexer.Index(data)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, data)
+			indices = append(indices, ind)
+		}
+	}
+	order := make([]int, len(out))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return indices[order[i]].Less(indices[order[j]])
+	})
+	sorted := make(Group, len(out))
+	for i, j := range order {
+		sorted[i] = out[j]
+	}
+	return sorted, nil
+}
+
+// contains returns true if the set contains the value.
+func contains(set []bool, v bool) bool {
+	for _, b := range set {
+		if b == v {
+			return true
+		}
+	}
+	return false
+}
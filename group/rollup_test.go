@@ -0,0 +1,84 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	row "github.com/google/godata/row"
+)
+
+// subtotalRows formats the grouping columns and total of each row, with "*"
+// for subtotals.
+func subtotalRows(g Group, columns ...string) []string {
+	var out []string
+	for _, data := range g {
+		s := ""
+		for _, col := range columns {
+			if v := data[col]; v != nil {
+				s += fmt.Sprint(v) + "/"
+			} else {
+				s += "*/"
+			}
+		}
+		out = append(out, fmt.Sprintf("%s%v", s, data["total"]))
+	}
+	return out
+}
+
+var sales = New(
+	row.Of("region", "EU", "country", "FR", "amount", 1),
+	row.Of("region", "EU", "country", "DE", "amount", 2),
+	row.Of("region", "EU", "country", "FR", "amount", 4),
+	row.Of("region", "US", "country", "US", "amount", 8),
+)
+
+func TestRollup(t *testing.T) {
+	got, err := Rollup(sales, []string{"region", "country"}, map[string]Aggregate{"total": Sum("amount")})
+	if err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+	want := []string{"EU/DE/2", "EU/FR/5", "EU/*/7", "US/US/8", "US/*/8", "*/*/15"}
+	if rows := subtotalRows(got, "region", "country"); !reflect.DeepEqual(rows, want) {
+		t.Errorf("Rollup = %v; want %v", rows, want)
+	}
+
+	empty, err := Rollup(nil, []string{"region"}, map[string]Aggregate{"total": Count()})
+	if err != nil || len(empty) != 1 || empty[0]["total"] != 0 {
+		t.Errorf("Rollup(nil) = %v, %v; want a grand total of 0", empty, err)
+	}
+	mixed := New(row.Of("region", "EU"), row.Of("region", 1))
+	if _, err := Rollup(mixed, []string{"region"}, nil); err == nil {
+		t.Errorf("Rollup(%v) = nil error; want error", mixed)
+	}
+	if _, err := Rollup(sales, []string{"region"}, map[string]Aggregate{"region": Count()}); err == nil {
+		t.Errorf("Rollup with an aggregate named region = nil error; want error")
+	}
+}
+
+func TestCube(t *testing.T) {
+	got, err := Cube(sales, []string{"region", "country"}, map[string]Aggregate{"total": Sum("amount")})
+	if err != nil {
+		t.Fatalf("Cube: %v", err)
+	}
+	want := []string{
+		"EU/DE/2", "EU/FR/5", "EU/*/7", "US/US/8", "US/*/8",
+		"*/DE/2", "*/FR/5", "*/US/8", "*/*/15",
+	}
+	if rows := subtotalRows(got, "region", "country"); !reflect.DeepEqual(rows, want) {
+		t.Errorf("Cube = %v; want %v", rows, want)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"fmt"
+
+	"github.com/google/btree"
+	"github.com/google/godata/group"
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// GroupView is a grouped view of a Frame, which keeps the aggregates of each
+// group up to date as rows are added to and removed from the Frame. See
+// AddGroupView.
+type GroupView struct {
+	indexer row.Indexer
+	aggs    map[string]group.Incremental
+
+	// groups contains a *viewGroup for each index with rows in the Frame.
+	groups *btree.BTree
+}
+
+// viewGroup is a group of a GroupView.
+type viewGroup struct {
+	index row.Index
+
+	// keys contains the index columns of the first row added to the group.
+	keys row.Data
+
+	rows int
+	accs map[string]*value.Accumulator
+}
+
+// Less returns true if the group is less than the given *viewGroup.
+func (g *viewGroup) Less(item btree.Item) bool {
+	return g.index.Less(item.(*viewGroup).index)
+}
+
+// AddGroupView adds a GroupView with the given name to the Frame, which groups
+// its rows by the indexer and maintains the aggregates of each group, keyed by
+// column. Like a secondary index, the view is kept in sync with the Frame by
+// Put, Pop and PopRange, so that a group's aggregates are updated in time
+// proportional to the number of aggregates as each row is added or removed,
+// rather than recomputed over the Frame. Returns error if the name is already
+// in use or if an existing row cannot be indexed or aggregated, in which case
+// the Frame is unchanged. Once a view exists, Put fails for such rows.
+func (f *Frame) AddGroupView(name string, indexer row.Indexer, aggs map[string]group.Incremental) (*GroupView, error) {
+	if _, ok := f.views[name]; ok {
+		return nil, fmt.Errorf("AddGroupView: view %q already exists", name)
+	}
+	v := &GroupView{
+		indexer: indexer,
+		aggs:    aggs,
+		groups:  btree.New(DefaultDegree),
+	}
+	var returnErr error
+	f.bt.Ascend(func(item btree.Item) bool {
+		if returnErr = v.check(item.(row.Row).Data); returnErr != nil {
+			returnErr = fmt.Errorf("AddGroupView: %v", returnErr)
+			return false
+		}
+		return true
+	})
+	if returnErr != nil {
+		return nil, returnErr
+	}
+	f.bt.Ascend(func(item btree.Item) bool {
+		v.add(item.(row.Row).Data)
+		return true
+	})
+
+	if f.views == nil {
+		f.views = make(map[string]*GroupView)
+	}
+	f.views[name] = v
+	return v, nil
+}
+
+// DropGroupView removes the GroupView with the given name, which is no longer
+// updated. It is a no-op if the view does not exist.
+func (f *Frame) DropGroupView(name string) {
+	delete(f.views, name)
+}
+
+// checkViews returns error if the data cannot be added to every GroupView.
+func (f *Frame) checkViews(data row.Data) error {
+	for name, v := range f.views {
+		if err := v.check(data); err != nil {
+			return fmt.Errorf("view %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// check returns error if the data cannot be indexed or aggregated.
+func (v *GroupView) check(data row.Data) error {
+	if _, err := v.indexer.Index(data); err != nil {
+		return err
+	}
+	for _, agg := range v.aggs {
+		if err := agg.Check(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds the data, which has been checked, to its group.
+func (v *GroupView) add(data row.Data) {
+	index, _ := v.indexer.Index(data)
+	var g *viewGroup
+	if got := v.groups.Get(&viewGroup{index: index}); got != nil {
+		g = got.(*viewGroup)
+	} else {
+		g = &viewGroup{
+			index: index,
+			keys:  make(row.Data),
+			accs:  make(map[string]*value.Accumulator, len(v.aggs)),
+		}
+		for _, col := range row.IndexColumns(v.indexer) {
+			g.keys[col] = data[col]
+		}
+		for col, agg := range v.aggs {
+			g.accs[col] = agg.New(true)
+		}
+		v.groups.ReplaceOrInsert(g)
+	}
+	g.rows++
+	for col, acc := range g.accs {
+		acc.Add(v.aggs[col].Arg(data))
+	}
+}
+
+// remove retracts the data, which has been added, from its group, and removes
+// the group once it is empty.
+func (v *GroupView) remove(data row.Data) {
+	index, err := v.indexer.Index(data)
+	if err != nil {
+		return
+	}
+	got := v.groups.Get(&viewGroup{index: index})
+	if got == nil {
+		return
+	}
+	g := got.(*viewGroup)
+	if g.rows--; g.rows == 0 {
+		v.groups.Delete(g)
+		return
+	}
+	for col, acc := range g.accs {
+		acc.Remove(v.aggs[col].Arg(data))
+	}
+}
+
+// data returns the index columns and aggregates of the group.
+func (g *viewGroup) data() row.Data {
+	data := g.keys.Copy()
+	for col, acc := range g.accs {
+		data[col] = acc.Result()
+	}
+	return data
+}
+
+// Len returns the number of groups in the view.
+func (v *GroupView) Len() int {
+	return v.groups.Len()
+}
+
+// Get returns the index columns and aggregates of the group for the given key,
+// which is indexed by the view's indexer. Returns error if the key is invalid.
+// Returns nil if the group has no rows.
+func (v *GroupView) Get(key row.Data) (row.Data, error) {
+	index, err := v.indexer.Index(key)
+	if err != nil {
+		return nil, err
+	}
+	got := v.groups.Get(&viewGroup{index: index})
+	if got == nil {
+		return nil, nil
+	}
+	return got.(*viewGroup).data(), nil
+}
+
+// Frame returns a new Frame with the view's indexer, containing a row for each
+// group with its index columns and aggregates, as returned by Get. The Frame
+// is not updated with the view.
+func (v *GroupView) Frame() *Frame {
+	nf := NewFrame(v.indexer, SizeHint(v.groups.Len()))
+	v.groups.Ascend(func(item btree.Item) bool {
+		g := item.(*viewGroup)
+		nf.bt.ReplaceOrInsert(row.Row{Index: g.index, Data: g.data()})
+		return true
+	})
+	return nf
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata/group"
+	"github.com/google/godata/row"
+)
+
+// viewAggs are the aggregates of the GroupView tests, and their equivalents.
+var (
+	viewAggs = map[string]group.Incremental{
+		"n":   group.IncrementalCount(),
+		"sum": group.IncrementalSum("v"),
+		"min": group.IncrementalMin("v"),
+		"max": group.IncrementalMax("v"),
+	}
+	recomputedAggs = map[string]group.Aggregate{
+		"n":   group.Count(),
+		"sum": group.Sum("v"),
+		"min": group.Min("v"),
+		"max": group.Max("v"),
+	}
+)
+
+// recomputeView returns the rows of a GroupView of the Frame by column k,
+// computed from scratch.
+func recomputeView(t *testing.T, f *Frame) []row.Data {
+	t.Helper()
+	grouped, err := f.GroupBy(row.NewColumnIndexer("k"))
+	if err != nil {
+		t.Fatalf("GroupBy: %v", err)
+	}
+	var rows []row.Data
+	grouped.ForEach(func(data row.Data) error {
+		out := row.Of("k", data["k"])
+		for col, agg := range recomputedAggs {
+			out[col], err = agg.Action(data)
+			if err != nil {
+				t.Fatalf("Aggregate: %v", err)
+			}
+		}
+		rows = append(rows, out)
+		return nil
+	})
+	return rows
+}
+
+func TestGroupView(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("id"))
+	f.Put(row.Of("id", 0, "k", "a", "v", 3))
+	v, err := f.AddGroupView("byK", row.NewColumnIndexer("k"), viewAggs)
+	if err != nil {
+		t.Fatalf("AddGroupView: %v", err)
+	}
+	if _, err := f.AddGroupView("byK", row.NewColumnIndexer("k"), nil); err == nil {
+		t.Errorf("AddGroupView(byK) twice = nil error; want error")
+	}
+
+	// Random Puts, replacements, Pops and PopRanges keep the view equal to
+	// the groups recomputed from scratch.
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		id := rng.Intn(50)
+		switch rng.Intn(10) {
+		case 0:
+			f.Pop(row.Of("id", id))
+		case 1:
+			f.PopRange(GreaterOrEqual(row.Of("id", id)), LessThan(row.Of("id", id+3)))
+		default:
+			k := string(rune('a' + rng.Intn(4)))
+			f.Put(row.Of("id", id, "k", k, "v", rng.Intn(20)))
+		}
+		var got []row.Data
+		v.Frame().ForEach(func(data row.Data) error {
+			got = append(got, data)
+			return nil
+		})
+		if want := recomputeView(t, f); !reflect.DeepEqual(got, want) {
+			t.Fatalf("after %d updates, GroupView = %v; want %v", i+1, got, want)
+		}
+	}
+
+	if _, err := f.Put(row.Of("id", 0, "k", "a", "v", "x")); err == nil {
+		t.Errorf("Put of a string sum = nil error; want error")
+	}
+	txn := f.Begin()
+	txn.PopRange()
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if v.Len() != 0 {
+		t.Errorf("GroupView.Len() = %d after popping every row; want 0", v.Len())
+	}
+	f.Put(row.Of("id", 0, "k", "a", "v", 1))
+	if got, err := v.Get(row.Of("k", "a")); err != nil || got["sum"] != 1 {
+		t.Errorf("GroupView.Get(a) = %v, %v; want sum 1", got, err)
+	}
+
+	f.DropGroupView("byK")
+	f.Put(row.Of("id", 1, "k", "a", "v", "x"))
+	if got, _ := v.Get(row.Of("k", "a")); got["n"] != 1 {
+		t.Errorf("GroupView.Get(a) = %v after DropGroupView; want 1 row", got)
+	}
+	if _, err := f.AddGroupView("byK", row.NewColumnIndexer("k"), viewAggs); err == nil {
+		t.Errorf("AddGroupView with a string sum = nil error; want error")
+	}
+}
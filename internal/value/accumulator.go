@@ -0,0 +1,273 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package value
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/btree"
+)
+
+// Op is an aggregate function.
+type Op int
+
+const (
+	Count Op = iota
+	Sum
+	Mean
+	Min
+	Max
+)
+
+func (op Op) String() string {
+	switch op {
+	case Count:
+		return "count"
+	case Sum:
+		return "sum"
+	case Mean:
+		return "mean"
+	case Min:
+		return "min"
+	case Max:
+		return "max"
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// Accumulator computes an aggregate over values, which may be added, removed
+// and merged from other Accumulators. Nil values are ignored, so counting rows
+// rather than values requires adding a non-nil value for each. Sums of ints
+// are ints, and sums involving a float64 are float64. The minimum and maximum
+// are taken over values of any type that Compare accepts, and values of
+// different types are ordered numbers first, then strings, byte slices,
+// booleans and times.
+type Accumulator struct {
+	Op Op
+
+	// Retractable must be set before any value is added for values to be
+	// removed from a Min or Max, whose Accumulator then keeps every distinct
+	// value, so that the extreme can be found once it is removed.
+	Retractable bool
+
+	// count is the number of values added and not removed.
+	count int
+
+	// sum and fsum are the totals of the ints and of the float64s, of which
+	// there are floats, so that a sum is an int once every float64 is removed.
+	sum    int
+	fsum   float64
+	floats int
+
+	// extreme is the minimum or maximum, unless the Accumulator is
+	// Retractable, in which case values counts each distinct value.
+	extreme interface{}
+	values  *btree.BTree
+}
+
+// valueCount is a distinct value and the number of times it was added.
+type valueCount struct {
+	value interface{}
+	count int
+}
+
+// Less orders the values by order. Values are checked before they are added,
+// so they are always ordered.
+func (v *valueCount) Less(item btree.Item) bool {
+	cmp, err := order(v.value, item.(*valueCount).value)
+	if err != nil {
+		panic(err)
+	}
+	return cmp < 0
+}
+
+// kind returns the rank of the type of a normalized value in the order of
+// values of different types, or -1 if values of the type cannot be compared.
+func kind(v interface{}) int {
+	switch v.(type) {
+	case int, float64:
+		return 0
+	case string:
+		return 1
+	case []byte:
+		return 2
+	case bool:
+		return 3
+	case time.Time:
+		return 4
+	}
+	return -1
+}
+
+// order compares values like Compare, and orders values of different types by
+// kind.
+func order(x, y interface{}) (int, error) {
+	x, y = Normalize(x), Normalize(y)
+	if kx, ky := kind(x), kind(y); kx >= 0 && ky >= 0 && kx != ky {
+		return compareInts(kx, ky), nil
+	}
+	return Compare(x, y)
+}
+
+// Check returns error if the value cannot be added.
+func (a *Accumulator) Check(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	v = Normalize(v)
+	switch a.Op {
+	case Sum, Mean:
+		if _, ok := ToFloat(v); !ok {
+			return fmt.Errorf("cannot compute %v of %v of type %T", a.Op, v, v)
+		}
+	case Min, Max:
+		if kind(v) < 0 {
+			return fmt.Errorf("cannot compute %v of %v of type %T", a.Op, v, v)
+		}
+	}
+	return nil
+}
+
+// Add adds a value to the aggregate. Returns error if the value cannot be
+// summed or compared.
+func (a *Accumulator) Add(v interface{}) error {
+	if err := a.Check(v); err != nil || v == nil {
+		return err
+	}
+	v = Normalize(v)
+	a.count++
+	switch a.Op {
+	case Sum, Mean:
+		a.update(v, 1)
+	case Min, Max:
+		if a.Retractable {
+			a.addValue(&valueCount{value: v, count: 1})
+			return nil
+		}
+		if cmp, _ := order(v, a.extreme); a.count == 1 || a.Op == Min && cmp < 0 || a.Op == Max && cmp > 0 {
+			a.extreme = v
+		}
+	}
+	return nil
+}
+
+// update adds the number to the sums with the given sign.
+func (a *Accumulator) update(v interface{}, sign int) {
+	switch v := v.(type) {
+	case int:
+		a.sum += sign * v
+	case float64:
+		a.fsum += float64(sign) * v
+		a.floats += sign
+	}
+}
+
+// addValue adds the count of a distinct value to a Retractable Accumulator.
+func (a *Accumulator) addValue(item *valueCount) {
+	if a.values == nil {
+		a.values = btree.New(16)
+	}
+	if got := a.values.Get(item); got != nil {
+		got.(*valueCount).count += item.count
+		return
+	}
+	a.values.ReplaceOrInsert(&valueCount{value: item.value, count: item.count})
+}
+
+// Remove removes a value that was added from the aggregate. Values may be
+// removed from a Min or Max only if the Accumulator is Retractable.
+func (a *Accumulator) Remove(v interface{}) {
+	if v == nil {
+		return
+	}
+	v = Normalize(v)
+	a.count--
+	switch a.Op {
+	case Sum, Mean:
+		a.update(v, -1)
+	case Min, Max:
+		if !a.Retractable {
+			panic(fmt.Sprintf("value: Remove from %v Accumulator that is not Retractable", a.Op))
+		}
+		got := a.values.Get(&valueCount{value: v})
+		if got == nil {
+			return
+		}
+		if got.(*valueCount).count--; got.(*valueCount).count == 0 {
+			a.values.Delete(got)
+		}
+	}
+}
+
+// Merge adds the values added to another Accumulator with the same Op and
+// Retractable, which is unchanged.
+func (a *Accumulator) Merge(other *Accumulator) {
+	if other.count == 0 {
+		return
+	}
+	switch a.Op {
+	case Min, Max:
+		if a.Retractable {
+			other.values.Ascend(func(item btree.Item) bool {
+				a.addValue(item.(*valueCount))
+				return true
+			})
+			break
+		}
+		if cmp, _ := order(other.extreme, a.extreme); a.count == 0 || a.Op == Min && cmp < 0 || a.Op == Max && cmp > 0 {
+			a.extreme = other.extreme
+		}
+	}
+	a.count += other.count
+	a.sum += other.sum
+	a.fsum += other.fsum
+	a.floats += other.floats
+}
+
+// Result returns the value of the aggregate, which is nil if no values were
+// added, except for counts.
+func (a *Accumulator) Result() interface{} {
+	switch a.Op {
+	case Count:
+		return a.count
+	case Sum, Mean:
+		if a.count == 0 {
+			return nil
+		}
+		if a.Op == Mean {
+			return (a.fsum + float64(a.sum)) / float64(a.count)
+		}
+		if a.floats > 0 {
+			return a.fsum + float64(a.sum)
+		}
+		return a.sum
+	}
+	if !a.Retractable {
+		return a.extreme
+	}
+	if a.values == nil {
+		return nil
+	}
+	var item btree.Item
+	if a.Op == Min {
+		item = a.values.Min()
+	} else {
+		item = a.values.Max()
+	}
+	if item == nil {
+		return nil
+	}
+	return item.(*valueCount).value
+}
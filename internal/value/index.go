@@ -0,0 +1,226 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package value
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/google/godata/row"
+)
+
+// Types are the types of the index columns of a Frame. Indices of different
+// types cannot be compared, so values must be converted to the types of the
+// index before looking them up.
+type Types map[string]reflect.Type
+
+// TypesOf returns the types of the columns in a row of the Frame, or nil if the
+// row is nil because the Frame is empty.
+func TypesOf(sample row.Data, columns []string) Types {
+	if sample == nil {
+		return nil
+	}
+	types := make(Types)
+	for _, col := range columns {
+		types[col] = reflect.TypeOf(sample[col])
+	}
+	return types
+}
+
+// Convert converts the value to the type of the index column. Returns false if
+// the value is not equal to any value of that type.
+func (t Types) Convert(column string, v interface{}) (interface{}, bool) {
+	v = Normalize(v)
+	if f, ok := v.(float64); ok && f == math.Trunc(f) && f >= math.MinInt && f < math.MaxInt {
+		v = int(f)
+	}
+	if v == nil || reflect.TypeOf(v) != t[column] {
+		return nil, false
+	}
+	return v, true
+}
+
+// minValue returns the least value of an index column of the type.
+func minValue(typ reflect.Type) (interface{}, bool) {
+	switch typ {
+	case reflect.TypeOf(0):
+		return math.MinInt, true
+	case reflect.TypeOf(""):
+		return "", true
+	}
+	return nil, false
+}
+
+// successor returns the least index value greater than the value.
+func successor(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int:
+		return v + 1, v < math.MaxInt
+	case string:
+		return v + "\x00", true
+	}
+	return nil, false
+}
+
+// Constraint compares an index column with a value.
+type Constraint struct {
+	Column string
+
+	// Op is one of the operators ==, <, <=, > and >=, with the column on the
+	// left.
+	Op string
+
+	Value interface{}
+}
+
+// bound is a bound of a range of index values, set by a constraint.
+type bound struct {
+	constraint int
+	value      interface{}
+	inclusive  bool
+}
+
+// tighter returns true if the lower or upper bound b is tighter than c.
+func (b *bound) tighter(c *bound, lower bool) bool {
+	if c == nil {
+		return true
+	}
+	cmp, _ := Compare(b.value, c.value)
+	if !lower {
+		cmp = -cmp
+	}
+	return cmp > 0 || cmp == 0 && !b.inclusive
+}
+
+// IndexRange returns the range of the index of a Frame that contains the rows
+// satisfying the constraints on its index columns: equalities on a prefix of
+// the columns, followed by lower or upper bounds on the next column. Either
+// bound is nil if the range is unbounded on that side. The types of the columns
+// are those of a row of the Frame, which is nil if the Frame is empty. Exact
+// is true for each constraint that every row in the range satisfies, which
+// need not be checked again.
+func IndexRange(columns []string, sample row.Data, constraints []Constraint) (greaterOrEqual, lessThan row.Data, exact []bool) {
+	exact = make([]bool, len(constraints))
+	types := TypesOf(sample, columns)
+	if types == nil || len(columns) == 0 {
+		return nil, nil, exact
+	}
+
+	var (
+		prefix       = make(row.Data)
+		equal        []int
+		k            int
+		lower, upper *bound
+	)
+	for ; k < len(columns); k++ {
+		col := columns[k]
+		lower, upper = nil, nil
+		for i, c := range constraints {
+			if c.Column != col {
+				continue
+			}
+			v, ok := types.Convert(col, c.Value)
+			if !ok {
+				continue
+			}
+			switch b := (&bound{i, v, c.Op != "<" && c.Op != ">"}); c.Op {
+			case "==":
+				if _, ok := prefix[col]; !ok {
+					prefix[col] = v
+					equal = append(equal, i)
+				}
+			case ">", ">=":
+				if b.tighter(lower, true) {
+					lower = b
+				}
+			case "<", "<=":
+				if b.tighter(upper, false) {
+					upper = b
+				}
+			}
+		}
+		if _, ok := prefix[col]; !ok {
+			break
+		}
+	}
+	if k == len(columns) {
+		lower, upper = nil, nil
+	}
+
+	// fill sets the columns from the given one onward to their least values.
+	fill := func(data row.Data, from int) row.Data {
+		for _, col := range columns[from:] {
+			v, ok := minValue(types[col])
+			if !ok {
+				return nil
+			}
+			data[col] = v
+		}
+		return data
+	}
+
+	var lowerUsed, upperUsed bool
+	from := k
+	ge := prefix.Copy()
+	if lower != nil {
+		v, ok := lower.value, true
+		if !lower.inclusive {
+			v, ok = successor(v)
+		}
+		if ok {
+			ge[columns[k]] = v
+			from = k + 1
+		}
+	}
+	if from > 0 {
+		greaterOrEqual = fill(ge, from)
+		lowerUsed = greaterOrEqual != nil && from > k
+	}
+
+	if upper != nil {
+		v, ok := upper.value, true
+		if upper.inclusive {
+			v, ok = successor(v)
+		}
+		if ok {
+			lt := prefix.Copy()
+			lt[columns[k]] = v
+			lessThan = fill(lt, k+1)
+			upperUsed = lessThan != nil
+		}
+	}
+	if lessThan == nil && k > 0 {
+		if v, ok := successor(prefix[columns[k-1]]); ok {
+			lt := prefix.Copy()
+			lt[columns[k-1]] = v
+			lessThan = fill(lt, k)
+		}
+	}
+
+	// The rows in the range only have the prefix if it bounds both sides.
+	prefixed := k == 0 || greaterOrEqual != nil && lessThan != nil
+	if !prefixed {
+		return greaterOrEqual, lessThan, exact
+	}
+	for _, i := range equal {
+		exact[i] = true
+	}
+	if lowerUsed {
+		exact[lower.constraint] = true
+	}
+	if upperUsed {
+		exact[upper.constraint] = true
+	}
+	return greaterOrEqual, lessThan, exact
+}
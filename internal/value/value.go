@@ -0,0 +1,200 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package value compares, hashes and aggregates the values of rows, and
+// computes the ranges of Frame indices that contain the rows satisfying
+// comparisons of their index columns. It is shared by the packages that
+// aggregate rows and evaluate expressions over them.
+package value
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Normalize converts integers to int and floating point numbers to float64.
+// Unsigned integers that do not fit in an int are converted to float64.
+func Normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	case uint:
+		if v <= math.MaxInt {
+			return int(v)
+		}
+		return float64(v)
+	case uint64:
+		if v <= math.MaxInt {
+			return int(v)
+		}
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return v
+}
+
+// ToFloat returns the value of a normalized number as a float64.
+func ToFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Compare returns -1, 0 or 1 if x is less than, equal to or greater than y.
+// Numbers of different types are compared exactly by value, and NaN is equal to
+// itself and less than every other number, so that numbers are totally
+// ordered. Strings, byte slices, booleans and times are compared with values of
+// the same type, and false is less than true. Returns error for other values.
+func Compare(x, y interface{}) (int, error) {
+	x, y = Normalize(x), Normalize(y)
+	switch a := x.(type) {
+	case int:
+		switch b := y.(type) {
+		case int:
+			return compareInts(a, b), nil
+		case float64:
+			return -compareFloatInt(b, a), nil
+		}
+	case float64:
+		switch b := y.(type) {
+		case int:
+			return compareFloatInt(a, b), nil
+		case float64:
+			return compareFloats(a, b), nil
+		}
+	case string:
+		if b, ok := y.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	case []byte:
+		if b, ok := y.([]byte); ok {
+			return bytes.Compare(a, b), nil
+		}
+	case bool:
+		if b, ok := y.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case b:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case time.Time:
+		if b, ok := y.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1, nil
+			case a.After(b):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", x, y)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case a == b:
+		return 0
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return -1
+	}
+	return 1
+}
+
+// compareFloatInt compares a float64 with an int without converting the int to
+// a float64, which would round ints above 2^53.
+func compareFloatInt(a float64, b int) int {
+	switch {
+	case math.IsNaN(a):
+		return -1
+	case a >= math.MaxInt:
+		// math.MaxInt rounds up to 2^63 as a float64, which exceeds every int.
+		return 1
+	case a < math.MinInt:
+		return -1
+	}
+	t := math.Trunc(a)
+	if cmp := compareInts(int(t), b); cmp != 0 {
+		return cmp
+	}
+	return compareFloats(a, t)
+}
+
+// Key returns a string that is equal for lists of values that compare equal,
+// for use as a hash key. Nil values are equal to each other.
+func Key(vals []interface{}) string {
+	var b strings.Builder
+	for _, v := range vals {
+		switch v := Normalize(v).(type) {
+		case nil:
+			b.WriteString("null")
+		case int:
+			fmt.Fprintf(&b, "n%d", v)
+		case float64:
+			if v == math.Trunc(v) && v >= math.MinInt && v < math.MaxInt {
+				fmt.Fprintf(&b, "n%d", int(v))
+			} else {
+				fmt.Fprintf(&b, "f%v", v)
+			}
+		case string:
+			fmt.Fprintf(&b, "s%q", v)
+		case []byte:
+			fmt.Fprintf(&b, "b%q", v)
+		case time.Time:
+			fmt.Fprintf(&b, "t%d", v.UnixNano())
+		default:
+			fmt.Fprintf(&b, "%T%v", v, v)
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package value
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+func TestCompare(t *testing.T) {
+	nan := math.NaN()
+	for _, c := range []struct {
+		x, y interface{}
+		want int
+	}{
+		{1, 2, -1},
+		{int32(2), int64(2), 0},
+		{uint8(3), 2.5, 1},
+		{float32(1.5), 1.5, 0},
+		{1<<53 + 1, float64(1 << 53), 1},
+		{float64(1 << 53), 1<<53 + 1, -1},
+		{math.MaxInt, float64(math.MaxInt), -1},
+		{math.MinInt, float64(math.MinInt), 0},
+		{-1, -1.5, 1},
+		{nan, nan, 0},
+		{nan, math.Inf(-1), -1},
+		{math.MinInt, nan, 1},
+		{"a", "b", -1},
+		{[]byte("b"), []byte("a"), 1},
+		{false, true, -1},
+	} {
+		got, err := Compare(c.x, c.y)
+		if err != nil || got != c.want {
+			t.Errorf("Compare(%v, %v) = %d, %v; want %d", c.x, c.y, got, err, c.want)
+		}
+	}
+	if _, err := Compare(1, "1"); err == nil {
+		t.Errorf("Compare(1, %q) succeeded; want error", "1")
+	}
+}
+
+func TestKey(t *testing.T) {
+	equal := [][]interface{}{
+		{1, int64(1), 1.0, uint8(1)},
+		{math.NaN(), math.NaN()},
+		{"a", "a"},
+	}
+	for _, vals := range equal {
+		for _, v := range vals[1:] {
+			if Key([]interface{}{v}) != Key(vals[:1]) {
+				t.Errorf("Key(%v) != Key(%v); want equal", v, vals[0])
+			}
+		}
+	}
+	for _, pair := range [][2]interface{}{
+		{1, "1"},
+		{1<<53 + 1, float64(1 << 53)},
+		{nil, ""},
+	} {
+		if Key(pair[:1]) == Key(pair[1:]) {
+			t.Errorf("Key(%v) == Key(%v); want different", pair[0], pair[1])
+		}
+	}
+}
+
+func TestAccumulator(t *testing.T) {
+	for _, c := range []struct {
+		op   Op
+		vals []interface{}
+		want interface{}
+	}{
+		{Count, []interface{}{1, nil, "a"}, 2},
+		{Sum, []interface{}{int32(1), nil, int64(2)}, 3},
+		{Sum, []interface{}{1, 0.5}, 1.5},
+		{Sum, []interface{}{nil}, nil},
+		{Mean, []interface{}{1, 2}, 1.5},
+		{Mean, nil, nil},
+		{Min, []interface{}{2, 1.5, 3}, 1.5},
+		{Max, []interface{}{"a", "c", "b"}, "c"},
+		{Max, []interface{}{"a", 2, true}, true},
+	} {
+		a := &Accumulator{Op: c.op}
+		for _, v := range c.vals {
+			if err := a.Add(v); err != nil {
+				t.Fatalf("%v Add(%v): %v", c.op, v, err)
+			}
+		}
+		if got := a.Result(); got != c.want {
+			t.Errorf("%v of %v = %v; want %v", c.op, c.vals, got, c.want)
+		}
+	}
+	if err := (&Accumulator{Op: Sum}).Add("a"); err == nil {
+		t.Errorf("sum Add(%q) succeeded; want error", "a")
+	}
+	if err := (&Accumulator{Op: Min}).Add(struct{}{}); err == nil {
+		t.Errorf("min Add(struct{}{}) succeeded; want error")
+	}
+}
+
+func TestAccumulatorRemoveMerge(t *testing.T) {
+	for _, c := range []struct {
+		op          Op
+		retractable bool
+		left, right []interface{}
+		remove      []interface{}
+		want        interface{}
+	}{
+		{Count, false, []interface{}{1, 2}, []interface{}{3}, []interface{}{1}, 2},
+		{Sum, false, []interface{}{1, 0.5}, []interface{}{2}, []interface{}{0.5}, 3},
+		{Mean, false, []interface{}{1}, []interface{}{2, 6}, []interface{}{6}, 1.5},
+		{Min, true, []interface{}{2, "a"}, []interface{}{1, 1}, []interface{}{1}, 1},
+		{Max, true, []interface{}{2, "a"}, []interface{}{1}, []interface{}{"a"}, 2},
+		{Max, false, []interface{}{2}, []interface{}{"a", 1}, nil, "a"},
+		{Min, true, []interface{}{2}, nil, []interface{}{2}, nil},
+	} {
+		left := &Accumulator{Op: c.op, Retractable: c.retractable}
+		right := &Accumulator{Op: c.op, Retractable: c.retractable}
+		for _, v := range c.left {
+			left.Add(v)
+		}
+		for _, v := range c.right {
+			right.Add(v)
+		}
+		left.Merge(right)
+		for _, v := range c.remove {
+			left.Remove(v)
+		}
+		if got := left.Result(); got != c.want {
+			t.Errorf("%v of %v and %v without %v = %v; want %v", c.op, c.left, c.right, c.remove, got, c.want)
+		}
+	}
+}
+
+func TestIndexRange(t *testing.T) {
+	columns := []string{"a", "b"}
+	sample := row.Of("a", 0, "b", "")
+	for _, c := range []struct {
+		constraints []Constraint
+		ge, lt      row.Data
+		exact       []bool
+	}{
+		{
+			[]Constraint{{"a", "==", 1}, {"b", ">", "x"}, {"b", "<=", 2.0}},
+			row.Of("a", 1, "b", "x\x00"), row.Of("a", 2, "b", ""),
+			[]bool{true, true, false},
+		},
+		{
+			[]Constraint{{"a", ">=", 1.0}, {"a", ">", 2}, {"a", "<", 5}},
+			row.Of("a", 3, "b", ""), row.Of("a", 5, "b", ""),
+			[]bool{false, true, true},
+		},
+		{
+			// The prefix is not bounded above, so no constraint is exact.
+			[]Constraint{{"a", "==", math.MaxInt}},
+			row.Of("a", math.MaxInt, "b", ""), nil,
+			[]bool{false},
+		},
+		{
+			[]Constraint{{"b", "==", "x"}},
+			nil, nil,
+			[]bool{false},
+		},
+	} {
+		ge, lt, exact := IndexRange(columns, sample, c.constraints)
+		if !reflect.DeepEqual(ge, c.ge) || !reflect.DeepEqual(lt, c.lt) || !reflect.DeepEqual(exact, c.exact) {
+			t.Errorf("IndexRange(%v) = %v, %v, %v; want %v, %v, %v", c.constraints, ge, lt, exact, c.ge, c.lt, c.exact)
+		}
+	}
+}
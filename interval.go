@@ -0,0 +1,149 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/btree"
+	"github.com/google/godata/row"
+)
+
+// interval is a row of the Frame of intervals of an IntervalJoin.
+type interval struct {
+	start, end row.Index
+	data       row.Data
+}
+
+// IntervalJoin returns a new Frame with the same indexer, which allows
+// duplicates, in which each row is merged with each row of the given Frame
+// whose interval from the start column up to but excluding the end column
+// contains the value of the on column. For example, joining events on time
+// with sessions from start to end matches each event with the sessions that
+// were open at the time of the event. Columns present in both rows keep the
+// value of the row of the Frame. The mode is InnerJoin or LeftJoin, which also
+// keeps the rows that are not in any interval. The rows are joined in index
+// order, and each row is joined with the intervals in the order of their
+// starts.
+//
+// The Frame must be indexed by a ColumnIndexer whose first column is the on
+// column. Both Frames are then walked in order of their values, so the join
+// takes time proportional to the number of rows of the Frames and of the
+// result, and an InnerJoin skips over the rows between intervals. Rows of the
+// given Frame missing the start or end column are ignored. Returns error if
+// their values have different types than the on column.
+func (f *Frame) IntervalJoin(frame *Frame, on, start, end string, mode JoinMode) (*Frame, error) {
+	if mode != InnerJoin && mode != LeftJoin {
+		return nil, fmt.Errorf("IntervalJoin: unsupported mode %v", mode)
+	}
+	if columns := row.IndexColumns(f.indexer); len(columns) == 0 || columns[0] != on {
+		return nil, fmt.Errorf("IntervalJoin: Frame is not indexed by %q", on)
+	}
+	nf := NewFrame(f.indexer, AllowDuplicates(), Degree(f.degree))
+	first := f.bt.Min()
+	if first == nil {
+		return nf, nil
+	}
+	typ := reflect.TypeOf(first.(row.Row).Data[on])
+
+	// The intervals are sorted by their starts.
+	var intervals []*interval
+	var returnErr error
+	frame.bt.Ascend(func(item btree.Item) bool {
+		data := item.(row.Row).Data
+		s, e := data[start], data[end]
+		if s == nil || e == nil {
+			return true
+		}
+		if reflect.TypeOf(s) != typ || reflect.TypeOf(e) != typ {
+			returnErr = fmt.Errorf("IntervalJoin: interval [%v, %v) does not have the type %v of %q", s, e, typ, on)
+			return false
+		}
+		si, _ := row.NewIndex(s)
+		ei, _ := row.NewIndex(e)
+		if si.Less(ei) {
+			intervals = append(intervals, &interval{start: si, end: ei, data: data})
+		}
+		return true
+	})
+	if returnErr != nil {
+		return nil, returnErr
+	}
+	sort.SliceStable(intervals, func(i, j int) bool {
+		return intervals[i].start.Less(intervals[j].start)
+	})
+
+	// seekable returns the index of the rows with the given value of the on
+	// column, which sorts before or at the first of them.
+	seekable := func(v row.Index) row.Index {
+		if len(row.IndexColumns(f.indexer)) == 1 {
+			return v
+		}
+		return row.NewMultiIndex(v)
+	}
+
+	c, err := f.newCursor(&rangeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var (
+		active []*interval
+		next   int
+	)
+	add := func(index row.Index, data row.Data) {
+		nf.seq++
+		nf.bt.ReplaceOrInsert(row.Row{Index: sequencedIndex{index: index, seq: nf.seq}, Data: data})
+	}
+	for c.valid() {
+		if len(active) == 0 && mode == InnerJoin {
+			if next == len(intervals) {
+				break
+			}
+			c.seek(seekable(intervals[next].start))
+			if !c.valid() {
+				break
+			}
+		}
+		r := c.row()
+		v, _ := row.NewIndex(r.Data[on])
+
+		// Open the intervals that start at or before the value, and close
+		// those that end at or before it.
+		for ; next < len(intervals) && !v.Less(intervals[next].start); next++ {
+			active = append(active, intervals[next])
+		}
+		open := active[:0]
+		for _, iv := range active {
+			if v.Less(iv.end) {
+				open = append(open, iv)
+			}
+		}
+		active = open
+
+		if len(active) == 0 && mode == LeftJoin {
+			add(c.index(), c.data())
+		}
+		for _, iv := range active {
+			data := iv.data.Copy()
+			for col, val := range r.Data {
+				data[col] = val
+			}
+			add(c.index(), data)
+		}
+		c.next()
+	}
+	return nf, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+// intervalPairs returns the events and sessions joined by IntervalJoin, with
+// "-" for events without a session.
+func intervalPairs(t *testing.T, events, sessions *Frame, mode JoinMode) []string {
+	t.Helper()
+	joined, err := events.IntervalJoin(sessions, "time", "start", "end", mode)
+	if err != nil {
+		t.Fatalf("IntervalJoin(%v): %v", mode, err)
+	}
+	var pairs []string
+	joined.ForEach(func(data row.Data) error {
+		s := data["session"]
+		if s == nil {
+			s = "-"
+		}
+		pairs = append(pairs, fmt.Sprintf("%v:%v", data["event"], s))
+		return nil
+	})
+	return pairs
+}
+
+func TestIntervalJoin(t *testing.T) {
+	events := NewFrame(row.NewColumnIndexer("time", "event"))
+	for i, time := range []int{1, 3, 5, 5, 9, 12, 20} {
+		events.Put(row.Of("time", time, "event", fmt.Sprint("e", i)))
+	}
+	sessions := NewFrame(row.NewColumnIndexer("session"))
+	sessions.Put(row.Of("session", "s1", "start", 3, "end", 6))
+	sessions.Put(row.Of("session", "s2", "start", 0, "end", 4))
+	sessions.Put(row.Of("session", "s3", "start", 5, "end", 12))
+	sessions.Put(row.Of("session", "s4", "start", 7, "end", 7))
+	sessions.Put(row.Of("session", "s5", "start", 15))
+
+	inner := []string{"e0:s2", "e1:s2", "e1:s1", "e2:s1", "e2:s3", "e3:s1", "e3:s3", "e4:s3"}
+	if got := intervalPairs(t, events, sessions, InnerJoin); !reflect.DeepEqual(got, inner) {
+		t.Errorf("IntervalJoin(InnerJoin) = %v; want %v", got, inner)
+	}
+	left := []string{"e0:s2", "e1:s2", "e1:s1", "e2:s1", "e2:s3", "e3:s1", "e3:s3", "e4:s3", "e5:-", "e6:-"}
+	if got := intervalPairs(t, events, sessions, LeftJoin); !reflect.DeepEqual(got, left) {
+		t.Errorf("IntervalJoin(LeftJoin) = %v; want %v", got, left)
+	}
+
+	joined, _ := events.IntervalJoin(sessions, "time", "start", "end", InnerJoin)
+	got, _ := joined.GetAll(row.Of("time", 3, "event", "e1"))
+	if want := []row.Data{
+		row.Of("time", 3, "event", "e1", "session", "s2", "start", 0, "end", 4),
+		row.Of("time", 3, "event", "e1", "session", "s1", "start", 3, "end", 6),
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAll = %v; want %v", got, want)
+	}
+
+	if _, err := events.IntervalJoin(sessions, "event", "start", "end", InnerJoin); err == nil {
+		t.Errorf("IntervalJoin succeeded on a column other than the first index column; want error")
+	}
+	if _, err := events.IntervalJoin(sessions, "time", "start", "end", OuterJoin); err == nil {
+		t.Errorf("IntervalJoin succeeded for OuterJoin; want error")
+	}
+	sessions.Put(row.Of("session", "s6", "start", "a", "end", "b"))
+	if _, err := events.IntervalJoin(sessions, "time", "start", "end", InnerJoin); err == nil {
+		t.Errorf("IntervalJoin succeeded for string intervals; want error")
+	}
+}
+
+func TestIntervalJoinMatchesNestedLoop(t *testing.T) {
+	// The events span several cursor batches, and the sessions leave gaps
+	// for InnerJoin to seek over.
+	events := NewFrame(row.NewColumnIndexer("time"), AllowDuplicates())
+	for i := 0; i < 3000; i++ {
+		events.Put(row.Of("time", (i*7919)%5000, "event", i))
+	}
+	sessions := NewFrame(row.NewColumnIndexer("session"))
+	for i := 0; i < 40; i++ {
+		start := (i * 337) % 4500
+		sessions.Put(row.Of("session", i, "start", start, "end", start+i*3))
+	}
+
+	for _, mode := range []JoinMode{InnerJoin, LeftJoin} {
+		joined, err := events.IntervalJoin(sessions, "time", "start", "end", mode)
+		if err != nil {
+			t.Fatalf("IntervalJoin(%v): %v", mode, err)
+		}
+		want := 0
+		events.ForEach(func(e row.Data) error {
+			n := 0
+			sessions.ForEach(func(s row.Data) error {
+				if s["start"].(int) <= e["time"].(int) && e["time"].(int) < s["end"].(int) {
+					n++
+				}
+				return nil
+			})
+			if n == 0 && mode == LeftJoin {
+				n = 1
+			}
+			want += n
+			return nil
+		})
+		if joined.Len() != want {
+			t.Errorf("IntervalJoin(%v).Len() = %d; want %d", mode, joined.Len(), want)
+		}
+	}
+}
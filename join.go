@@ -1,11 +1,17 @@
 package godata
 
 import (
+	"encoding/gob"
 	"fmt"
 
 	"github.com/google/godata/row"
 )
 
+func init() {
+	gob.Register(&JoinResult{})
+	gob.Register(JoinResultIndexer{})
+}
+
 // JoinResult represents the result of a join operation.
 type JoinResult struct {
 	// Left contains the contents in the left side of the join, or nil if the
@@ -0,0 +1,148 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// JoinAll returns a new Frame indexed by the key columns, containing one row
+// for each key present in every one of the Frames, keyed by name. Each row
+// contains the key columns, and the other columns of the row of each Frame
+// for the key, named by the name of the Frame and the column separated by a
+// period, such as "orders.price". If several rows of a Frame share a key, then
+// only the last row added is joined, as in Joined. Rows missing a key column
+// are ignored.
+//
+// The Frames are joined pairwise, from the smallest Frame to the largest, so
+// that each join looks up at most as many keys as the smallest Frame has
+// rows. Keys are looked up by Get in Frames indexed by a ColumnIndexer on the
+// key columns, and by scanning the other Frames once.
+func JoinAll(frames map[string]*Frame, keys []string) (*Frame, error) {
+	if len(frames) == 0 || len(keys) == 0 {
+		return nil, errors.New("JoinAll: no Frames or no key columns")
+	}
+	names := joinOrder(frames)
+
+	// joined maps the keys present in the Frames joined so far to the rows.
+	joined := make(map[string]row.Data)
+	frames[names[0]].ForEach(func(data row.Data) error {
+		if k, ok := joinKey(data, keys); ok {
+			out := make(row.Data, len(data))
+			for _, col := range keys {
+				out[col] = data[col]
+			}
+			addColumns(out, names[0], data, keys)
+			joined[k] = out
+		}
+		return nil
+	})
+
+	for _, name := range names[1:] {
+		f := frames[name]
+		matched := make(map[string]row.Data, len(joined))
+		if reflect.DeepEqual(row.IndexColumns(f.indexer), keys) {
+			for k, out := range joined {
+				rows, err := f.GetAll(keyOf(out, keys))
+				if err != nil {
+					return nil, fmt.Errorf("JoinAll: %s: %v", name, err)
+				}
+				if len(rows) > 0 {
+					addColumns(out, name, rows[len(rows)-1], keys)
+					matched[k] = out
+				}
+			}
+		} else {
+			last := make(map[string]row.Data)
+			f.ForEach(func(data row.Data) error {
+				if k, ok := joinKey(data, keys); ok && joined[k] != nil {
+					last[k] = data
+				}
+				return nil
+			})
+			for k, data := range last {
+				addColumns(joined[k], name, data, keys)
+				matched[k] = joined[k]
+			}
+		}
+		joined = matched
+	}
+
+	b := NewBuilder(row.NewColumnIndexer(keys...), SizeHint(len(joined)))
+	for _, out := range joined {
+		b.Add(out)
+	}
+	nf, err := b.Frame()
+	if err != nil {
+		return nil, fmt.Errorf("JoinAll: %v", err)
+	}
+	return nf, nil
+}
+
+// joinOrder returns the names of the Frames from the smallest to the largest,
+// breaking ties by name.
+func joinOrder(frames map[string]*Frame) []string {
+	names := make([]string, 0, len(frames))
+	for name := range frames {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		li, lj := frames[names[i]].Len(), frames[names[j]].Len()
+		return li < lj || li == lj && names[i] < names[j]
+	})
+	return names
+}
+
+// joinKey returns a key that is equal for rows with equal values of the key
+// columns, or false if a key column is missing.
+func joinKey(data row.Data, keys []string) (string, bool) {
+	vals := make([]interface{}, len(keys))
+	for i, col := range keys {
+		v := data[col]
+		if v == nil {
+			return "", false
+		}
+		vals[i] = v
+	}
+	return value.Key(vals), true
+}
+
+// keyOf returns the key columns of the row.
+func keyOf(data row.Data, keys []string) row.Data {
+	key := make(row.Data, len(keys))
+	for _, col := range keys {
+		key[col] = data[col]
+	}
+	return key
+}
+
+// addColumns adds the columns of the row of the named Frame other than the key
+// columns to the joined row, prefixed by the name.
+func addColumns(out row.Data, name string, data row.Data, keys []string) {
+	for col, v := range data {
+		isKey := false
+		for _, key := range keys {
+			isKey = isKey || col == key
+		}
+		if !isKey {
+			out[name+"."+col] = v
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+func TestJoinAll(t *testing.T) {
+	users := NewFrame(row.NewColumnIndexer("id"))
+	users.Put(row.Of("id", 1, "name", "ann"))
+	users.Put(row.Of("id", 2, "name", "bob"))
+	users.Put(row.Of("id", 3, "name", "cat"))
+
+	// Indexed by another column, so it is scanned.
+	emails := NewFrame(row.NewColumnIndexer("email"))
+	emails.Put(row.Of("email", "a@x", "id", 1))
+	emails.Put(row.Of("email", "b@x", "id", 2))
+	emails.Put(row.Of("email", "n@x"))
+
+	// The last row added for a key is joined.
+	logins := NewFrame(row.NewColumnIndexer("id"), AllowDuplicates())
+	logins.Put(row.Of("id", 1, "at", 10, "ip", "h1"))
+	logins.Put(row.Of("id", 1, "at", 20))
+	logins.Put(row.Of("id", 2, "at", 30))
+	logins.Put(row.Of("id", 3, "at", 40))
+
+	joined, err := JoinAll(map[string]*Frame{"users": users, "emails": emails, "logins": logins}, []string{"id"})
+	if err != nil {
+		t.Fatalf("JoinAll: %v", err)
+	}
+	got, _ := joined.GetRange()
+	want := []row.Data{
+		row.Of("id", 1, "users.name", "ann", "emails.email", "a@x", "logins.at", 20),
+		row.Of("id", 2, "users.name", "bob", "emails.email", "b@x", "logins.at", 30),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JoinAll = %v; want %v", got, want)
+	}
+
+	if got := joinOrder(map[string]*Frame{"users": users, "emails": emails, "logins": logins}); !reflect.DeepEqual(got, []string{"emails", "users", "logins"}) {
+		t.Errorf("joinOrder = %v; want emails, users, logins", got)
+	}
+
+	if _, err := JoinAll(map[string]*Frame{"users": users}, nil); err == nil {
+		t.Errorf("JoinAll succeeded without keys; want error")
+	}
+}
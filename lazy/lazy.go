@@ -0,0 +1,204 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lazy builds queries over Frames as logical plans, which are only
+// optimized and run when the result is collected. For example
+//
+//	orders := lazy.From(f).
+//		Filter(expr.MustCompile(`id >= 100 && region == "EU"`, nil)).
+//		GroupBy([]string{"customer"}, lazy.Sum("price", "total"))
+//	result, err := orders.Collect()
+//
+// scans only the rows with ids from 100 if f is indexed by id, and only keeps
+// the id, customer and price columns of the rows that match.
+//
+// The optimizer pushes the conjuncts of filters down the plan as far as the
+// columns they refer to allow, and bounds the scan of a Frame by the conjuncts
+// that compare leading columns of its ColumnIndexer with values: equalities on
+// a prefix of the index columns, followed by lower or upper bounds on the next
+// column. It then prunes the columns of the rows scanned to the columns used
+// by the rest of the plan. Explain prints the optimized plan.
+//
+// LazyFrames are immutable, so a plan may be extended in different ways and
+// collected more than once. Errors in building a plan are returned by Explain
+// and Collect.
+package lazy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/godata"
+	"github.com/google/godata/expr"
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// LazyFrame is a logical plan whose result is a Frame.
+type LazyFrame struct {
+	root node
+	err  error
+}
+
+// From returns a LazyFrame that scans the Frame. The Frame is read when the
+// plan is collected, not when it is built.
+func From(f *godata.Frame) *LazyFrame {
+	return &LazyFrame{root: &scan{frame: f}}
+}
+
+// failed returns a LazyFrame that fails with the error.
+func failed(format string, args ...interface{}) *LazyFrame {
+	return &LazyFrame{err: fmt.Errorf("lazy: "+format, args...)}
+}
+
+// Filter keeps the rows for which the boolean expression is true.
+func (l *LazyFrame) Filter(e *expr.Expr) *LazyFrame {
+	if l.err != nil {
+		return l
+	}
+	if _, err := e.Predicate(); err != nil {
+		return failed("Filter: %v", err)
+	}
+	return &LazyFrame{root: &filter{child: l.root, conjuncts: e.Conjuncts()}}
+}
+
+// Select keeps the given columns of the rows, and the index columns, which are
+// needed to index the result.
+func (l *LazyFrame) Select(columns ...string) *LazyFrame {
+	if l.err != nil {
+		return l
+	}
+	return &LazyFrame{root: &project{child: l.root, columns: union(columns, l.root.index())}}
+}
+
+// WithColumn sets the column of the rows to the value of the expression, or
+// removes it if the value is nil.
+func (l *LazyFrame) WithColumn(column string, e *expr.Expr) *LazyFrame {
+	if l.err != nil {
+		return l
+	}
+	return &LazyFrame{root: &withColumn{child: l.root, column: column, expr: e}}
+}
+
+// Join joins the rows with the rows of the right LazyFrame that have equal
+// values of the given columns, which must not be nil. The joined rows contain
+// the columns of both rows, with the values of the left row for the columns
+// they share. The result is indexed like the left LazyFrame, and allows
+// duplicates.
+func (l *LazyFrame) Join(right *LazyFrame, on ...string) *LazyFrame {
+	switch {
+	case l.err != nil:
+		return l
+	case right.err != nil:
+		return right
+	case len(on) == 0:
+		return failed("Join: no columns to join on")
+	}
+	return &LazyFrame{root: &join{left: l.root, right: right.root, on: on}}
+}
+
+// GroupBy groups the rows by the values of the key columns, and returns a row
+// of the keys and the aggregations of each group, indexed by the keys. Rows
+// that are missing a key column are left out.
+func (l *LazyFrame) GroupBy(keys []string, aggs ...Aggregation) *LazyFrame {
+	switch {
+	case l.err != nil:
+		return l
+	case len(keys) == 0:
+		return failed("GroupBy: no key columns")
+	}
+	for _, agg := range aggs {
+		if agg.as == "" || agg.op != value.Count && agg.column == "" {
+			return failed("GroupBy: invalid aggregation %v", agg)
+		}
+	}
+	return &LazyFrame{root: &group{child: l.root, keys: keys, aggs: aggs}}
+}
+
+// Explain returns the optimized plan, one operation per line, with the inputs
+// of each operation indented below it.
+func (l *LazyFrame) Explain() (string, error) {
+	if l.err != nil {
+		return "", l.err
+	}
+	var b strings.Builder
+	var explain func(n node, depth int)
+	explain = func(n node, depth int) {
+		fmt.Fprintf(&b, "%s%s\n", strings.Repeat("  ", depth), n.describe())
+		for _, child := range n.children() {
+			explain(child, depth+1)
+		}
+	}
+	explain(optimize(l.root), 0)
+	return b.String(), nil
+}
+
+// Collect optimizes and runs the plan, and returns the resulting Frame. The
+// result of filtering and selecting the rows of a Frame has the indexer and
+// options of the Frame.
+func (l *LazyFrame) Collect() (*godata.Frame, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	root := optimize(l.root)
+	f := root.empty()
+	err := root.run(func(data row.Data) error {
+		_, err := f.Put(data)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lazy: %v", err)
+	}
+	return f, nil
+}
+
+// Aggregation is an aggregation of the rows of a group. Aggregations other
+// than Count ignore nil values, and are left out of the row of a group if
+// every value is nil.
+type Aggregation struct {
+	op         value.Op
+	column, as string
+}
+
+func (a Aggregation) String() string {
+	if a.op == value.Count {
+		return fmt.Sprintf("count() as %s", a.as)
+	}
+	return fmt.Sprintf("%s(%s) as %s", a.op, a.column, a.as)
+}
+
+// Count counts the rows of a group.
+func Count(as string) Aggregation {
+	return Aggregation{op: value.Count, as: as}
+}
+
+// Sum sums the values of the column. The sum of integers is an int, and other
+// sums are float64.
+func Sum(column, as string) Aggregation {
+	return Aggregation{op: value.Sum, column: column, as: as}
+}
+
+// Mean averages the values of the column as a float64.
+func Mean(column, as string) Aggregation {
+	return Aggregation{op: value.Mean, column: column, as: as}
+}
+
+// Min returns the least value of the column.
+func Min(column, as string) Aggregation {
+	return Aggregation{op: value.Min, column: column, as: as}
+}
+
+// Max returns the greatest value of the column.
+func Max(column, as string) Aggregation {
+	return Aggregation{op: value.Max, column: column, as: as}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lazy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/godata"
+	"github.com/google/godata/expr"
+	"github.com/google/godata/row"
+)
+
+// testFrames returns a Frame of orders indexed by id, and a Frame of
+// customers indexed by customer.
+func testFrames() (orders, customers *godata.Frame) {
+	orders = godata.NewFrame(row.NewColumnIndexer("id"))
+	orders.Put(row.Of("id", 1, "customer", "ann", "price", 10, "qty", 2, "note", "a"))
+	orders.Put(row.Of("id", 2, "customer", "bob", "price", 5.5, "qty", 1))
+	orders.Put(row.Of("id", 3, "customer", "ann", "price", 3, "qty", 5))
+	orders.Put(row.Of("id", 4, "customer", "cat", "price", 8, "qty", 1, "note", "d"))
+	orders.Put(row.Of("id", 5, "customer", "bob", "price", 2, "qty", 3))
+	orders.Put(row.Of("id", 6, "customer", "ann", "qty", 1))
+
+	customers = godata.NewFrame(row.NewColumnIndexer("customer"))
+	customers.Put(row.Of("customer", "ann", "region", "EU"))
+	customers.Put(row.Of("customer", "bob", "region", "US"))
+	customers.Put(row.Of("customer", "dan", "region", "EU"))
+	return orders, customers
+}
+
+func compile(src string) *expr.Expr {
+	return expr.MustCompile(src, nil)
+}
+
+func collect(t *testing.T, l *LazyFrame) []row.Data {
+	t.Helper()
+	f, err := l.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	rows, err := f.GetRange()
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	return rows
+}
+
+func explain(t *testing.T, l *LazyFrame) string {
+	t.Helper()
+	plan, err := l.Explain()
+	if err != nil {
+		t.Fatalf("Explain: %v", err)
+	}
+	return plan
+}
+
+func TestCollect(t *testing.T) {
+	orders, _ := testFrames()
+	l := From(orders).
+		WithColumn("total", compile("price * qty")).
+		Select("customer", "total").
+		Filter(compile(`id > 1 && id <= 5 && customer != "cat"`))
+
+	want := []row.Data{
+		row.Of("id", 2, "customer", "bob", "total", 5.5),
+		row.Of("id", 3, "customer", "ann", "total", 15),
+		row.Of("id", 5, "customer", "bob", "total", 6),
+	}
+	if got := collect(t, l); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect = %v; want %v", got, want)
+	}
+
+	wantPlan := strings.Join([]string{
+		"Select [customer id total]",
+		"  WithColumn total = price * qty",
+		`    Scan index[id] range[id > 1 && id <= 5] filter[customer != "cat"] columns[customer id price qty]`,
+		"",
+	}, "\n")
+	if got := explain(t, l); got != wantPlan {
+		t.Errorf("Explain =\n%s\nwant\n%s", got, wantPlan)
+	}
+
+	// The plan is not modified by collecting it, and reads the Frame again.
+	orders.Put(row.Of("id", 4, "customer", "dan", "price", 1, "qty", 1))
+	if got := collect(t, l); len(got) != 4 || got[2]["customer"] != "dan" {
+		t.Errorf("Collect after Put = %v; want 4 rows", got)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	orders, _ := testFrames()
+	l := From(orders).
+		WithColumn("unused", compile("qty * 2")).
+		Filter(compile(`note == nil || price > 9`)).
+		Select("qty")
+	want := []row.Data{
+		row.Of("id", 1, "qty", 2),
+		row.Of("id", 2, "qty", 1),
+		row.Of("id", 3, "qty", 5),
+		row.Of("id", 5, "qty", 3),
+		row.Of("id", 6, "qty", 1),
+	}
+	if got := collect(t, l); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect = %v; want %v", got, want)
+	}
+	wantPlan := strings.Join([]string{
+		"Select [id qty]",
+		"  Scan index[id] filter[note == nil || price > 9] columns[id qty]",
+		"",
+	}, "\n")
+	if got := explain(t, l); got != wantPlan {
+		t.Errorf("Explain =\n%s\nwant\n%s", got, wantPlan)
+	}
+
+	// Frames with duplicates keep them.
+	dups := godata.NewFrame(row.NewColumnIndexer("k"), godata.AllowDuplicates())
+	dups.Put(row.Of("k", 1, "v", 1))
+	dups.Put(row.Of("k", 1, "v", 2))
+	if got := collect(t, From(dups).Select()); !reflect.DeepEqual(got, []row.Data{row.Of("k", 1), row.Of("k", 1)}) {
+		t.Errorf("Collect = %v; want two rows", got)
+	}
+}
+
+func TestMultiColumnRange(t *testing.T) {
+	f := godata.NewFrame(row.NewColumnIndexer("user", "n"))
+	for user := 1; user <= 3; user++ {
+		for n := 1; n <= 5; n++ {
+			f.Put(row.Of("user", user, "n", n))
+		}
+	}
+	l := From(f).Filter(compile(`2 == user && n > 1.0 && n <= 3 && n < 5 && n != 2`))
+	want := []row.Data{row.Of("user", 2, "n", 3)}
+	if got := collect(t, l); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect = %v; want %v", got, want)
+	}
+	wantPlan := "Scan index[user n] range[2 == user && n > 1.0 && n <= 3] filter[n < 5 && n != 2]\n"
+	if got := explain(t, l); got != wantPlan {
+		t.Errorf("Explain =\n%s\nwant\n%s", got, wantPlan)
+	}
+
+	// Values of other types than the index do not bound the range.
+	l = From(f).Filter(compile(`user == "2" || user > 2.5`)).Filter(compile(`user > 2.5`))
+	if got := explain(t, l); got != "Scan index[user n] filter[(user == \"2\" || user > 2.5) && user > 2.5]\n" {
+		t.Errorf("Explain = %q", got)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	orders, customers := testFrames()
+	l := From(orders).
+		Join(From(customers), "customer").
+		Filter(compile(`customer < "c" && id >= 3 && region == "EU"`))
+	want := []row.Data{
+		row.Of("id", 3, "customer", "ann", "price", 3, "qty", 5, "region", "EU"),
+		row.Of("id", 6, "customer", "ann", "qty", 1, "region", "EU"),
+	}
+	if got := collect(t, l); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect = %v; want %v", got, want)
+	}
+	wantPlan := strings.Join([]string{
+		`Filter region == "EU"`,
+		"  Join on [customer]",
+		`    Scan index[id] range[id >= 3] filter[customer < "c"]`,
+		`    Scan index[customer] range[customer < "c"]`,
+		"",
+	}, "\n")
+	if got := explain(t, l); got != wantPlan {
+		t.Errorf("Explain =\n%s\nwant\n%s", got, wantPlan)
+	}
+
+	// Rows of the left Frame may be joined with several rows.
+	regions := godata.NewFrame(row.NewColumnIndexer("region", "customer"))
+	regions.Put(row.Of("region", "EU", "customer", "ann"))
+	regions.Put(row.Of("region", "EU", "customer", "dan"))
+	regions.Put(row.Of("region", "US", "customer", "bob"))
+	l = From(regions).Join(From(customers), "region").Select("customer")
+	got := collect(t, l)
+	if len(got) != 5 || got[0]["customer"] != "ann" || got[4]["customer"] != "bob" {
+		t.Errorf("Collect = %v; want 5 rows", got)
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	orders, customers := testFrames()
+	l := From(orders).
+		Join(From(customers), "customer").
+		GroupBy([]string{"region", "customer"},
+			Count("n"), Sum("price", "sum"), Mean("price", "mean"),
+			Min("qty", "min"), Max("note", "max")).
+		Filter(compile(`region == "EU" && n > 1`))
+	want := []row.Data{
+		row.Of("region", "EU", "customer", "ann", "n", 3, "sum", 13, "mean", 6.5, "min", 1, "max", "a"),
+	}
+	if got := collect(t, l); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect = %v; want %v", got, want)
+	}
+	wantPlan := strings.Join([]string{
+		"Filter n > 1",
+		"  GroupBy [region customer] count() as n, sum(price) as sum, mean(price) as mean, min(qty) as min, max(note) as max",
+		`    Filter region == "EU"`,
+		"      Join on [customer]",
+		"        Scan index[id] columns[customer id note price qty region]",
+		"        Scan index[customer] columns[customer note price qty region]",
+		"",
+	}, "\n")
+	if got := explain(t, l); got != wantPlan {
+		t.Errorf("Explain =\n%s\nwant\n%s", got, wantPlan)
+	}
+
+	got := collect(t, From(orders).GroupBy([]string{"customer"}, Sum("price", "sum")))
+	want = []row.Data{
+		row.Of("customer", "ann", "sum", 13),
+		row.Of("customer", "bob", "sum", 7.5),
+		row.Of("customer", "cat", "sum", 8),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect = %v; want %v", got, want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	orders, _ := testFrames()
+	for _, l := range []*LazyFrame{
+		From(orders).Filter(compile("price * 2")),
+		From(orders).Join(From(orders)),
+		From(orders).Join(From(orders).Filter(compile("1"))),
+		From(orders).GroupBy(nil, Count("n")),
+		From(orders).GroupBy([]string{"customer"}, Sum("", "x")),
+		From(orders).Filter(compile("note + 1 > 0")),
+		From(orders).GroupBy([]string{"customer"}, Sum("note", "x")),
+		From(orders).WithColumn("id", compile("nil")),
+	} {
+		if _, err := l.Collect(); err == nil {
+			t.Errorf("Collect succeeded for %v; want error", l.root)
+		}
+	}
+}
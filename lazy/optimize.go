@@ -0,0 +1,207 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lazy
+
+import (
+	"errors"
+
+	"github.com/google/godata"
+	"github.com/google/godata/expr"
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// optimize returns the plan with the filters pushed down and the columns
+// pruned. The plan is copied rather than modified.
+func optimize(n node) node {
+	return prune(pushDown(n, nil), nil)
+}
+
+// pushDown returns the plan of the node filtered by the conjuncts, with each
+// conjunct applied as far down as possible.
+func pushDown(n node, conjuncts []*expr.Expr) node {
+	// split splits the conjuncts into those that may be pushed below the
+	// node, and those that must stay above it.
+	split := func(below func(cols []string) bool) (down, here []*expr.Expr) {
+		for _, c := range conjuncts {
+			if below(c.Columns()) {
+				down = append(down, c)
+			} else {
+				here = append(here, c)
+			}
+		}
+		return down, here
+	}
+
+	switch n := n.(type) {
+	case *filter:
+		return pushDown(n.child, append(n.conjuncts[:len(n.conjuncts):len(n.conjuncts)], conjuncts...))
+	case *project:
+		down, here := split(func(cols []string) bool {
+			return subset(cols, n.columns)
+		})
+		return filtered(&project{child: pushDown(n.child, down), columns: n.columns}, here)
+	case *withColumn:
+		down, here := split(func(cols []string) bool {
+			return !contains(cols, n.column)
+		})
+		return filtered(&withColumn{child: pushDown(n.child, down), column: n.column, expr: n.expr}, here)
+	case *join:
+		// Conjuncts of the columns joined on hold for both rows joined, and
+		// the index columns of the left rows are never overwritten.
+		both, rest := split(func(cols []string) bool {
+			return subset(cols, n.on)
+		})
+		conjuncts = rest
+		left, here := split(func(cols []string) bool {
+			return subset(cols, n.left.index())
+		})
+		return filtered(&join{
+			left:  pushDown(n.left, append(both[:len(both):len(both)], left...)),
+			right: pushDown(n.right, both),
+			on:    n.on,
+		}, here)
+	case *group:
+		down, here := split(func(cols []string) bool {
+			return subset(cols, n.keys)
+		})
+		return filtered(&group{child: pushDown(n.child, down), keys: n.keys, aggs: n.aggs}, here)
+	case *scan:
+		s := &scan{frame: n.frame, columns: n.columns}
+		s.bound(conjuncts)
+		return s
+	}
+	return filtered(n, conjuncts)
+}
+
+// filtered returns the node filtered by the conjuncts.
+func filtered(n node, conjuncts []*expr.Expr) node {
+	if len(conjuncts) == 0 {
+		return n
+	}
+	return &filter{child: n, conjuncts: conjuncts}
+}
+
+// prune returns the plan of the node producing at least the required columns,
+// or every column if required is nil, and as few other columns as possible.
+func prune(n node, required []string) node {
+	// also returns the required columns and the given ones.
+	also := func(cols []string) []string {
+		if required == nil {
+			return nil
+		}
+		return union(required, cols)
+	}
+
+	switch n := n.(type) {
+	case *filter:
+		var cols []string
+		for _, c := range n.conjuncts {
+			cols = union(cols, c.Columns())
+		}
+		return &filter{child: prune(n.child, also(cols)), conjuncts: n.conjuncts}
+	case *project:
+		cols := n.columns
+		if required != nil {
+			cols = nil
+			for _, col := range n.columns {
+				if contains(required, col) {
+					cols = append(cols, col)
+				}
+			}
+			cols = union(cols, n.index())
+		}
+		return &project{child: prune(n.child, cols), columns: cols}
+	case *withColumn:
+		if required != nil && !contains(required, n.column) && !contains(n.index(), n.column) {
+			return prune(n.child, required)
+		}
+		var cols []string
+		if required != nil {
+			for _, col := range required {
+				if col != n.column {
+					cols = append(cols, col)
+				}
+			}
+			cols = union(cols, n.expr.Columns())
+		}
+		return &withColumn{child: prune(n.child, cols), column: n.column, expr: n.expr}
+	case *join:
+		cols := also(n.on)
+		return &join{left: prune(n.left, cols), right: prune(n.right, cols), on: n.on}
+	case *group:
+		return &group{child: prune(n.child, n.columns()), keys: n.keys, aggs: n.aggs}
+	case *scan:
+		s := *n
+		if required != nil {
+			s.columns = union(required, s.index())
+		}
+		return &s
+	}
+	return n
+}
+
+// bound sets the range of the scan to the range of the leading index columns
+// allowed by the conjuncts: equalities on a prefix of the columns, followed by
+// lower or upper bounds on the next column. The other conjuncts filter the rows
+// scanned.
+func (s *scan) bound(conjuncts []*expr.Expr) {
+	s.filters = conjuncts
+	columns := s.index()
+	if columns == nil || len(conjuncts) == 0 {
+		return
+	}
+
+	var (
+		constraints []value.Constraint
+		constrained []*expr.Expr
+	)
+	for _, c := range conjuncts {
+		if column, op, v, ok := c.Comparison(); ok {
+			constraints = append(constraints, value.Constraint{Column: column, Op: op, Value: v})
+			constrained = append(constrained, c)
+		}
+	}
+	var exact []bool
+	s.greaterOrEqual, s.lessThan, exact = value.IndexRange(columns, first(s.frame), constraints)
+	if s.greaterOrEqual == nil && s.lessThan == nil {
+		return
+	}
+
+	ranged := make(map[*expr.Expr]bool)
+	for i, c := range constrained {
+		ranged[c] = exact[i]
+	}
+	s.filters = nil
+	for _, c := range conjuncts {
+		if ranged[c] {
+			s.ranged = append(s.ranged, c)
+		} else {
+			s.filters = append(s.filters, c)
+		}
+	}
+}
+
+// errStop stops a ForEach.
+var errStop = errors.New("stop")
+
+// first returns the first row of the Frame, or nil if it is empty.
+func first(f *godata.Frame) row.Data {
+	var data row.Data
+	f.ForEach(func(d row.Data) error {
+		data = d
+		return errStop
+	})
+	return data
+}
@@ -0,0 +1,461 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lazy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/godata"
+	"github.com/google/godata/expr"
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// node is an operation of a plan. Nodes are not modified once built, since
+// they may be shared by several plans.
+type node interface {
+	// children returns the inputs of the operation.
+	children() []node
+
+	// index returns the index columns of the rows produced, or nil if they
+	// are not indexed by a ColumnIndexer.
+	index() []string
+
+	// empty returns an empty Frame for the rows produced.
+	empty() *godata.Frame
+
+	// run produces the rows, passing each of them to emit. Stops at the first
+	// error, which is returned. The rows passed to emit must not be modified.
+	run(emit func(row.Data) error) error
+
+	// describe describes the operation in one line.
+	describe() string
+}
+
+// scan produces the rows of a Frame in the range of the ranged conjuncts that
+// satisfy the conjuncts, keeping only the given columns.
+type scan struct {
+	frame *godata.Frame
+
+	// ranged are the conjuncts that bound the range of the scan, from
+	// greaterOrEqual to lessThan. They are still checked for the rows scanned.
+	ranged                   []*expr.Expr
+	greaterOrEqual, lessThan row.Data
+
+	// filters are the other conjuncts.
+	filters []*expr.Expr
+
+	// columns are the columns kept, or nil to keep every column.
+	columns []string
+}
+
+func (s *scan) children() []node {
+	return nil
+}
+
+func (s *scan) index() []string {
+	return row.IndexColumns(s.frame.Indexer())
+}
+
+func (s *scan) empty() *godata.Frame {
+	return s.frame.Empty()
+}
+
+func (s *scan) run(emit func(row.Data) error) error {
+	preds := predicates(append(s.ranged[:len(s.ranged):len(s.ranged)], s.filters...))
+	return forEach(s.frame, s.greaterOrEqual, s.lessThan, func(data row.Data) error {
+		ok, err := matches(preds, data)
+		if err != nil || !ok {
+			return err
+		}
+		if s.columns != nil {
+			data = keep(data, s.columns)
+		}
+		return emit(data)
+	})
+}
+
+func (s *scan) describe() string {
+	d := fmt.Sprintf("Scan index%v", s.index())
+	if len(s.ranged) > 0 {
+		d += fmt.Sprintf(" range[%s]", conjunction(s.ranged))
+	}
+	if len(s.filters) > 0 {
+		d += fmt.Sprintf(" filter[%s]", conjunction(s.filters))
+	}
+	if s.columns != nil {
+		d += fmt.Sprintf(" columns%v", sorted(s.columns))
+	}
+	return d
+}
+
+// forEach calls the action for each row of the Frame in the range. Either
+// bound may be nil.
+func forEach(f *godata.Frame, ge, lt row.Data, action func(row.Data) error) error {
+	switch {
+	case ge != nil && lt != nil:
+		return f.ForEach(action, godata.GreaterOrEqual(ge), godata.LessThan(lt))
+	case ge != nil:
+		return f.ForEach(action, godata.GreaterOrEqual(ge))
+	case lt != nil:
+		return f.ForEach(action, godata.LessThan(lt))
+	}
+	return f.ForEach(action)
+}
+
+// filter produces the rows of its child that satisfy the conjuncts.
+type filter struct {
+	child     node
+	conjuncts []*expr.Expr
+}
+
+func (f *filter) children() []node {
+	return []node{f.child}
+}
+
+func (f *filter) index() []string {
+	return f.child.index()
+}
+
+func (f *filter) empty() *godata.Frame {
+	return f.child.empty()
+}
+
+func (f *filter) run(emit func(row.Data) error) error {
+	preds := predicates(f.conjuncts)
+	return f.child.run(func(data row.Data) error {
+		ok, err := matches(preds, data)
+		if err != nil || !ok {
+			return err
+		}
+		return emit(data)
+	})
+}
+
+func (f *filter) describe() string {
+	return "Filter " + conjunction(f.conjuncts)
+}
+
+// project produces the given columns of the rows of its child.
+type project struct {
+	child   node
+	columns []string
+}
+
+func (p *project) children() []node {
+	return []node{p.child}
+}
+
+func (p *project) index() []string {
+	return p.child.index()
+}
+
+func (p *project) empty() *godata.Frame {
+	return p.child.empty()
+}
+
+func (p *project) run(emit func(row.Data) error) error {
+	return p.child.run(func(data row.Data) error {
+		return emit(keep(data, p.columns))
+	})
+}
+
+func (p *project) describe() string {
+	return fmt.Sprintf("Select %v", sorted(p.columns))
+}
+
+// withColumn produces the rows of its child with the column set to the value
+// of the expression.
+type withColumn struct {
+	child  node
+	column string
+	expr   *expr.Expr
+}
+
+func (w *withColumn) children() []node {
+	return []node{w.child}
+}
+
+func (w *withColumn) index() []string {
+	return w.child.index()
+}
+
+func (w *withColumn) empty() *godata.Frame {
+	return w.child.empty()
+}
+
+func (w *withColumn) run(emit func(row.Data) error) error {
+	return w.child.run(func(data row.Data) error {
+		v, err := w.expr.Eval(data)
+		if err != nil {
+			return err
+		}
+		data = data.Copy()
+		if v == nil {
+			delete(data, w.column)
+		} else {
+			data[w.column] = v
+		}
+		return emit(data)
+	})
+}
+
+func (w *withColumn) describe() string {
+	return fmt.Sprintf("WithColumn %s = %v", w.column, w.expr)
+}
+
+// join produces the rows of its left child merged with each row of its right
+// child with equal values of the columns joined on.
+type join struct {
+	left, right node
+	on          []string
+}
+
+func (j *join) children() []node {
+	return []node{j.left, j.right}
+}
+
+func (j *join) index() []string {
+	return j.left.index()
+}
+
+func (j *join) empty() *godata.Frame {
+	return godata.NewFrame(j.left.empty().Indexer(), godata.AllowDuplicates())
+}
+
+// key returns the value.Key of the columns joined on, or false if one of them
+// is nil.
+func (j *join) key(data row.Data) (string, bool) {
+	vals := make([]interface{}, len(j.on))
+	for i, col := range j.on {
+		if vals[i] = data[col]; vals[i] == nil {
+			return "", false
+		}
+	}
+	return value.Key(vals), true
+}
+
+func (j *join) run(emit func(row.Data) error) error {
+	lookup := make(map[string][]row.Data)
+	err := j.right.run(func(data row.Data) error {
+		if k, ok := j.key(data); ok {
+			lookup[k] = append(lookup[k], data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return j.left.run(func(data row.Data) error {
+		k, ok := j.key(data)
+		if !ok {
+			return nil
+		}
+		for _, right := range lookup[k] {
+			joined := right.Copy()
+			for col, v := range data {
+				joined[col] = v
+			}
+			if err := emit(joined); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (j *join) describe() string {
+	return fmt.Sprintf("Join on %v", j.on)
+}
+
+// group produces a row of the keys and aggregations of each group of the rows
+// of its child with equal keys.
+type group struct {
+	child node
+	keys  []string
+	aggs  []Aggregation
+}
+
+func (g *group) children() []node {
+	return []node{g.child}
+}
+
+func (g *group) index() []string {
+	return g.keys
+}
+
+func (g *group) empty() *godata.Frame {
+	return godata.NewFrame(row.NewColumnIndexer(g.keys...))
+}
+
+// columns returns the key columns and the columns aggregated.
+func (g *group) columns() []string {
+	cols := g.keys
+	for _, agg := range g.aggs {
+		if agg.column != "" {
+			cols = union(cols, []string{agg.column})
+		}
+	}
+	return cols
+}
+
+func (g *group) run(emit func(row.Data) error) error {
+	type state struct {
+		keys row.Data
+		accs []*value.Accumulator
+	}
+	var (
+		groups = make(map[string]*state)
+		order  []*state
+	)
+	err := g.child.run(func(data row.Data) error {
+		vals := make([]interface{}, len(g.keys))
+		for i, col := range g.keys {
+			if vals[i] = data[col]; vals[i] == nil {
+				return nil
+			}
+		}
+		k := value.Key(vals)
+		s, ok := groups[k]
+		if !ok {
+			s = &state{keys: keep(data, g.keys), accs: make([]*value.Accumulator, len(g.aggs))}
+			for i, agg := range g.aggs {
+				s.accs[i] = &value.Accumulator{Op: agg.op}
+			}
+			groups[k] = s
+			order = append(order, s)
+		}
+		for i, agg := range g.aggs {
+			// Count counts rows rather than values.
+			var v interface{} = true
+			if agg.op != value.Count {
+				v = data[agg.column]
+			}
+			if err := s.accs[i].Add(v); err != nil {
+				return fmt.Errorf("%v: %v", agg, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range order {
+		data := s.keys
+		for i, agg := range g.aggs {
+			if v := s.accs[i].Result(); v != nil {
+				data[agg.as] = v
+			}
+		}
+		if err := emit(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *group) describe() string {
+	aggs := make([]string, len(g.aggs))
+	for i, agg := range g.aggs {
+		aggs[i] = agg.String()
+	}
+	d := fmt.Sprintf("GroupBy %v", g.keys)
+	if len(aggs) > 0 {
+		d += " " + strings.Join(aggs, ", ")
+	}
+	return d
+}
+
+// predicates returns the Predicates of the conjuncts, which are boolean.
+func predicates(conjuncts []*expr.Expr) []godata.Predicate {
+	preds := make([]godata.Predicate, len(conjuncts))
+	for i, c := range conjuncts {
+		preds[i], _ = c.Predicate()
+	}
+	return preds
+}
+
+// matches returns true if the row satisfies every Predicate.
+func matches(preds []godata.Predicate, data row.Data) (bool, error) {
+	for _, pred := range preds {
+		if ok, err := pred(data); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// conjunction formats the conjuncts joined by &&.
+func conjunction(conjuncts []*expr.Expr) string {
+	s := make([]string, len(conjuncts))
+	for i, c := range conjuncts {
+		s[i] = c.String()
+		if len(conjuncts) > 1 && strings.Contains(s[i], "||") {
+			s[i] = "(" + s[i] + ")"
+		}
+	}
+	return strings.Join(s, " && ")
+}
+
+// keep returns a copy of the row with only the given columns.
+func keep(data row.Data, columns []string) row.Data {
+	kept := make(row.Data, len(columns))
+	for _, col := range columns {
+		if v, ok := data[col]; ok {
+			kept[col] = v
+		}
+	}
+	return kept
+}
+
+// union returns the columns of a followed by the columns of b that are not in
+// a.
+func union(a, b []string) []string {
+	cols := append([]string(nil), a...)
+	for _, col := range b {
+		if !contains(cols, col) {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// contains returns true if the column is one of the columns.
+func contains(columns []string, column string) bool {
+	for _, col := range columns {
+		if col == column {
+			return true
+		}
+	}
+	return false
+}
+
+// subset returns true if every column of a is one of the columns of b.
+func subset(a, b []string) bool {
+	for _, col := range a {
+		if !contains(b, col) {
+			return false
+		}
+	}
+	return true
+}
+
+// sorted returns a sorted copy of the columns.
+func sorted(columns []string) []string {
+	s := append([]string(nil), columns...)
+	sort.Strings(s)
+	return s
+}
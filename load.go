@@ -0,0 +1,157 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"sort"
+
+	"github.com/google/godata/row"
+)
+
+// AllOrNothing returns an option for PutAll and NewBuilder. If any row cannot
+// be indexed, then no rows are added. The option has no effect on NewFrame.
+func AllOrNothing() frameArg {
+	return func(opts *frameOptions) {
+		opts.allOrNothing = true
+	}
+}
+
+// indexedRow is a row that has been indexed by a Frame but not yet added to it.
+type indexedRow struct {
+	row.Row
+
+	// keys contains the index of the row in each secondary index.
+	keys map[string]row.Index
+
+	// pos is the position of the row among the rows given to PutAll.
+	pos int
+}
+
+// byIndex sorts indexed rows by index, and rows with the same index by
+// position, so that the last of them is inserted last.
+type byIndex []indexedRow
+
+func (b byIndex) Len() int      { return len(b) }
+func (b byIndex) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byIndex) Less(i, j int) bool {
+	if b[i].Index.Less(b[j].Index) {
+		return true
+	}
+	return !b[j].Index.Less(b[i].Index) && b[i].pos < b[j].pos
+}
+
+// sortedBatch is the number of rows from which PutAll sorts the rows before
+// inserting them. Inserting rows in index order walks the btree in order,
+// which saves more cache misses than the sort costs once the btree no longer
+// fits in cache. In BenchmarkPutAll, loading 1e6 shuffled rows takes 1.8µs per
+// row sorted against 2.9µs with Put, but sorting 1e4 rows is 25% slower than
+// not sorting them, and breaks even between 1e5 and 2e5 rows.
+const sortedBatch = 1 << 17
+
+// PutAll inserts each of the rows into the Frame as if by Put, in order. All
+// rows are indexed before the Frame is modified. Large batches are then
+// inserted in index order, which walks the btree in order and is faster than
+// Put for shuffled rows (see sortedBatch). Returns an ErrRows listing the
+// position of every row that cannot be indexed. The other rows are still added
+// unless the AllOrNothing option is given.
+func (f *Frame) PutAll(rows []row.Data, args ...frameArg) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	opts := frameArgsToOptions(args)
+
+	var (
+		indexed = make([]indexedRow, 0, len(rows))
+		errs    ErrRows
+	)
+	for i, data := range rows {
+		index, keys, err := f.index(data)
+		if err != nil {
+			errs = append(errs, &ErrRow{
+				Position: i,
+				Data:     data,
+				Err:      err,
+			})
+			continue
+		}
+		indexed = append(indexed, indexedRow{
+			Row: row.Row{
+				Index: index,
+				Data:  f.in(data),
+			},
+			keys: keys,
+			pos:  i,
+		})
+	}
+	if errs != nil && opts.allOrNothing {
+		return errs
+	}
+
+	// Sequence numbers are assigned in input order, so that the sort below
+	// preserves insertion order among duplicates.
+	if f.duplicates {
+		for i := range indexed {
+			f.seq++
+			indexed[i].Index = sequencedIndex{index: indexed[i].Index, seq: f.seq}
+		}
+	}
+	if len(indexed) >= sortedBatch && !sort.IsSorted(byIndex(indexed)) {
+		sort.Sort(byIndex(indexed))
+	}
+	for _, r := range indexed {
+		f.insert(r.Row, r.keys)
+		f.own(r.Data)
+	}
+
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// Builder accumulates rows and builds a Frame from them with PutAll.
+type Builder struct {
+	indexer row.Indexer
+	args    []frameArg
+	rows    []row.Data
+}
+
+// NewBuilder returns a Builder for a Frame with the given indexer and options.
+func NewBuilder(indexer row.Indexer, args ...frameArg) *Builder {
+	return &Builder{
+		indexer: indexer,
+		args:    args,
+		rows:    make([]row.Data, 0, frameArgsToOptions(args).sizeHint),
+	}
+}
+
+// Add adds the given rows to the Builder. Rows are not indexed until Frame is
+// called, and their positions in any ErrRows are given by the order in which
+// they were added.
+func (b *Builder) Add(data ...row.Data) {
+	b.rows = append(b.rows, data...)
+}
+
+// Frame returns a new Frame containing the rows added to the Builder. Returns
+// an ErrRows if any row cannot be indexed, in which case the Frame contains the
+// other rows unless the Builder was given the AllOrNothing option. In that case
+// the returned Frame is nil.
+func (b *Builder) Frame() (*Frame, error) {
+	f := NewFrame(b.indexer, b.args...)
+	err := f.PutAll(b.rows, b.args...)
+	if err != nil && frameArgsToOptions(b.args).allOrNothing {
+		return nil, err
+	}
+	return f, err
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+func TestPutAll(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	err := f.PutAll([]row.Data{
+		row.Of("i", 3, "data", "c"),
+		row.Of("data", "missing"),
+		row.Of("i", 1, "data", "a"),
+		row.Of("i", 3, "data", "d"),
+		row.Of("j", 2),
+	})
+	errs, ok := err.(ErrRows)
+	if !ok {
+		t.Fatalf("PutAll = %v; want ErrRows", err)
+	}
+	if len(errs) != 2 || errs[0].Position != 1 || errs[1].Position != 4 {
+		t.Errorf("PutAll = %v; want errors at positions 1 and 4", errs)
+	}
+
+	rows, err := f.GetRange()
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["data"] != "a" || rows[1]["data"] != "d" {
+		t.Errorf("GetRange = %v; want a and the last row for 3", rows)
+	}
+}
+
+func TestPutAllSorted(t *testing.T) {
+	// The batch is large enough to be sorted, and each index is put twice, in
+	// reverse order, so the later row must win.
+	data := make([]row.Data, 0, sortedBatch)
+	for pass := 0; pass < 2; pass++ {
+		for i := sortedBatch/2 - 1; i >= 0; i-- {
+			data = append(data, row.Of("i", i, "pass", pass))
+		}
+	}
+	f := NewFrame(row.NewColumnIndexer("i"))
+	if err := f.PutAll(data); err != nil {
+		t.Fatalf("PutAll: %v", err)
+	}
+	if f.Len() != sortedBatch/2 {
+		t.Errorf("Len = %d; want %d", f.Len(), sortedBatch/2)
+	}
+	if got, _ := f.Get(row.Of("i", 7)); got["pass"] != 1 {
+		t.Errorf("Get = %v; want the row of pass 1", got)
+	}
+
+	dup := NewFrame(row.NewColumnIndexer("i"), AllowDuplicates())
+	if err := dup.PutAll(data); err != nil {
+		t.Fatalf("PutAll: %v", err)
+	}
+	if got, _ := dup.GetAll(row.Of("i", 7)); len(got) != 2 || got[0]["pass"] != 0 || got[1]["pass"] != 1 {
+		t.Errorf("GetAll = %v; want the rows of both passes in order", got)
+	}
+}
+
+func TestPutAllOrNothing(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	err := f.PutAll([]row.Data{
+		row.Of("i", 1),
+		row.Of("j", 2),
+	}, AllOrNothing())
+	if err == nil {
+		t.Fatalf("PutAll succeeded; want error")
+	}
+	if rows, _ := f.GetRange(); rows != nil {
+		t.Errorf("GetRange = %v; want no rows", rows)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(row.NewColumnIndexer("user"), AllowDuplicates())
+	b.Add(row.Of("user", 2, "event", "a"), row.Of("user", 1, "event", "b"))
+	b.Add(row.Of("user", 2, "event", "c"))
+	f, err := b.Frame()
+	if err != nil {
+		t.Fatalf("Frame: %v", err)
+	}
+
+	rows, err := f.GetRange()
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	var events []interface{}
+	for _, r := range rows {
+		events = append(events, r["event"])
+	}
+	if len(events) != 3 || events[0] != "b" || events[1] != "a" || events[2] != "c" {
+		t.Errorf("GetRange = %v; want events b, a, c", events)
+	}
+
+	b = NewBuilder(row.NewColumnIndexer("user"), AllOrNothing())
+	b.Add(row.Of("event", "d"))
+	if f, err := b.Frame(); f != nil || err == nil {
+		t.Errorf("Frame = %v, %v; want nil Frame and error", f, err)
+	}
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/btree"
+	"github.com/google/godata/row"
+)
+
+// JoinMode selects the rows of a join for indices that are missing from one of
+// the joined Frames.
+type JoinMode int
+
+const (
+	// InnerJoin joins only the indices present in both Frames.
+	InnerJoin JoinMode = iota
+
+	// LeftJoin also joins the indices present only in the left Frame.
+	LeftJoin
+
+	// RightJoin also joins the indices present only in the right Frame.
+	RightJoin
+
+	// OuterJoin joins the indices present in either Frame, like Joined.
+	OuterJoin
+)
+
+var joinModeNames = []string{"InnerJoin", "LeftJoin", "RightJoin", "OuterJoin"}
+
+func (m JoinMode) String() string {
+	if m < 0 || int(m) >= len(joinModeNames) {
+		return fmt.Sprintf("JoinMode(%d)", int(m))
+	}
+	return joinModeNames[m]
+}
+
+// cursorBatch is the number of rows a cursor reads from the btree at a time.
+const cursorBatch = 256
+
+// cursor walks the rows of a Frame in index order. The btree only supports
+// iteration by callback, so rows are read in batches, each resuming after the
+// last row of the previous batch, which allows two Frames to be walked in
+// lockstep.
+type cursor struct {
+	f *Frame
+
+	// end is the pivot that the rows walked are less than, or nil.
+	end btree.Item
+
+	buf  []row.Row
+	pos  int
+	done bool
+}
+
+// newCursor returns a cursor positioned at the first row of the Frame in the
+// range.
+func (f *Frame) newCursor(opts *rangeOptions) (*cursor, error) {
+	c := &cursor{f: f, buf: make([]row.Row, 0, cursorBatch)}
+	var begin btree.Item
+	if opts.greaterOrEqual != nil {
+		index, err := f.indexer.Index(opts.greaterOrEqual)
+		if err != nil {
+			return nil, err
+		}
+		begin = f.pivot(index)
+	}
+	if opts.lessThan != nil {
+		index, err := f.indexer.Index(opts.lessThan)
+		if err != nil {
+			return nil, err
+		}
+		c.end = f.pivot(index)
+	}
+	c.load(begin, false)
+	return c, nil
+}
+
+// load reads the next batch of rows, starting at the given item or after it,
+// or at the first row if the item is nil.
+func (c *cursor) load(from btree.Item, after bool) {
+	c.buf, c.pos = c.buf[:0], 0
+	iterator := func(item btree.Item) bool {
+		if c.end != nil && !item.Less(c.end) {
+			return false
+		}
+		if after && !from.Less(item) {
+			return true
+		}
+		c.buf = append(c.buf, item.(row.Row))
+		return len(c.buf) < cursorBatch
+	}
+	if from == nil {
+		c.f.bt.Ascend(iterator)
+	} else {
+		c.f.bt.AscendGreaterOrEqual(from, iterator)
+	}
+	c.done = len(c.buf) < cursorBatch
+}
+
+// valid returns true unless the cursor is past the last row.
+func (c *cursor) valid() bool {
+	return c.pos < len(c.buf)
+}
+
+// row returns the current row.
+func (c *cursor) row() row.Row {
+	return c.buf[c.pos]
+}
+
+// data returns the data of the current row, copied if the Frame shares it with
+// a clone.
+func (c *cursor) data() row.Data {
+	return c.f.out(c.buf[c.pos].Data)
+}
+
+// index returns the index of the current row.
+func (c *cursor) index() row.Index {
+	return unsequenced(c.buf[c.pos].Index)
+}
+
+// next moves the cursor to the next row.
+func (c *cursor) next() {
+	c.pos++
+	if c.pos == len(c.buf) && !c.done {
+		c.load(c.buf[c.pos-1], true)
+	}
+}
+
+// seek moves the cursor forward to the first row with an index greater than or
+// equal to the given index.
+func (c *cursor) seek(index row.Index) {
+	pivot := c.f.pivot(index)
+	if !c.valid() || !c.row().Less(pivot) {
+		return
+	}
+	if last := c.buf[len(c.buf)-1]; last.Less(pivot) && !c.done {
+		c.load(pivot, false)
+		return
+	}
+	c.pos += sort.Search(len(c.buf)-c.pos, func(i int) bool {
+		return !c.buf[c.pos+i].Less(pivot)
+	})
+}
+
+// run returns the rows from the current one that share its index, and moves
+// the cursor past them.
+func (c *cursor) run() (row.Index, []row.Data) {
+	index := c.index()
+	var rows []row.Data
+	for c.valid() && !index.Less(c.index()) {
+		rows = append(rows, c.data())
+		c.next()
+	}
+	return index, rows
+}
+
+// unsequenced returns the index of a row without its sequence number.
+func unsequenced(index row.Index) row.Index {
+	if s, ok := index.(sequencedIndex); ok {
+		return s.index
+	}
+	return index
+}
+
+// MergeJoin walks the rows of the Frame and the given Frame in the given range
+// in lockstep, and calls the action for each pair of rows that share an index,
+// in index order. Depending on the mode, the action is also called for rows
+// whose index is missing from the other Frame, with nil for the missing row.
+// If several rows of either Frame share an index, then the action is called
+// for every pair of them, in insertion order. The indices of the Frames must
+// be comparable. Stops at the first error returned by the action, which is
+// returned. See GetRange for details on the range arguments, which are
+// indexed by each Frame's own indexer.
+//
+// Since both Frames are walked in order, the join takes time linear in the
+// number of rows in the range, and skips ahead in one Frame over runs of rows
+// missing from the other unless the mode joins them.
+func (f *Frame) MergeJoin(frame *Frame, mode JoinMode, action func(left, right row.Data) error, args ...rangeArg) error {
+	return f.mergeJoin(frame, mode, rangeArgsToOptions(args), func(_ row.Index, left, right row.Data) error {
+		return action(left, right)
+	})
+}
+
+// mergeJoin is MergeJoin, passing the action the index of the rows joined.
+func (f *Frame) mergeJoin(frame *Frame, mode JoinMode, opts *rangeOptions, action func(index row.Index, left, right row.Data) error) error {
+	l, err := f.newCursor(opts)
+	if err != nil {
+		return err
+	}
+	r, err := frame.newCursor(opts)
+	if err != nil {
+		return err
+	}
+	keepLeft := mode == LeftJoin || mode == OuterJoin
+	keepRight := mode == RightJoin || mode == OuterJoin
+
+	for l.valid() || r.valid() {
+		switch {
+		case !r.valid() || l.valid() && l.index().Less(r.index()):
+			if !keepLeft {
+				if !r.valid() {
+					return nil
+				}
+				l.seek(r.index())
+				continue
+			}
+			if err := action(l.index(), l.data(), nil); err != nil {
+				return err
+			}
+			l.next()
+		case !l.valid() || r.index().Less(l.index()):
+			if !keepRight {
+				if !l.valid() {
+					return nil
+				}
+				r.seek(l.index())
+				continue
+			}
+			if err := action(r.index(), nil, r.data()); err != nil {
+				return err
+			}
+			r.next()
+		default:
+			index, lefts := l.run()
+			_, rights := r.run()
+			for _, left := range lefts {
+				for _, right := range rights {
+					if err := action(index, left, right); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// MergeJoined returns a new Frame like Joined, containing a JoinResult for each
+// column of the rows joined by MergeJoin with the given mode and range. Unlike
+// Joined, which looks up each row of the right Frame in the result, the Frames
+// are joined in a single pass over both. If either Frame allows duplicates,
+// then every pair of rows sharing an index is joined, and the returned Frame
+// allows duplicates.
+func (f *Frame) MergeJoined(frame *Frame, mode JoinMode, args ...rangeArg) (*Frame, error) {
+	var nfArgs []frameArg
+	if f.duplicates || frame.duplicates {
+		nfArgs = append(nfArgs, AllowDuplicates())
+	}
+	nf := NewFrame(JoinResultIndexer{f.indexer}, nfArgs...)
+
+	err := f.mergeJoin(frame, mode, rangeArgsToOptions(args), func(index row.Index, left, right row.Data) error {
+		joined := make(row.Data, len(left)+len(right))
+		for col, val := range left {
+			joined[col] = &JoinResult{Left: val}
+		}
+		for col, val := range right {
+			if jr, ok := joined[col].(*JoinResult); ok {
+				jr.Right = val
+			} else {
+				joined[col] = &JoinResult{Right: val}
+			}
+		}
+		// The rows joined are already indexed, and are added in index
+		// order.
+		if nf.duplicates {
+			nf.seq++
+			index = sequencedIndex{index: index, seq: nf.seq}
+		}
+		nf.bt.ReplaceOrInsert(row.Row{Index: index, Data: joined})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nf, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+// mergeJoinPairs returns the pairs of values of column "v" joined by MergeJoin,
+// with "-" for missing rows.
+func mergeJoinPairs(t *testing.T, left, right *Frame, mode JoinMode, args ...rangeArg) []string {
+	t.Helper()
+	var pairs []string
+	err := left.MergeJoin(right, mode, func(l, r row.Data) error {
+		lv, rv := interface{}("-"), interface{}("-")
+		if l != nil {
+			lv = l["v"]
+		}
+		if r != nil {
+			rv = r["v"]
+		}
+		pairs = append(pairs, fmt.Sprintf("%v:%v", lv, rv))
+		return nil
+	}, args...)
+	if err != nil {
+		t.Fatalf("MergeJoin(%v): %v", mode, err)
+	}
+	return pairs
+}
+
+func TestMergeJoin(t *testing.T) {
+	left := NewFrame(row.NewColumnIndexer("k"), AllowDuplicates())
+	right := NewFrame(row.NewColumnIndexer("k"))
+	left.Put(row.Of("k", 1, "v", "a"))
+	left.Put(row.Of("k", 2, "v", "b1"))
+	left.Put(row.Of("k", 2, "v", "b2"))
+	left.Put(row.Of("k", 4, "v", "d"))
+	right.Put(row.Of("k", 0, "v", "Z"))
+	right.Put(row.Of("k", 2, "v", "B"))
+	right.Put(row.Of("k", 3, "v", "C"))
+	right.Put(row.Of("k", 4, "v", "D"))
+
+	tests := []struct {
+		mode JoinMode
+		args []rangeArg
+		want []string
+	}{
+		{InnerJoin, nil, []string{"b1:B", "b2:B", "d:D"}},
+		{LeftJoin, nil, []string{"a:-", "b1:B", "b2:B", "d:D"}},
+		{RightJoin, nil, []string{"-:Z", "b1:B", "b2:B", "-:C", "d:D"}},
+		{OuterJoin, nil, []string{"-:Z", "a:-", "b1:B", "b2:B", "-:C", "d:D"}},
+		{OuterJoin, []rangeArg{GreaterOrEqual(row.Of("k", 1)), LessThan(row.Of("k", 4))}, []string{"a:-", "b1:B", "b2:B", "-:C"}},
+		{InnerJoin, []rangeArg{GreaterOrEqual(row.Of("k", 3))}, []string{"d:D"}},
+		{RightJoin, []rangeArg{LessThan(row.Of("k", 2))}, []string{"-:Z"}},
+	}
+	for _, test := range tests {
+		if got := mergeJoinPairs(t, left, right, test.mode, test.args...); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("MergeJoin(%v) = %v; want %v", test.mode, got, test.want)
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := left.MergeJoin(right, OuterJoin, func(l, r row.Data) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("MergeJoin = %v after %d calls; want stop after 1", err, calls)
+	}
+
+	joined, err := left.MergeJoined(right, LeftJoin)
+	if err != nil {
+		t.Fatalf("MergeJoined: %v", err)
+	}
+	rows, _ := joined.GetAll(row.Of("k", 2))
+	if len(rows) != 2 || rows[1]["v"].(*JoinResult).Left != "b2" || rows[1]["v"].(*JoinResult).Right != "B" {
+		t.Errorf("MergeJoined.GetAll(2) = %v; want b1 and b2 joined with B", rows)
+	}
+	if joined.Len() != 4 {
+		t.Errorf("MergeJoined.Len() = %d; want 4", joined.Len())
+	}
+}
+
+func TestMergeJoinedMatchesJoined(t *testing.T) {
+	// The Frames span several cursor batches, and are sparse in places so
+	// that InnerJoin seeks past runs of rows.
+	left := NewFrame(row.NewColumnIndexer("i", "s"))
+	right := NewFrame(row.NewColumnIndexer("i", "s"))
+	for i := 0; i < 2000; i++ {
+		if i%3 != 0 || i > 1500 {
+			left.Put(row.Of("i", i/2, "s", fmt.Sprint(i%2), "l", i))
+		}
+		if i%5 == 0 || i < 100 {
+			right.Put(row.Of("i", i/2, "s", fmt.Sprint(i%2), "r", i))
+		}
+	}
+
+	want, err := left.Joined(right)
+	if err != nil {
+		t.Fatalf("Joined: %v", err)
+	}
+	got, err := left.MergeJoined(right, OuterJoin)
+	if err != nil {
+		t.Fatalf("MergeJoined: %v", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("MergeJoined differs from Joined: got %d rows, want %d", got.Len(), want.Len())
+	}
+
+	inner, err := left.MergeJoined(right, InnerJoin)
+	if err != nil {
+		t.Fatalf("MergeJoined: %v", err)
+	}
+	n := 0
+	want.ForEach(func(data row.Data) error {
+		if jr := data["i"].(*JoinResult); jr.Left != nil && jr.Right != nil {
+			n++
+		}
+		return nil
+	})
+	if inner.Len() != n {
+		t.Errorf("MergeJoined(InnerJoin).Len() = %d; want %d", inner.Len(), n)
+	}
+}
+
+// benchmarkJoin runs the join of two Frames of the smaller benchmark sizes,
+// since Joined takes seconds for a million rows.
+func benchmarkJoin(b *testing.B, join func(left, right *Frame) (*Frame, error)) {
+	for _, size := range benchmarkSizes[:2] {
+		b.Run(fmt.Sprintf("rows=%d", size), func(b *testing.B) {
+			left := benchmarkFrame(b, size)
+			right := benchmarkFrame(b, size)
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := join(left, right); err != nil {
+					b.Fatalf("join: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkJoined(b *testing.B) {
+	benchmarkJoin(b, (*Frame).Joined)
+}
+
+func BenchmarkMergeJoined(b *testing.B) {
+	benchmarkJoin(b, func(left, right *Frame) (*Frame, error) {
+		return left.MergeJoined(right, OuterJoin)
+	})
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/btree"
+	"github.com/google/godata/group"
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// minPartition is the fewest rows grouped by a worker at a time, so that small
+// Frames are not split into partitions that cost more to merge than to group.
+const minPartition = 4096
+
+// partialGroup is a group of the rows of a partition of a Frame.
+type partialGroup struct {
+	index row.Index
+
+	// keys contains the index columns of the first row of the group.
+	keys row.Data
+
+	// members contains the rows of the group in index order, if kept.
+	members group.Group
+
+	accs map[string]*value.Accumulator
+}
+
+// Less returns true if the group is less than the given *partialGroup.
+func (g *partialGroup) Less(item btree.Item) bool {
+	return g.index.Less(item.(*partialGroup).index)
+}
+
+// merge adds the rows of a group with the same index that follows the group
+// in index order.
+func (g *partialGroup) merge(other *partialGroup) {
+	g.members = append(g.members, other.members...)
+	for col, acc := range g.accs {
+		acc.Merge(other.accs[col])
+	}
+}
+
+// ParallelGroupBy returns a new Frame like GroupBy, without subgroups. The rows
+// of the Frame are split into contiguous ranges of its index, each of which is
+// walked and grouped by one of a pool of as many workers as GOMAXPROCS, and the
+// groups of the partitions are then merged in index order, so that the result
+// is the same as that of GroupBy regardless of scheduling. Frames that are not
+// indexed by a ColumnIndexer on ints or strings are grouped by a single worker.
+// The indexer is called concurrently by the workers.
+func (f *Frame) ParallelGroupBy(indexer row.Indexer) (*Frame, error) {
+	groups, err := f.parallelGroups(indexer, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	nf := NewFrame(group.Indexer{RowIndexer: indexer}, SizeHint(groups.Len()))
+	groups.Ascend(func(item btree.Item) bool {
+		g := item.(*partialGroup)
+		data := g.keys
+		data[group.Column] = g.members
+		nf.bt.ReplaceOrInsert(row.Row{Index: g.index, Data: data})
+		return true
+	})
+	return nf, nil
+}
+
+// ParallelAggregate returns a new Frame with the given indexer, containing a
+// row for each group of the Frame by the indexer, with its index columns and
+// its aggregates keyed by column, like GroupView.Frame. The aggregates are
+// computed by a pool of workers like ParallelGroupBy, each of which aggregates
+// a partition of the rows, and the partial aggregates are then merged in index
+// order, so that the result does not depend on scheduling. Returns the error
+// of the first row in index order that cannot be indexed or aggregated.
+func (f *Frame) ParallelAggregate(indexer row.Indexer, aggs map[string]group.Incremental) (*Frame, error) {
+	groups, err := f.parallelGroups(indexer, aggs, false)
+	if err != nil {
+		return nil, err
+	}
+	nf := NewFrame(indexer, SizeHint(groups.Len()))
+	groups.Ascend(func(item btree.Item) bool {
+		g := item.(*partialGroup)
+		data := g.keys
+		for col, acc := range g.accs {
+			data[col] = acc.Result()
+		}
+		nf.bt.ReplaceOrInsert(row.Row{Index: g.index, Data: data})
+		return true
+	})
+	return nf, nil
+}
+
+// parallelGroups returns a btree of the *partialGroups of the rows of the Frame
+// by the indexer, with the given aggregates, and with their members if kept.
+func (f *Frame) parallelGroups(indexer row.Indexer, aggs map[string]group.Incremental, members bool) (*btree.BTree, error) {
+	workers := runtime.GOMAXPROCS(0)
+	size := (f.Len() + workers - 1) / workers
+	if size < minPartition {
+		size = minPartition
+	}
+	pivots := f.partitionPivots((f.Len() + size - 1) / size)
+	n := len(pivots) + 1
+	var (
+		parts = make([]*btree.BTree, n)
+		errs  = make([]error, n)
+		next  int64
+		wg    sync.WaitGroup
+	)
+	if workers > n {
+		workers = n
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1) - 1)
+				if i >= n {
+					return
+				}
+				var lo, hi btree.Item
+				if i > 0 {
+					lo = pivots[i-1]
+				}
+				if i < len(pivots) {
+					hi = pivots[i]
+				}
+				parts[i], errs[i] = f.partition(lo, hi, indexer, aggs, members)
+			}
+		}()
+	}
+	wg.Wait()
+
+	groups := btree.New(DefaultDegree)
+	for i, part := range parts {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		part.Ascend(func(item btree.Item) bool {
+			if got := groups.Get(item); got != nil {
+				got.(*partialGroup).merge(item.(*partialGroup))
+			} else {
+				groups.ReplaceOrInsert(item)
+			}
+			return true
+		})
+	}
+	return groups, nil
+}
+
+// partitionPivots returns up to n-1 increasing pivots that split the btree into
+// n contiguous partitions, so that each worker walks its own partition rather
+// than the rows being gathered first. The pivots interpolate the first index
+// column between its values in the least and greatest rows, so partitions hold
+// similar numbers of rows if the values are evenly spread. Returns no pivots
+// unless the Frame is indexed by a ColumnIndexer whose first column holds ints
+// or strings, of which the first 8 bytes are interpolated.
+func (f *Frame) partitionPivots(n int) []btree.Item {
+	columns := row.IndexColumns(f.indexer)
+	if n < 2 || len(columns) == 0 {
+		return nil
+	}
+	min, max := f.bt.Min().(row.Row).Data[columns[0]], f.bt.Max().(row.Row).Data[columns[0]]
+	var (
+		lo, hi  uint64
+		toIndex func(uint64) row.Index
+	)
+	switch min := min.(type) {
+	case int:
+		// Offsetting by the sign bit maps ints to uint64s in the same order.
+		lo, hi = uint64(min)^1<<63, uint64(max.(int))^1<<63
+		toIndex = func(v uint64) row.Index { return row.IntIndex(int(v ^ 1<<63)) }
+	case string:
+		lo, hi = stringPrefix(min), stringPrefix(max.(string))
+		toIndex = func(v uint64) row.Index {
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], v)
+			return row.StringIndex(b[:])
+		}
+	default:
+		return nil
+	}
+
+	var pivots []btree.Item
+	width := hi - lo
+	for i := 1; i < n; i++ {
+		// The product is split to avoid overflowing for wide ranges.
+		v := lo + width/uint64(n)*uint64(i) + width%uint64(n)*uint64(i)/uint64(n)
+		index := toIndex(v)
+		if len(columns) > 1 {
+			// A prefix of a MultiIndex is less than every index it prefixes.
+			index = row.NewMultiIndex(index)
+		}
+		pivots = append(pivots, f.pivot(index))
+	}
+	return pivots
+}
+
+// stringPrefix returns the first 8 bytes of the string as a big-endian uint64,
+// padded with zeros.
+func stringPrefix(s string) uint64 {
+	var b [8]byte
+	copy(b[:], s)
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// partition returns a btree of the *partialGroups of the rows of the Frame from
+// the lower pivot up to the upper pivot, which are unbounded if nil.
+func (f *Frame) partition(lo, hi btree.Item, indexer row.Indexer, aggs map[string]group.Incremental, members bool) (*btree.BTree, error) {
+	var (
+		groups    = btree.New(DefaultDegree)
+		returnErr error
+	)
+	iterator := func(item btree.Item) bool {
+		data := item.(row.Row).Data
+		index, err := indexer.Index(data)
+		if err != nil {
+			returnErr = err
+			return false
+		}
+		for _, agg := range aggs {
+			if err := agg.Check(data); err != nil {
+				returnErr = err
+				return false
+			}
+		}
+		var g *partialGroup
+		if got := groups.Get(&partialGroup{index: index}); got != nil {
+			g = got.(*partialGroup)
+		} else {
+			g = &partialGroup{
+				index: index,
+				keys:  make(row.Data),
+				accs:  make(map[string]*value.Accumulator, len(aggs)),
+			}
+			for _, col := range row.IndexColumns(indexer) {
+				g.keys[col] = data[col]
+			}
+			for col, agg := range aggs {
+				g.accs[col] = agg.New(false)
+			}
+			groups.ReplaceOrInsert(g)
+		}
+		if members {
+			g.members = append(g.members, f.out(data))
+		}
+		for col, acc := range g.accs {
+			acc.Add(aggs[col].Arg(data))
+		}
+		return true
+	}
+	switch {
+	case lo == nil && hi == nil:
+		f.bt.Ascend(iterator)
+	case lo == nil:
+		f.bt.AscendLessThan(hi, iterator)
+	case hi == nil:
+		f.bt.AscendGreaterOrEqual(lo, iterator)
+	default:
+		f.bt.AscendRange(lo, hi, iterator)
+	}
+	if returnErr != nil {
+		return nil, returnErr
+	}
+	return groups, nil
+}
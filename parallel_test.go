@@ -0,0 +1,184 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/google/godata/group"
+	"github.com/google/godata/row"
+)
+
+// parallelFrame returns a Frame of enough rows to be split into several
+// partitions, with GOMAXPROCS set so that they are grouped by several workers.
+// The returned function restores GOMAXPROCS.
+func parallelFrame(t *testing.T) (*Frame, func()) {
+	procs := runtime.GOMAXPROCS(4)
+	f := NewFrame(row.NewColumnIndexer("i"))
+	data := make([]row.Data, 5*minPartition)
+	for i := range data {
+		data[i] = row.Of("i", i, "k", i*7%13, "v", i%101)
+	}
+	if err := f.PutAll(data); err != nil {
+		t.Fatalf("PutAll: %v", err)
+	}
+	return f, func() { runtime.GOMAXPROCS(procs) }
+}
+
+func TestParallelGroupBy(t *testing.T) {
+	f, restore := parallelFrame(t)
+	defer restore()
+
+	want, err := f.GroupBy(row.NewColumnIndexer("k"))
+	if err != nil {
+		t.Fatalf("GroupBy: %v", err)
+	}
+	got, err := f.ParallelGroupBy(row.NewColumnIndexer("k"))
+	if err != nil {
+		t.Fatalf("ParallelGroupBy: %v", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("ParallelGroupBy differs from GroupBy: got %d groups, want %d", got.Len(), want.Len())
+	}
+
+	empty, err := NewFrame(row.NewColumnIndexer("i")).ParallelGroupBy(row.NewColumnIndexer("k"))
+	if err != nil || empty.Len() != 0 {
+		t.Errorf("ParallelGroupBy of an empty Frame = %v, %v; want no groups", empty, err)
+	}
+}
+
+func TestParallelGroupByClone(t *testing.T) {
+	f, restore := parallelFrame(t)
+	defer restore()
+	s := f.Snapshot()
+
+	want, err := s.GroupBy(row.NewColumnIndexer("k"))
+	if err != nil {
+		t.Fatalf("GroupBy: %v", err)
+	}
+	got, err := f.ParallelGroupBy(row.NewColumnIndexer("k"))
+	if err != nil {
+		t.Fatalf("ParallelGroupBy: %v", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("ParallelGroupBy of a cloned Frame differs from GroupBy: got %d groups, want %d", got.Len(), want.Len())
+	}
+
+	// The members are copies, so changing them leaves the snapshot unchanged.
+	g, _ := got.Get(row.Of("k", 0))
+	g[group.Column].(group.Group)[0]["v"] = -1
+	if data, _ := s.Get(row.Of("i", 0)); data["v"] != 0 {
+		t.Errorf("snapshot Get = %v; want v 0", data)
+	}
+}
+
+func TestParallelGroupByPivots(t *testing.T) {
+	procs := runtime.GOMAXPROCS(4)
+	defer runtime.GOMAXPROCS(procs)
+
+	for _, c := range []struct {
+		name string
+		f    *Frame
+		data func(i int) row.Data
+	}{
+		{"strings", NewFrame(row.NewColumnIndexer("s")), func(i int) row.Data {
+			return row.Of("s", fmt.Sprintf("key%06d", i), "k", i%13)
+		}},
+		{"multi-column", NewFrame(row.NewColumnIndexer("i", "s")), func(i int) row.Data {
+			return row.Of("i", i/3-minPartition, "s", fmt.Sprint(i%3), "k", i%13)
+		}},
+		{"duplicates", NewFrame(row.NewColumnIndexer("i"), AllowDuplicates()), func(i int) row.Data {
+			return row.Of("i", i%1000, "k", i%13)
+		}},
+	} {
+		data := make([]row.Data, 5*minPartition)
+		for i := range data {
+			data[i] = c.data(i)
+		}
+		if err := c.f.PutAll(data); err != nil {
+			t.Fatalf("%s: PutAll: %v", c.name, err)
+		}
+		if got := len(c.f.partitionPivots(4)); got != 3 {
+			t.Errorf("%s: %d pivots; want 3", c.name, got)
+		}
+		want, err := c.f.GroupBy(row.NewColumnIndexer("k"))
+		if err != nil {
+			t.Fatalf("%s: GroupBy: %v", c.name, err)
+		}
+		got, err := c.f.ParallelGroupBy(row.NewColumnIndexer("k"))
+		if err != nil {
+			t.Fatalf("%s: ParallelGroupBy: %v", c.name, err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%s: ParallelGroupBy differs from GroupBy", c.name)
+		}
+	}
+}
+
+func TestParallelAggregate(t *testing.T) {
+	f, restore := parallelFrame(t)
+	defer restore()
+
+	got, err := f.ParallelAggregate(row.NewColumnIndexer("k"), viewAggs)
+	if err != nil {
+		t.Fatalf("ParallelAggregate: %v", err)
+	}
+	var rows []row.Data
+	got.ForEach(func(data row.Data) error {
+		rows = append(rows, data)
+		return nil
+	})
+	if want := recomputeView(t, f); !reflect.DeepEqual(rows, want) {
+		t.Errorf("ParallelAggregate = %v; want %v", rows, want)
+	}
+
+	f.Put(row.Of("i", 3*minPartition, "k", 0, "v", "x"))
+	if _, err := f.ParallelAggregate(row.NewColumnIndexer("k"), viewAggs); err == nil {
+		t.Errorf("ParallelAggregate with a string sum = nil error; want error")
+	}
+}
+
+func benchmarkParallelGroupBy(b *testing.B, f *Frame, size int) {
+	for n := 0; n < b.N; n++ {
+		if _, err := f.ParallelGroupBy(row.NewColumnIndexer("g")); err != nil {
+			b.Fatalf("ParallelGroupBy: %v", err)
+		}
+	}
+}
+
+func benchmarkParallelAggregate(b *testing.B, f *Frame, size int) {
+	aggs := map[string]group.Incremental{
+		"n":   group.IncrementalCount(),
+		"sum": group.IncrementalSum("i"),
+		"max": group.IncrementalMax("i"),
+	}
+	for n := 0; n < b.N; n++ {
+		if _, err := f.ParallelAggregate(row.NewColumnIndexer("g"), aggs); err != nil {
+			b.Fatalf("ParallelAggregate: %v", err)
+		}
+	}
+}
+
+// BenchmarkParallelGroupBy compares with BenchmarkGroupBy; the speedup grows
+// with GOMAXPROCS, which may be set with the -cpu flag.
+func BenchmarkParallelGroupBy(b *testing.B) {
+	benchmarkBySize(b, benchmarkParallelGroupBy)
+}
+
+func BenchmarkParallelAggregate(b *testing.B) {
+	benchmarkBySize(b, benchmarkParallelAggregate)
+}
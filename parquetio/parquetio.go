@@ -0,0 +1,131 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package parquetio reads and writes Frames in the Apache Parquet format, using
+// github.com/parquet-go/parquet-go for the file format.
+//
+// Column types are mapped as follows when writing a Frame:
+//
+//	int, int64    INT64
+//	int32         INT32
+//	uint64        INT64 (unsigned integer)
+//	float64       DOUBLE
+//	float32       FLOAT
+//	bool          BOOLEAN
+//	string        BYTE_ARRAY (string), dictionary encoded
+//	[]byte        BYTE_ARRAY
+//	time.Time     INT64 (timestamp in microseconds, UTC)
+//
+// Every column is optional, and nil values and columns missing from a row are
+// written as nulls. A column containing only nil values is written as an INT32
+// column of the unknown (null) type. Columns are written in name order, and
+// rows in index order; the columns of a ColumnIndexer are recorded in the
+// key-value metadata, and listed as the sorting columns of every row group.
+//
+// Flat files written by other tools can be read, in any encoding and
+// compression that parquet-go supports, provided that each column is
+// compressed with the same codec in every row group. Integer types other than
+// unsigned 64-bit integers are read as int (see row.NewIndex), strings as
+// string, timestamps, dates and INT96 values as time.Time in UTC, and null
+// values are left out of the row. Nested and repeated columns are not
+// supported.
+package parquetio
+
+import (
+	"fmt"
+
+	"github.com/google/godata/row"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+const (
+	// IndexMetadataKey is the key-value metadata key that lists the index
+	// columns of the Frame, as a JSON array of column names.
+	IndexMetadataKey = "godata.index"
+
+	// DefaultRowGroupSize is the default number of rows in each row group.
+	DefaultRowGroupSize = 128 * 1024
+)
+
+// Compression is the compression codec of the pages written.
+type Compression int
+
+const (
+	// Snappy compresses pages with Snappy. It is the default, and the codec
+	// most widely supported by other readers.
+	Snappy Compression = iota
+
+	// Uncompressed leaves pages uncompressed.
+	Uncompressed
+
+	// Gzip compresses pages with gzip.
+	Gzip
+
+	// Zstd compresses pages with Zstandard, which some older readers do not
+	// support.
+	Zstd
+)
+
+// codec returns the Parquet codec for the Compression.
+func (c Compression) codec() (compress.Codec, error) {
+	switch c {
+	case Snappy:
+		return &parquet.Snappy, nil
+	case Uncompressed:
+		return &parquet.Uncompressed, nil
+	case Gzip:
+		return &parquet.Gzip, nil
+	case Zstd:
+		return &parquet.Zstd, nil
+	}
+	return nil, fmt.Errorf("parquetio: unknown compression %d", c)
+}
+
+// Options configures reading and writing Parquet files. A nil *Options uses
+// the defaults.
+type Options struct {
+	// RowGroupSize is the maximum number of rows in each row group written.
+	// Zero means DefaultRowGroupSize.
+	RowGroupSize int
+
+	// Compression is the compression codec of the pages written. The default
+	// is Snappy.
+	Compression Compression
+
+	// Columns are the columns to read. If nil, then all columns are read. The
+	// columns of a ColumnIndexer are always read.
+	Columns []string
+
+	// Indexer indexes the Frame read. If nil, then the Frame is indexed by the
+	// columns listed in the key-value metadata.
+	Indexer row.Indexer
+
+	// AllowDuplicates creates the Frame read with the godata.AllowDuplicates
+	// option.
+	AllowDuplicates bool
+
+	// GreaterOrEqual and LessThan restrict the rows read to the given range of
+	// the index, as for Frame.GetRange. If the Frame is indexed by a
+	// ColumnIndexer, then row groups are skipped if the statistics of the
+	// first index column show that they contain no rows in the range.
+	GreaterOrEqual row.Data
+	LessThan       row.Data
+}
+
+func (o *Options) rowGroupSize() int {
+	if o == nil || o.RowGroupSize <= 0 {
+		return DefaultRowGroupSize
+	}
+	return o.RowGroupSize
+}
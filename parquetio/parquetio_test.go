@@ -0,0 +1,215 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parquetio
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+)
+
+// testFrame returns a Frame with n rows of every supported column type.
+func testFrame(n int) *godata.Frame {
+	f := godata.NewFrame(row.NewColumnIndexer("s", "i"))
+	for i := 0; i < n; i++ {
+		data := row.Of(
+			"s", string(rune('a'+i%3)),
+			"i", i,
+			"i32", int32(-i),
+			"i64", int64(i)<<40,
+			"f", float64(i)/2,
+			"f32", float32(i),
+			"b", i%2 == 0,
+			"bytes", []byte{byte(i)},
+			"t", time.Unix(int64(i), 1000).UTC(),
+			"u", uint64(1)<<63+uint64(i),
+			"none", nil,
+		)
+		if i%4 == 0 {
+			delete(data, "f")
+		}
+		f.Put(data)
+	}
+	return f
+}
+
+// roundTrip writes and reads the Frame.
+func roundTrip(t *testing.T, f *godata.Frame, write, read *Options) *godata.Frame {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, f, write); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	nf, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()), read)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return nf
+}
+
+// wantRows returns the rows of the Frame without nil values, optionally
+// restricted to the given columns.
+func wantRows(f *godata.Frame, columns ...string) []row.Data {
+	rows, _ := f.GetRange()
+	for _, data := range rows {
+		for col, val := range data {
+			if val == nil {
+				delete(data, col)
+			}
+		}
+		if columns == nil {
+			continue
+		}
+		for col := range data {
+			keep := false
+			for _, c := range columns {
+				keep = keep || c == col
+			}
+			if !keep {
+				delete(data, col)
+			}
+		}
+	}
+	return rows
+}
+
+func TestRoundTrip(t *testing.T) {
+	f := testFrame(100)
+	// The int32 and int64 columns are read as int.
+	want := wantRows(f)
+	for _, data := range want {
+		data["i32"] = int(data["i32"].(int32))
+		data["i64"] = int(data["i64"].(int64))
+	}
+	for name, compression := range map[string]Compression{
+		"snappy":       Snappy,
+		"uncompressed": Uncompressed,
+		"gzip":         Gzip,
+		"zstd":         Zstd,
+	} {
+		t.Run(name, func(t *testing.T) {
+			nf := roundTrip(t, f, &Options{RowGroupSize: 30, Compression: compression}, nil)
+			got, err := nf.GetRange()
+			if err != nil {
+				t.Fatalf("GetRange: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetRange = %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadColumns(t *testing.T) {
+	f := testFrame(10)
+	nf := roundTrip(t, f, nil, &Options{Columns: []string{"b"}})
+	got, _ := nf.GetRange()
+	if want := wantRows(f, "s", "i", "b"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRange = %v; want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	Write(&buf, f, nil)
+	if _, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &Options{Columns: []string{"missing"}}); err == nil {
+		t.Errorf("Read succeeded for missing column; want error")
+	}
+}
+
+// countingReaderAt counts the bytes read from r.
+type countingReaderAt struct {
+	r *bytes.Reader
+	n int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n += n
+	return n, err
+}
+
+func TestReadRange(t *testing.T) {
+	f := godata.NewFrame(row.NewColumnIndexer("i"))
+	// The row groups are numerous enough that the file metadata, which is
+	// always read, is a small part of the file.
+	for i := 0; i < 2000; i++ {
+		f.Put(row.Of("i", i, "data", fmt.Sprintf("row %d", i)))
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, f, &Options{RowGroupSize: 100}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	all := &countingReaderAt{r: bytes.NewReader(buf.Bytes())}
+	if _, err := Read(all, int64(buf.Len()), nil); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	some := &countingReaderAt{r: bytes.NewReader(buf.Bytes())}
+	nf, err := Read(some, int64(buf.Len()), &Options{
+		GreaterOrEqual: row.Of("i", 150),
+		LessThan:       row.Of("i", 300),
+	})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	rows, _ := nf.GetRange()
+	if len(rows) != 150 || rows[0]["i"] != 150 || rows[149]["i"] != 299 {
+		t.Errorf("GetRange = %d rows from %v; want rows 150 to 299", len(rows), rows[0])
+	}
+	if some.n*3 > all.n {
+		t.Errorf("Read range read %d of %d bytes; want row groups skipped", some.n, all.n)
+	}
+}
+
+func TestReadIndexer(t *testing.T) {
+	f := godata.NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 0, "user", "b"))
+	f.Put(row.Of("i", 1, "user", "a"))
+	f.Put(row.Of("i", 2, "user", "a"))
+	nf := roundTrip(t, f, nil, &Options{
+		Indexer:         row.NewColumnIndexer("user"),
+		AllowDuplicates: true,
+	})
+	if rows, _ := nf.GetAll(row.Of("user", "a")); len(rows) != 2 {
+		t.Errorf("GetAll = %v; want 2 rows", rows)
+	}
+}
+
+func TestWriteMixedTypes(t *testing.T) {
+	f := godata.NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 0, "data", "foo"))
+	f.Put(row.Of("i", 1, "data", 1))
+	if err := Write(&bytes.Buffer{}, f, nil); err == nil {
+		t.Errorf("Write succeeded for column of mixed types; want error")
+	}
+}
+
+func TestReadCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testFrame(10), nil); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// Every truncation and single byte change must fail or succeed cleanly.
+	b := buf.Bytes()
+	for i := range b {
+		Read(bytes.NewReader(b[:i]), int64(i), nil)
+		c := append([]byte{}, b...)
+		c[i] ^= 0xff
+		Read(bytes.NewReader(c), int64(len(c)), nil)
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parquetio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/godata"
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// julianUnixEpoch is the Julian day of the Unix epoch, used by INT96
+// timestamps.
+const julianUnixEpoch = 2440588
+
+// converter returns the function that converts the non-null Parquet values of
+// the column to values in rows. Byte arrays are copied, since the values refer
+// to the pages they were read from.
+func converter(c *parquet.Column) (func(parquet.Value) interface{}, error) {
+	typ := c.Type()
+	// The logical type of files with only converted types is derived from
+	// them by parquet-go.
+	var logical format.LogicalTypeValue
+	if l := typ.LogicalType(); l != nil {
+		logical = l.Value
+	}
+	switch typ.Kind() {
+	case parquet.Boolean:
+		return func(v parquet.Value) interface{} { return v.Boolean() }, nil
+	case parquet.Float:
+		return func(v parquet.Value) interface{} { return v.Float() }, nil
+	case parquet.Double:
+		return func(v parquet.Value) interface{} { return v.Double() }, nil
+	case parquet.Int32:
+		switch l := logical.(type) {
+		case *format.DateType:
+			return func(v parquet.Value) interface{} {
+				return time.Unix(int64(v.Int32())*24*60*60, 0).UTC()
+			}, nil
+		case *format.IntType:
+			if !l.IsSigned {
+				return func(v parquet.Value) interface{} { return int(uint32(v.Int32())) }, nil
+			}
+		}
+		return func(v parquet.Value) interface{} { return int(v.Int32()) }, nil
+	case parquet.Int64:
+		switch l := logical.(type) {
+		case *format.TimestampType:
+			if l.Unit.Value == nil {
+				break
+			}
+			unit := l.Unit.Value.Duration()
+			per := int64(time.Second / unit)
+			return func(v parquet.Value) interface{} {
+				t := v.Int64()
+				return time.Unix(t/per, t%per*int64(unit)).UTC()
+			}, nil
+		case *format.IntType:
+			if !l.IsSigned {
+				return func(v parquet.Value) interface{} { return uint64(v.Int64()) }, nil
+			}
+		}
+		return func(v parquet.Value) interface{} { return int(v.Int64()) }, nil
+	case parquet.Int96:
+		return func(v parquet.Value) interface{} {
+			i := v.Int96()
+			nanos := int64(i[1])<<32 | int64(i[0])
+			days := int64(i[2]) - julianUnixEpoch
+			return time.Unix(days*24*60*60, nanos).UTC()
+		}, nil
+	case parquet.ByteArray:
+		switch logical.(type) {
+		case *format.StringType, *format.EnumType, *format.JsonType:
+			return func(v parquet.Value) interface{} { return string(v.ByteArray()) }, nil
+		}
+		fallthrough
+	case parquet.FixedLenByteArray:
+		return func(v parquet.Value) interface{} { return append([]byte{}, v.ByteArray()...) }, nil
+	}
+	return nil, fmt.Errorf("column %q has unsupported type %v", c.Name(), typ)
+}
+
+// Read reads a Frame from the Parquet file of the given size. The Frame is
+// indexed by Options.Indexer if given, or else by the index columns in the
+// key-value metadata. Returns a godata.ErrRows if any row cannot be indexed,
+// together with a Frame containing the other rows.
+func Read(r io.ReaderAt, size int64, opts *Options) (*godata.Frame, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	file, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, fmt.Errorf("Read: %v", err)
+	}
+
+	indexer := opts.Indexer
+	if indexer == nil {
+		value, ok := file.Lookup(IndexMetadataKey)
+		if !ok {
+			return nil, fmt.Errorf("Read: no indexer given and no %q in metadata", IndexMetadataKey)
+		}
+		var columns []string
+		if err := json.Unmarshal([]byte(value), &columns); err != nil {
+			return nil, fmt.Errorf("Read: invalid %q in metadata: %v", IndexMetadataKey, err)
+		}
+		indexer = row.NewColumnIndexer(columns...)
+	}
+	index := row.IndexColumns(indexer)
+
+	// Select the top-level columns to read.
+	var selected []*parquet.Column
+	if opts.Columns == nil {
+		selected = file.Root().Columns()
+	} else {
+		for _, name := range append(index, opts.Columns...) {
+			c := file.Root().Column(name)
+			if c == nil {
+				return nil, fmt.Errorf("Read: no column %q", name)
+			}
+			selected = append(selected, c)
+		}
+	}
+	convert := make([]func(parquet.Value) interface{}, len(selected))
+	for i, c := range selected {
+		if !c.Leaf() || c.Repeated() {
+			return nil, fmt.Errorf("Read: nested or repeated column %q is not supported", c.Name())
+		}
+		if convert[i], err = converter(c); err != nil {
+			return nil, fmt.Errorf("Read: %v", err)
+		}
+	}
+
+	var b *godata.Builder
+	if opts.AllowDuplicates {
+		b = godata.NewBuilder(indexer, godata.AllowDuplicates())
+	} else {
+		b = godata.NewBuilder(indexer)
+	}
+	for i, g := range file.RowGroups() {
+		if skipRowGroup(file, i, index, opts) {
+			continue
+		}
+		// Columns are read before rows are allocated, so that the number of
+		// rows is checked against the data.
+		columns := make(map[string][]interface{}, len(selected))
+		for j, c := range selected {
+			values, err := readColumnChunk(g.ColumnChunks()[c.Index()], convert[j], g.NumRows())
+			if err != nil {
+				return nil, fmt.Errorf("Read: column %q: %v", c.Name(), err)
+			}
+			columns[c.Name()] = values
+		}
+		rows := make([]row.Data, g.NumRows())
+		for j := range rows {
+			rows[j] = make(row.Data, len(columns))
+		}
+		for name, values := range columns {
+			for k, v := range values {
+				if v != nil {
+					rows[k][name] = v
+				}
+			}
+		}
+		b.Add(rows...)
+	}
+
+	f, err := b.Frame()
+	if opts.GreaterOrEqual != nil {
+		if _, err := f.PopRange(godata.LessThan(opts.GreaterOrEqual)); err != nil {
+			return nil, err
+		}
+	}
+	if opts.LessThan != nil {
+		if _, err := f.PopRange(godata.GreaterOrEqual(opts.LessThan)); err != nil {
+			return nil, err
+		}
+	}
+	return f, err
+}
+
+// plainSize is the size of the plain encoding of a value of each fixed-size
+// physical type, in which the statistics of a column chunk are encoded.
+var plainSize = map[parquet.Kind]int{
+	parquet.Boolean: 1,
+	parquet.Int32:   4,
+	parquet.Int64:   8,
+	parquet.Int96:   12,
+	parquet.Float:   4,
+	parquet.Double:  8,
+}
+
+// skipRowGroup returns true if the statistics of the first index column show
+// that the row group of the file contains no rows in the range of the Options.
+func skipRowGroup(file *parquet.File, i int, index []string, opts *Options) bool {
+	if len(index) == 0 || (opts.GreaterOrEqual == nil && opts.LessThan == nil) {
+		return false
+	}
+	c := file.Root().Column(index[0])
+	if c == nil || !c.Leaf() || c.Repeated() {
+		return false
+	}
+	convert, err := converter(c)
+	if err != nil {
+		return false
+	}
+	stats := file.Metadata().RowGroups[i].Columns[c.Index()].MetaData.Statistics
+	kind := c.Type().Kind()
+	decode := func(b []byte) (interface{}, bool) {
+		if n, ok := plainSize[kind]; b == nil || ok && len(b) != n {
+			return nil, false
+		}
+		return convert(kind.Value(b)), true
+	}
+	lo, okLo := decode(stats.MinValue)
+	hi, okHi := decode(stats.MaxValue)
+	if !okLo || !okHi {
+		return false
+	}
+
+	if v := opts.GreaterOrEqual[index[0]]; v != nil {
+		if cmp, err := value.Compare(hi, v); err == nil && cmp < 0 {
+			return true
+		}
+	}
+	if v := opts.LessThan[index[0]]; v != nil {
+		if cmp, err := value.Compare(lo, v); err == nil && (cmp > 0 || (cmp == 0 && len(index) == 1)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readColumnChunk returns the values of the column chunk, which must contain
+// one value for each of the rows of its row group. Null values are nil.
+func readColumnChunk(chunk parquet.ColumnChunk, convert func(parquet.Value) interface{}, rows int64) ([]interface{}, error) {
+	pages := chunk.Pages()
+	defer pages.Close()
+	var (
+		values []interface{}
+		buf    = make([]parquet.Value, 1024)
+	)
+	for {
+		page, err := pages.ReadPage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		values, err = appendPage(values, page, buf, convert, rows)
+		parquet.Release(page)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if int64(len(values)) != rows {
+		return nil, fmt.Errorf("%d values for %d rows", len(values), rows)
+	}
+	return values, nil
+}
+
+// appendPage appends the values of the page to values, which may hold no more
+// than the given number of rows, reading them through buf.
+func appendPage(values []interface{}, page parquet.Page, buf []parquet.Value, convert func(parquet.Value) interface{}, rows int64) ([]interface{}, error) {
+	r := page.Values()
+	for {
+		n, err := r.ReadValues(buf)
+		if int64(len(values)+n) > rows {
+			return nil, fmt.Errorf("more values than %d rows", rows)
+		}
+		for _, v := range buf[:n] {
+			if v.IsNull() {
+				values = append(values, nil)
+			} else {
+				values = append(values, convert(v))
+			}
+		}
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
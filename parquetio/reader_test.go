@@ -0,0 +1,360 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parquetio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+// The file read below is assembled byte by byte from the Parquet format
+// specification, without the writer of this package, in the layout written by
+// parquet-cpp and parquet-mr: a dictionary page before the data page of
+// dictionary encoded columns, version 1 data pages with length-prefixed
+// definition levels, and Snappy compression.
+
+// compact encodes structs in the Thrift compact protocol.
+type compact struct {
+	b []byte
+
+	// id is the id of the last field of the current struct, and ids those of
+	// the enclosing structs.
+	id  int16
+	ids []int16
+}
+
+// Compact protocol types.
+const (
+	ctI32    = 5
+	ctI64    = 6
+	ctBinary = 8
+	ctList   = 9
+	ctStruct = 12
+)
+
+// Values of the enums of the Parquet format definition, parquet.thrift.
+const (
+	magic = "PAR1"
+
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	convertedUTF8 = 0
+	logicalString = 1
+
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+
+	codecUncompressed = 0
+	codecSnappy       = 1
+
+	pageData       = 0
+	pageDictionary = 2
+)
+
+func (c *compact) field(id int16, typ byte) {
+	if d := id - c.id; d > 0 && d <= 15 {
+		c.b = append(c.b, byte(d)<<4|typ)
+	} else {
+		c.b = append(c.b, typ)
+		c.b = binary.AppendVarint(c.b, int64(id))
+	}
+	c.id = id
+}
+
+func (c *compact) i32(id int16, v int) {
+	c.field(id, ctI32)
+	c.b = binary.AppendVarint(c.b, int64(v))
+}
+
+func (c *compact) i64(id int16, v int) {
+	c.field(id, ctI64)
+	c.b = binary.AppendVarint(c.b, int64(v))
+}
+
+func (c *compact) str(id int16, s string) {
+	c.field(id, ctBinary)
+	c.b = binary.AppendUvarint(c.b, uint64(len(s)))
+	c.b = append(c.b, s...)
+}
+
+// list writes the header of a list of n elements, which must have fewer than
+// 15 elements.
+func (c *compact) list(id int16, elem byte, n int) {
+	c.field(id, ctList)
+	c.b = append(c.b, byte(n)<<4|elem)
+}
+
+// begin starts a struct, which is a field if id is nonzero or else a list
+// element.
+func (c *compact) begin(id int16) {
+	if id != 0 {
+		c.field(id, ctStruct)
+	}
+	c.ids = append(c.ids, c.id)
+	c.id = 0
+}
+
+func (c *compact) end() {
+	c.b = append(c.b, 0)
+	c.id = c.ids[len(c.ids)-1]
+	c.ids = c.ids[:len(c.ids)-1]
+}
+
+// snappyLiteral returns the data as a Snappy block of a single literal.
+func snappyLiteral(data []byte) []byte {
+	b := binary.AppendUvarint(nil, uint64(len(data)))
+	if n := len(data) - 1; n < 60 {
+		b = append(b, byte(n)<<2)
+	} else {
+		b = append(b, 60<<2, byte(n))
+	}
+	return append(b, data...)
+}
+
+// testPage returns a page header followed by the page. header writes the
+// header of the page type.
+func testPage(typ int, body []byte, codec int, header func(c *compact)) []byte {
+	data := body
+	if codec == codecSnappy {
+		data = snappyLiteral(body)
+	}
+	c := &compact{}
+	c.i32(1, typ)
+	c.i32(2, len(body))
+	c.i32(3, len(data))
+	header(c)
+	c.b = append(c.b, 0)
+	return append(c.b, data...)
+}
+
+func testDictionaryPage(n int, body []byte, codec int) []byte {
+	return testPage(pageDictionary, body, codec, func(c *compact) {
+		c.begin(7)
+		c.i32(1, n)
+		c.i32(2, encodingPlainDictionary)
+		c.end()
+	})
+}
+
+func testDataPage(n, encoding int, body []byte, codec int) []byte {
+	return testPage(pageData, body, codec, func(c *compact) {
+		c.begin(5)
+		c.i32(1, n)
+		c.i32(2, encoding)
+		c.i32(3, encodingRLE)
+		c.i32(4, encodingRLE)
+		c.end()
+	})
+}
+
+// levels returns definition levels as written in version 1 data pages.
+func levels(hybrid ...byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(hybrid)))
+	return append(b, hybrid...)
+}
+
+func plainInt64s(values ...int64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint64(b, uint64(v))
+	}
+	return b
+}
+
+func plainDoubles(values ...float64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	}
+	return b
+}
+
+func plainStrings(values ...string) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(v)))
+		b = append(b, v...)
+	}
+	return b
+}
+
+// testChunk is a column chunk of the file.
+type testChunk struct {
+	typ, codec int
+	encodings  []int
+	numValues  int
+	dictionary []byte
+	data       []byte
+}
+
+// testFile returns a file with columns id, name and score, containing the row
+// groups of the given column chunks.
+func testFile(numRows []int, groups [][3]testChunk) []byte {
+	file := []byte(magic)
+	type offsets struct{ dictionary, data, size int }
+	chunkOffsets := make([][3]offsets, len(groups))
+	for i, g := range groups {
+		for j, chunk := range g {
+			o := offsets{data: len(file)}
+			if chunk.dictionary != nil {
+				o.dictionary = len(file)
+				o.data += len(chunk.dictionary)
+			}
+			file = append(file, chunk.dictionary...)
+			file = append(file, chunk.data...)
+			o.size = len(chunk.dictionary) + len(chunk.data)
+			chunkOffsets[i][j] = o
+		}
+	}
+
+	c := &compact{}
+	c.i32(1, 1)
+	c.list(2, ctStruct, 4)
+	c.begin(0)
+	c.str(4, "schema")
+	c.i32(5, 3)
+	c.end()
+	c.begin(0)
+	c.i32(1, typeInt64)
+	c.i32(3, repetitionRequired)
+	c.str(4, "id")
+	c.end()
+	c.begin(0)
+	c.i32(1, typeByteArray)
+	c.i32(3, repetitionOptional)
+	c.str(4, "name")
+	c.i32(6, convertedUTF8)
+	c.begin(10)
+	c.begin(logicalString)
+	c.end()
+	c.end()
+	c.end()
+	c.begin(0)
+	c.i32(1, typeDouble)
+	c.i32(3, repetitionOptional)
+	c.str(4, "score")
+	c.end()
+	total := 0
+	for _, n := range numRows {
+		total += n
+	}
+	c.i64(3, total)
+	c.list(4, ctStruct, len(groups))
+	names := []string{"id", "name", "score"}
+	for i, g := range groups {
+		c.begin(0)
+		c.list(1, ctStruct, len(g))
+		size := 0
+		for j, chunk := range g {
+			o := chunkOffsets[i][j]
+			c.begin(0)
+			c.i64(2, o.data)
+			c.begin(3)
+			c.i32(1, chunk.typ)
+			c.list(2, ctI32, len(chunk.encodings))
+			for _, e := range chunk.encodings {
+				c.b = binary.AppendVarint(c.b, int64(e))
+			}
+			c.list(3, ctBinary, 1)
+			c.b = binary.AppendUvarint(c.b, uint64(len(names[j])))
+			c.b = append(c.b, names[j]...)
+			c.i32(4, chunk.codec)
+			c.i64(5, chunk.numValues)
+			// The uncompressed size is not needed to read the chunk.
+			c.i64(6, o.size)
+			c.i64(7, o.size)
+			c.i64(9, o.data)
+			if chunk.dictionary != nil {
+				c.i64(11, o.dictionary)
+			}
+			c.end()
+			c.end()
+			size += o.size
+		}
+		c.i64(2, size)
+		c.i64(3, numRows[i])
+		c.end()
+	}
+	c.str(6, "hand-assembled")
+	c.b = append(c.b, 0)
+
+	file = append(file, c.b...)
+	file = binary.LittleEndian.AppendUint32(file, uint32(len(c.b)))
+	return append(file, magic...)
+}
+
+func TestReadSpecFile(t *testing.T) {
+	// The id and name columns are compressed with Snappy, and the score column
+	// is not.
+	// Dictionary indices and definition levels use both bit-packed and RLE
+	// runs of the hybrid encoding.
+	var (
+		id1 = testDataPage(4, encodingPlain, plainInt64s(1, 2, 3, 4), codecSnappy)
+		// Names a, null, b, a.
+		nameDict1 = testDictionaryPage(2, plainStrings("a", "b"), codecSnappy)
+		name1     = testDataPage(4, encodingRLEDictionary, append(levels(0x02, 0x01, 0x02, 0x00, 0x04, 0x01), 1, 0x03, 0x02), codecSnappy)
+		// Scores 1.5, 2.5, null, 4.
+		score1 = testDataPage(4, encodingPlain, append(levels(0x04, 0x01, 0x02, 0x00, 0x02, 0x01), plainDoubles(1.5, 2.5, 4)...), codecUncompressed)
+
+		idDict2 = testDictionaryPage(2, plainInt64s(5, 6), codecSnappy)
+		id2     = testDataPage(2, encodingPlainDictionary, []byte{1, 0x03, 0x02}, codecSnappy)
+		name2   = testDataPage(2, encodingPlain, append(levels(0x04, 0x01), plainStrings("c", "d")...), codecSnappy)
+		// Scores null, null.
+		score2 = testDataPage(2, encodingPlain, levels(0x04, 0x00), codecUncompressed)
+	)
+	file := testFile([]int{4, 2}, [][3]testChunk{
+		{
+			{typ: typeInt64, codec: codecSnappy, encodings: []int{encodingPlain, encodingRLE}, numValues: 4, data: id1},
+			{typ: typeByteArray, codec: codecSnappy, encodings: []int{encodingPlainDictionary, encodingRLEDictionary, encodingRLE}, numValues: 4, dictionary: nameDict1, data: name1},
+			{typ: typeDouble, codec: codecUncompressed, encodings: []int{encodingPlain, encodingRLE}, numValues: 4, data: score1},
+		},
+		{
+			{typ: typeInt64, codec: codecSnappy, encodings: []int{encodingPlainDictionary, encodingRLE}, numValues: 2, dictionary: idDict2, data: id2},
+			{typ: typeByteArray, codec: codecSnappy, encodings: []int{encodingPlain, encodingRLE}, numValues: 2, data: name2},
+			{typ: typeDouble, codec: codecUncompressed, encodings: []int{encodingPlain, encodingRLE}, numValues: 2, data: score2},
+		},
+	})
+
+	f, err := Read(bytes.NewReader(file), int64(len(file)), &Options{Indexer: row.NewColumnIndexer("id")})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	got, err := f.GetRange()
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	want := []row.Data{
+		row.Of("id", 1, "name", "a", "score", 1.5),
+		row.Of("id", 2, "score", 2.5),
+		row.Of("id", 3, "name", "b"),
+		row.Of("id", 4, "name", "a", "score", 4.0),
+		row.Of("id", 5, "name", "c"),
+		row.Of("id", 6, "name", "d"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parquetio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+	"github.com/parquet-go/parquet-go"
+)
+
+// column describes a column written to a Parquet file.
+type column struct {
+	name string
+
+	// node is the schema node of the column, before it is made optional.
+	node parquet.Node
+
+	// value converts a non-nil value of the column to its Parquet value.
+	value func(interface{}) parquet.Value
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// newColumn returns the column for values of the Go type.
+func newColumn(name string, typ reflect.Type) (*column, error) {
+	c := &column{name: name}
+	switch typ {
+	case nil:
+		c.node = parquet.Leaf(parquet.NullType)
+		return c, nil
+	case timeType:
+		c.node = parquet.Timestamp(parquet.Microsecond)
+		c.value = func(v interface{}) parquet.Value { return parquet.Int64Value(v.(time.Time).UnixMicro()) }
+		return c, nil
+	case bytesType:
+		c.node = parquet.Leaf(parquet.ByteArrayType)
+		c.value = func(v interface{}) parquet.Value { return parquet.ByteArrayValue(v.([]byte)) }
+		return c, nil
+	}
+	if typ.PkgPath() != "" {
+		return nil, fmt.Errorf("column %q has unsupported type %v", name, typ)
+	}
+
+	switch typ.Kind() {
+	case reflect.Int:
+		c.node = parquet.Leaf(parquet.Int64Type)
+		c.value = func(v interface{}) parquet.Value { return parquet.Int64Value(int64(v.(int))) }
+	case reflect.Int64:
+		c.node = parquet.Leaf(parquet.Int64Type)
+		c.value = func(v interface{}) parquet.Value { return parquet.Int64Value(v.(int64)) }
+	case reflect.Int32:
+		c.node = parquet.Leaf(parquet.Int32Type)
+		c.value = func(v interface{}) parquet.Value { return parquet.Int32Value(v.(int32)) }
+	case reflect.Uint64:
+		c.node = parquet.Uint(64)
+		c.value = func(v interface{}) parquet.Value { return parquet.Int64Value(int64(v.(uint64))) }
+	case reflect.Float64:
+		c.node = parquet.Leaf(parquet.DoubleType)
+		c.value = func(v interface{}) parquet.Value { return parquet.DoubleValue(v.(float64)) }
+	case reflect.Float32:
+		c.node = parquet.Leaf(parquet.FloatType)
+		c.value = func(v interface{}) parquet.Value { return parquet.FloatValue(v.(float32)) }
+	case reflect.Bool:
+		c.node = parquet.Leaf(parquet.BooleanType)
+		c.value = func(v interface{}) parquet.Value { return parquet.BooleanValue(v.(bool)) }
+	case reflect.String:
+		c.node = parquet.Encoded(parquet.String(), &parquet.RLEDictionary)
+		c.value = func(v interface{}) parquet.Value { return parquet.ByteArrayValue([]byte(v.(string))) }
+	default:
+		return nil, fmt.Errorf("column %q has unsupported type %v", name, typ)
+	}
+	return c, nil
+}
+
+// columns returns the columns of the Frame in name order, which is the order
+// of the columns of a parquet.Group. Returns error if a column contains values
+// of different types, or of a type that cannot be written.
+func columns(f *godata.Frame) ([]*column, error) {
+	types := make(map[string]reflect.Type)
+	err := f.ForEach(func(data row.Data) error {
+		for col, val := range data {
+			typ, ok := types[col]
+			if val == nil || typ == reflect.TypeOf(val) {
+				if !ok {
+					types[col] = nil
+				}
+				continue
+			}
+			if typ != nil {
+				return fmt.Errorf("column %q has values of types %v and %T", col, typ, val)
+			}
+			types[col] = reflect.TypeOf(val)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for col := range types {
+		names = append(names, col)
+	}
+	sort.Strings(names)
+	columns := make([]*column, len(names))
+	for i, name := range names {
+		if columns[i], err = newColumn(name, types[name]); err != nil {
+			return nil, err
+		}
+	}
+	return columns, nil
+}
+
+// Write writes the Frame to w in the Parquet format.
+func Write(w io.Writer, f *godata.Frame, opts *Options) error {
+	columns, err := columns(f)
+	if err != nil {
+		return fmt.Errorf("Write: %v", err)
+	}
+	var compression Compression
+	if opts != nil {
+		compression = opts.Compression
+	}
+	codec, err := compression.codec()
+	if err != nil {
+		return err
+	}
+
+	schema := make(parquet.Group, len(columns))
+	for _, c := range columns {
+		schema[c.name] = parquet.Optional(c.node)
+	}
+	size := opts.rowGroupSize()
+	options := []parquet.WriterOption{
+		parquet.NewSchema("schema", schema),
+		parquet.Compression(codec),
+		parquet.MaxRowsPerRowGroup(int64(size)),
+	}
+	if index := row.IndexColumns(f.Indexer()); index != nil {
+		b, err := json.Marshal(index)
+		if err != nil {
+			return err
+		}
+		sorting := make([]parquet.SortingColumn, len(index))
+		for i, col := range index {
+			sorting[i] = parquet.Ascending(col)
+		}
+		options = append(options,
+			parquet.KeyValueMetadata(IndexMetadataKey, string(b)),
+			parquet.SortingWriterConfig(parquet.SortingColumns(sorting...)))
+	}
+
+	pw := parquet.NewWriter(w, options...)
+	rows := make([]parquet.Row, 0, min(size, f.Len()))
+	err = f.ForEach(func(data row.Data) error {
+		r := make(parquet.Row, len(columns))
+		for i, c := range columns {
+			if v := data[c.name]; v != nil {
+				r[i] = c.value(v).Level(0, 1, i)
+			} else {
+				r[i] = parquet.NullValue().Level(0, 0, i)
+			}
+		}
+		if rows = append(rows, r); len(rows) < size {
+			return nil
+		}
+		_, err := pw.WriteRows(rows)
+		rows = rows[:0]
+		return err
+	})
+	if err == nil && len(rows) > 0 {
+		_, err = pw.WriteRows(rows)
+	}
+	if err == nil {
+		err = pw.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("Write: %v", err)
+	}
+	return nil
+}
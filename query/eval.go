@@ -0,0 +1,276 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package query
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// context is the environment in which expressions are evaluated: a row of each
+// table joined so far, the values of the aggregates of a group, and the
+// selected columns when evaluating the HAVING and ORDER BY clauses.
+type context struct {
+	aliases  []string
+	rows     []row.Data
+	aggs     []interface{}
+	selected *result
+}
+
+// expr is an expression. Values are NULL if nil.
+type expr interface {
+	eval(c *context) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (l *literal) eval(*context) (interface{}, error) {
+	return l.value, nil
+}
+
+// columnRef refers to a column, optionally qualified by a table alias.
+type columnRef struct {
+	table, column string
+}
+
+// eval returns the value of the column. Unqualified columns refer to the
+// selected columns of that name if any, and are otherwise looked up in every
+// row, and are ambiguous if more than one row contains them.
+func (r *columnRef) eval(c *context) (interface{}, error) {
+	if r.table == "" && c.selected != nil {
+		for k := len(c.selected.names) - 1; k >= 0; k-- {
+			if c.selected.names[k] == r.column {
+				return c.selected.values[k], nil
+			}
+		}
+	}
+	if r.table != "" {
+		for i, alias := range c.aliases {
+			if alias == r.table {
+				return c.rows[i][r.column], nil
+			}
+		}
+		return nil, fmt.Errorf("query: unknown table %q", r.table)
+	}
+	if len(c.rows) == 1 {
+		return c.rows[0][r.column], nil
+	}
+	var (
+		val   interface{}
+		found = -1
+	)
+	for i, data := range c.rows {
+		if v, ok := data[r.column]; ok {
+			if found >= 0 {
+				return nil, fmt.Errorf("query: column %q is ambiguous between %q and %q", r.column, c.aliases[found], c.aliases[i])
+			}
+			val, found = v, i
+		}
+	}
+	return val, nil
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+func (u *unaryExpr) eval(c *context) (interface{}, error) {
+	if u.op == "NOT" {
+		x, err := truth(u.x, c)
+		if b, ok := x.(bool); ok {
+			return !b, err
+		}
+		return nil, err
+	}
+	x, err := u.x.eval(c)
+	if err != nil || x == nil {
+		return nil, err
+	}
+	switch x := value.Normalize(x).(type) {
+	case int:
+		return -x, nil
+	case float64:
+		return -x, nil
+	}
+	return nil, fmt.Errorf("query: cannot negate %T", x)
+}
+
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+func (b *binaryExpr) eval(c *context) (interface{}, error) {
+	switch b.op {
+	case "AND", "OR":
+		// Logic is three-valued: the result is NULL unless the known operands
+		// decide it.
+		decisive := b.op == "OR"
+		x, err := truth(b.x, c)
+		if err != nil || x == decisive {
+			return x, err
+		}
+		y, err := truth(b.y, c)
+		if err != nil || y == decisive {
+			return y, err
+		}
+		if x == nil || y == nil {
+			return nil, nil
+		}
+		return !decisive, nil
+	}
+
+	x, err := b.x.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	y, err := b.y.eval(c)
+	if err != nil || x == nil || y == nil {
+		return nil, err
+	}
+	switch b.op {
+	case "=", "<>", "<", "<=", ">", ">=":
+		cmp, err := compare(x, y)
+		if err != nil {
+			return nil, err
+		}
+		switch b.op {
+		case "=":
+			return cmp == 0, nil
+		case "<>":
+			return cmp != 0, nil
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		}
+		return cmp >= 0, nil
+	case "||":
+		return fmt.Sprint(x) + fmt.Sprint(y), nil
+	}
+	return arith(b.op, x, y)
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+func (n *isNullExpr) eval(c *context) (interface{}, error) {
+	x, err := n.x.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	return (x == nil) != n.not, nil
+}
+
+// aggregateExpr is an aggregate function. Its value in a group is computed
+// before evaluating the expressions containing it.
+type aggregateExpr struct {
+	fn string
+
+	// arg is nil for COUNT(*).
+	arg expr
+
+	// id is the index of the aggregate in Query.aggregates.
+	id int
+}
+
+func (a *aggregateExpr) eval(c *context) (interface{}, error) {
+	return c.aggs[a.id], nil
+}
+
+// truth evaluates a boolean expression, returning nil if it is NULL.
+func truth(x expr, c *context) (interface{}, error) {
+	v, err := x.eval(c)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	if _, ok := v.(bool); !ok {
+		return nil, fmt.Errorf("query: %v of type %T is not a boolean", v, v)
+	}
+	return v, nil
+}
+
+// compare returns -1, 0 or 1 if x is less than, equal to or greater than y.
+// See value.Compare.
+func compare(x, y interface{}) (int, error) {
+	cmp, err := value.Compare(x, y)
+	if err != nil {
+		return 0, fmt.Errorf("query: %v", err)
+	}
+	return cmp, nil
+}
+
+// arith applies an arithmetic operator. Operations on ints return an int, and
+// operations involving a float64 return a float64.
+func arith(op string, x, y interface{}) (interface{}, error) {
+	x, y = value.Normalize(x), value.Normalize(y)
+	if a, ok := x.(int); ok {
+		if b, ok := y.(int); ok {
+			switch op {
+			case "+":
+				return a + b, nil
+			case "-":
+				return a - b, nil
+			case "*":
+				return a * b, nil
+			}
+			if b == 0 {
+				return nil, fmt.Errorf("query: division by zero")
+			}
+			if op == "/" {
+				return a / b, nil
+			}
+			return a % b, nil
+		}
+	}
+	a, aok := value.ToFloat(x)
+	b, bok := value.ToFloat(y)
+	if !aok || !bok {
+		return nil, fmt.Errorf("query: cannot apply %s to %T and %T", op, x, y)
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	if b == 0 {
+		return nil, fmt.Errorf("query: division by zero")
+	}
+	if op == "/" {
+		return a / b, nil
+	}
+	return math.Mod(a, b), nil
+}
+
+// ops maps the aggregate functions to their operations.
+var ops = map[string]value.Op{
+	"COUNT": value.Count,
+	"SUM":   value.Sum,
+	"AVG":   value.Mean,
+	"MIN":   value.Min,
+	"MAX":   value.Max,
+}
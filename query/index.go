@@ -0,0 +1,79 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package query
+
+import (
+	"github.com/google/godata"
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// first returns the first row of the Frame, or nil if it is empty.
+func first(f *godata.Frame) row.Data {
+	var data row.Data
+	f.ForEach(func(d row.Data) error {
+		data = d
+		return errStop
+	})
+	return data
+}
+
+// flipped maps comparison operators to the operators comparing their operands
+// in the opposite order.
+var flipped = map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// constraint returns the constraint if the expression compares an index
+// column of the first table with a literal.
+func (p *plan) constraint(e expr) (value.Constraint, bool) {
+	b, ok := e.(*binaryExpr)
+	if !ok || flipped[b.op] == "" {
+		return value.Constraint{}, false
+	}
+	op, x, y := b.op, b.x, b.y
+	if _, ok := x.(*literal); ok {
+		op, x, y = flipped[op], y, x
+	}
+	r, ok := x.(*columnRef)
+	if !ok {
+		return value.Constraint{}, false
+	}
+	if lo, hi := p.span(r); lo != 0 || hi != 0 {
+		return value.Constraint{}, false
+	}
+	l, ok := y.(*literal)
+	if !ok {
+		return value.Constraint{}, false
+	}
+	if op == "=" {
+		op = "=="
+	}
+	return value.Constraint{Column: r.column, Op: op, Value: l.value}, true
+}
+
+// indexRange bounds the scan of the first table by the filters that constrain
+// its leading index columns. The filters are still applied to the rows scanned,
+// so the range only needs to contain the matching rows.
+func (p *plan) indexRange() {
+	f := p.frames[0]
+	var constraints []value.Constraint
+	for _, c := range p.filters[0] {
+		if constraint, ok := p.constraint(c); ok {
+			constraints = append(constraints, constraint)
+		}
+	}
+	if constraints == nil {
+		return
+	}
+	p.greaterOrEqual, p.lessThan, _ = value.IndexRange(row.IndexColumns(f.Indexer()), first(f), constraints)
+}
@@ -0,0 +1,499 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrSyntax is returned for queries that cannot be parsed.
+type ErrSyntax struct {
+	// Offset is the byte offset of the error in the query.
+	Offset int
+
+	// Msg describes the error.
+	Msg string
+}
+
+func (e *ErrSyntax) Error() string {
+	return fmt.Sprintf("query: syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuoted
+	tokNumber
+	tokString
+	tokOp
+)
+
+// token is a lexical token of a query. The text of quoted identifiers and
+// strings is unquoted.
+type token struct {
+	kind     tokenKind
+	text     string
+	pos, end int
+}
+
+// operators are the operator tokens, longest first.
+var operators = []string{"<=", ">=", "<>", "!=", "||", "(", ")", ",", ".", "*", "+", "-", "/", "%", "=", "<", ">", ";"}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// lex splits the query into tokens, ending with a tokEOF token.
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case strings.HasPrefix(src[i:], "--"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case isLetter(c):
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start, i})
+		case isDigit(c) || c == '.' && i+1 < len(src) && isDigit(src[i+1]):
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && isDigit(src[j]) {
+					for i = j; i < len(src) && isDigit(src[i]); i++ {
+					}
+				}
+			}
+			toks = append(toks, token{tokNumber, src[start:i], start, i})
+		case c == '\'' || c == '"' || c == '`':
+			// Quotes are escaped by doubling them.
+			var b strings.Builder
+			for i++; ; i++ {
+				if i == len(src) {
+					return nil, &ErrSyntax{start, "unterminated quote"}
+				}
+				if src[i] == c {
+					if i+1 == len(src) || src[i+1] != c {
+						break
+					}
+					i++
+				}
+				b.WriteByte(src[i])
+			}
+			i++
+			kind := tokQuoted
+			if c == '\'' {
+				kind = tokString
+			}
+			toks = append(toks, token{kind, b.String(), start, i})
+		default:
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					i += len(op)
+					toks = append(toks, token{tokOp, op, start, i})
+					break
+				}
+			}
+			if i == start {
+				return nil, &ErrSyntax{start, fmt.Sprintf("unexpected character %q", c)}
+			}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src), len(src)}), nil
+}
+
+// reserved are the keywords that cannot be used as unquoted identifiers.
+var reserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true,
+	"HAVING": true, "ORDER": true, "ASC": true, "DESC": true, "LIMIT": true,
+	"OFFSET": true, "JOIN": true, "INNER": true, "LEFT": true, "OUTER": true,
+	"ON": true, "AS": true, "AND": true, "OR": true, "NOT": true, "IS": true,
+	"NULL": true, "TRUE": true, "FALSE": true,
+}
+
+// aggregates are the names of the aggregate functions.
+var aggregates = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+// parser parses a token stream into a Query. Errors are raised by panicking
+// with an *ErrSyntax, which Parse recovers.
+type parser struct {
+	src  string
+	toks []token
+	i    int
+	q    *Query
+
+	// allowAggregates is true while parsing clauses that may contain
+	// aggregates, and inAggregate while parsing the argument of one.
+	allowAggregates, inAggregate bool
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) {
+	panic(&ErrSyntax{t.pos, fmt.Sprintf(format, args...)})
+}
+
+// keyword consumes the next token if it is the given keyword.
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) {
+	if !p.keyword(kw) {
+		p.errorf(p.peek(), "expected %s", kw)
+	}
+}
+
+// op consumes the next token if it is the given operator.
+func (p *parser) op(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectOp(op string) {
+	if !p.op(op) {
+		p.errorf(p.peek(), "expected %q", op)
+	}
+}
+
+// isIdent returns true if the token is an identifier.
+func isIdent(t token) bool {
+	return t.kind == tokQuoted || t.kind == tokIdent && !reserved[strings.ToUpper(t.text)]
+}
+
+func (p *parser) ident() string {
+	t := p.next()
+	if !isIdent(t) {
+		p.errorf(t, "expected identifier")
+	}
+	return t.text
+}
+
+// alias parses an optional alias, introduced by AS or given directly.
+func (p *parser) alias() string {
+	if p.keyword("AS") || isIdent(p.peek()) {
+		return p.ident()
+	}
+	return ""
+}
+
+func (p *parser) parseQuery() {
+	q := p.q
+	p.expectKeyword("SELECT")
+	p.allowAggregates = true
+	for {
+		q.items = append(q.items, p.parseSelectItem())
+		if !p.op(",") {
+			break
+		}
+	}
+	p.allowAggregates = false
+
+	p.expectKeyword("FROM")
+	q.tables = append(q.tables, p.parseTableRef())
+	for {
+		var left bool
+		switch {
+		case p.keyword("LEFT"):
+			p.keyword("OUTER")
+			p.expectKeyword("JOIN")
+			left = true
+		case p.keyword("INNER"):
+			p.expectKeyword("JOIN")
+		case p.keyword("JOIN"):
+		default:
+			goto joined
+		}
+		t := p.parseTableRef()
+		t.left = left
+		p.expectKeyword("ON")
+		t.on = p.parseExpr()
+		q.tables = append(q.tables, t)
+	}
+joined:
+
+	if p.keyword("WHERE") {
+		q.where = p.parseExpr()
+	}
+	if p.keyword("GROUP") {
+		p.expectKeyword("BY")
+		for {
+			q.groupBy = append(q.groupBy, p.parseExpr())
+			if !p.op(",") {
+				break
+			}
+		}
+	}
+	p.allowAggregates = true
+	if p.keyword("HAVING") {
+		q.having = p.parseExpr()
+	}
+	if p.keyword("ORDER") {
+		p.expectKeyword("BY")
+		for {
+			item := orderItem{expr: p.parseExpr()}
+			if p.keyword("DESC") {
+				item.desc = true
+			} else {
+				p.keyword("ASC")
+			}
+			q.orderBy = append(q.orderBy, item)
+			if !p.op(",") {
+				break
+			}
+		}
+	}
+	p.allowAggregates = false
+	if p.keyword("LIMIT") {
+		q.limit = p.count()
+		if p.keyword("OFFSET") {
+			q.offset = p.count()
+		}
+	}
+	p.op(";")
+	if t := p.peek(); t.kind != tokEOF {
+		p.errorf(t, "unexpected %q", t.text)
+	}
+}
+
+// count parses a non-negative integer.
+func (p *parser) count() int {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != tokNumber || err != nil || n < 0 {
+		p.errorf(t, "expected non-negative integer")
+	}
+	return n
+}
+
+func (p *parser) parseSelectItem() selectItem {
+	if p.op("*") {
+		return selectItem{star: true}
+	}
+	if t := p.peek(); isIdent(t) && p.toks[p.i+1].text == "." && p.toks[p.i+2].text == "*" {
+		p.i += 3
+		return selectItem{star: true, table: t.text}
+	}
+	start := p.peek().pos
+	item := selectItem{expr: p.parseExpr()}
+	item.name = p.src[start:p.toks[p.i-1].end]
+	if c, ok := item.expr.(*columnRef); ok {
+		item.name = c.column
+	}
+	if alias := p.alias(); alias != "" {
+		item.name = alias
+	}
+	return item
+}
+
+func (p *parser) parseTableRef() tableRef {
+	t := tableRef{name: p.ident()}
+	t.alias = p.alias()
+	if t.alias == "" {
+		t.alias = t.name
+	}
+	return t
+}
+
+func (p *parser) parseExpr() expr {
+	x := p.parseAnd()
+	for p.keyword("OR") {
+		x = &binaryExpr{op: "OR", x: x, y: p.parseAnd()}
+	}
+	return x
+}
+
+func (p *parser) parseAnd() expr {
+	x := p.parseNot()
+	for p.keyword("AND") {
+		x = &binaryExpr{op: "AND", x: x, y: p.parseNot()}
+	}
+	return x
+}
+
+func (p *parser) parseNot() expr {
+	if p.keyword("NOT") {
+		return &unaryExpr{op: "NOT", x: p.parseNot()}
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() expr {
+	x := p.parseAdditive()
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		p.expectKeyword("NULL")
+		return &isNullExpr{x: x, not: not}
+	}
+	for _, op := range []string{"=", "<>", "!=", "<", "<=", ">", ">="} {
+		if p.op(op) {
+			if op == "!=" {
+				op = "<>"
+			}
+			return &binaryExpr{op: op, x: x, y: p.parseAdditive()}
+		}
+	}
+	return x
+}
+
+func (p *parser) parseAdditive() expr {
+	x := p.parseMultiplicative()
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "+" && t.text != "-" && t.text != "||") {
+			return x
+		}
+		p.i++
+		x = &binaryExpr{op: t.text, x: x, y: p.parseMultiplicative()}
+	}
+}
+
+func (p *parser) parseMultiplicative() expr {
+	x := p.parseUnary()
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return x
+		}
+		p.i++
+		x = &binaryExpr{op: t.text, x: x, y: p.parseUnary()}
+	}
+}
+
+func (p *parser) parseUnary() expr {
+	if p.op("-") {
+		x := p.parseUnary()
+		// Fold negative numbers into literals, so that they can bound index
+		// ranges.
+		if l, ok := x.(*literal); ok {
+			switch v := l.value.(type) {
+			case int:
+				return &literal{-v}
+			case float64:
+				return &literal{-v}
+			}
+		}
+		return &unaryExpr{op: "-", x: x}
+	}
+	if p.op("+") {
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() expr {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		if n, err := strconv.Atoi(t.text); err == nil {
+			return &literal{n}
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.errorf(t, "invalid number %q", t.text)
+		}
+		return &literal{f}
+	case tokString:
+		return &literal{t.text}
+	case tokOp:
+		if t.text == "(" {
+			x := p.parseExpr()
+			p.expectOp(")")
+			return x
+		}
+	case tokIdent:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			return &literal{nil}
+		case "TRUE":
+			return &literal{true}
+		case "FALSE":
+			return &literal{false}
+		}
+	}
+	if !isIdent(t) {
+		p.errorf(t, "unexpected %q", t.text)
+	}
+	if t.kind == tokIdent && p.op("(") {
+		return p.parseAggregate(t)
+	}
+	if p.op(".") {
+		return &columnRef{table: t.text, column: p.ident()}
+	}
+	return &columnRef{column: t.text}
+}
+
+// parseAggregate parses the arguments of the aggregate function named by the
+// token.
+func (p *parser) parseAggregate(t token) expr {
+	fn := strings.ToUpper(t.text)
+	switch {
+	case !aggregates[fn]:
+		p.errorf(t, "unknown function %s", t.text)
+	case !p.allowAggregates:
+		p.errorf(t, "aggregate %s not allowed here", fn)
+	case p.inAggregate:
+		p.errorf(t, "nested aggregate %s", fn)
+	}
+	a := &aggregateExpr{fn: fn, id: len(p.q.aggregates)}
+	if fn == "COUNT" && p.op("*") {
+		p.expectOp(")")
+	} else {
+		p.inAggregate = true
+		a.arg = p.parseExpr()
+		p.inAggregate = false
+		p.expectOp(")")
+	}
+	p.q.aggregates = append(p.q.aggregates, a)
+	return a
+}
@@ -0,0 +1,617 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package query
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/godata"
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// plan is a Query bound to Frames.
+type plan struct {
+	q       *Query
+	aliases []string
+	frames  []*godata.Frame
+
+	// filters are the conjuncts of the WHERE clause, applied as soon as the
+	// tables they reference are joined: filters[i] once the ith table is.
+	filters [][]expr
+
+	// greaterOrEqual and lessThan bound the scan of the first table if not nil.
+	greaterOrEqual, lessThan row.Data
+
+	// joins[i] joins the ith table, for i > 0.
+	joins []*join
+
+	// grouped is true if the query computes aggregates over groups.
+	grouped bool
+}
+
+// join joins a table to the rows of the previous tables.
+type join struct {
+	left bool
+	on   expr
+
+	// inner and outer are the sides of the equalities of the ON clause, which
+	// reference the joined table and the previous tables respectively.
+	inner, outer []expr
+
+	// lookup is true if the rows are found with GetAll, setting the index
+	// columns to the values of keys.
+	lookup  bool
+	columns []string
+	keys    []expr
+	types   value.Types
+}
+
+// errStop stops a ForEach.
+var errStop = errors.New("stop")
+
+// walk calls fn for the expression and all its subexpressions.
+func walk(e expr, fn func(expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch e := e.(type) {
+	case *unaryExpr:
+		walk(e.x, fn)
+	case *binaryExpr:
+		walk(e.x, fn)
+		walk(e.y, fn)
+	case *isNullExpr:
+		walk(e.x, fn)
+	case *aggregateExpr:
+		walk(e.arg, fn)
+	}
+}
+
+// conjuncts splits an expression into the operands of its top-level ANDs.
+func conjuncts(e expr) []expr {
+	if b, ok := e.(*binaryExpr); ok && b.op == "AND" {
+		return append(conjuncts(b.x), conjuncts(b.y)...)
+	}
+	if e == nil {
+		return nil
+	}
+	return []expr{e}
+}
+
+// alias returns the index of the table with the alias, or -1.
+func (p *plan) alias(alias string) int {
+	for i, a := range p.aliases {
+		if a == alias {
+			return i
+		}
+	}
+	return -1
+}
+
+// span returns the lowest and highest index of the tables referenced by the
+// expression, or -1, -1 if it references none. Unqualified columns may refer to
+// any table.
+func (p *plan) span(e expr) (lo, hi int) {
+	lo, hi = -1, -1
+	walk(e, func(e expr) {
+		r, ok := e.(*columnRef)
+		if !ok {
+			return
+		}
+		first, last := 0, len(p.aliases)-1
+		if r.table != "" {
+			first = p.alias(r.table)
+			last = first
+		}
+		if lo < 0 || first < lo {
+			lo = first
+		}
+		if last > hi {
+			hi = last
+		}
+	})
+	return lo, hi
+}
+
+func (q *Query) plan(tables map[string]*godata.Frame) (*plan, error) {
+	p := &plan{
+		q:       q,
+		grouped: len(q.groupBy) > 0 || len(q.aggregates) > 0 || q.having != nil,
+	}
+	for _, t := range q.tables {
+		f, ok := tables[t.name]
+		if !ok {
+			return nil, fmt.Errorf("query: unknown table %q", t.name)
+		}
+		if p.alias(t.alias) >= 0 {
+			return nil, fmt.Errorf("query: duplicate table %q", t.alias)
+		}
+		p.aliases = append(p.aliases, t.alias)
+		p.frames = append(p.frames, f)
+	}
+
+	var err error
+	check := func(e expr) {
+		if r, ok := e.(*columnRef); ok && r.table != "" && p.alias(r.table) < 0 && err == nil {
+			err = fmt.Errorf("query: unknown table %q", r.table)
+		}
+	}
+	for _, item := range q.items {
+		switch {
+		case item.star && p.grouped:
+			return nil, fmt.Errorf("query: cannot select * from groups")
+		case item.star && item.table != "" && p.alias(item.table) < 0:
+			return nil, fmt.Errorf("query: unknown table %q", item.table)
+		}
+		walk(item.expr, check)
+	}
+	for i, t := range q.tables {
+		walk(t.on, check)
+		if _, hi := p.span(t.on); err == nil && hi > i {
+			return nil, fmt.Errorf("query: ON clause of %q references a later table", t.alias)
+		}
+	}
+	walk(q.where, check)
+	for _, e := range q.groupBy {
+		walk(e, check)
+	}
+	walk(q.having, check)
+	for _, item := range q.orderBy {
+		walk(item.expr, check)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.filters = make([][]expr, len(p.aliases))
+	for _, c := range conjuncts(q.where) {
+		_, hi := p.span(c)
+		if hi < 0 {
+			hi = 0
+		}
+		p.filters[hi] = append(p.filters[hi], c)
+	}
+	p.indexRange()
+	p.joins = make([]*join, len(p.aliases))
+	for i := 1; i < len(p.aliases); i++ {
+		p.joins[i] = p.planJoin(i)
+	}
+	return p, nil
+}
+
+// planJoin chooses how to find the rows of the ith table matching the rows of
+// the previous tables.
+func (p *plan) planJoin(i int) *join {
+	t := p.q.tables[i]
+	j := &join{left: t.left, on: t.on}
+	for _, c := range conjuncts(t.on) {
+		b, ok := c.(*binaryExpr)
+		if !ok || b.op != "=" {
+			continue
+		}
+		x, y := b.x, b.y
+		if lo, hi := p.span(y); lo == i && hi == i {
+			x, y = y, x
+		}
+		if lo, hi := p.span(x); lo != i || hi != i {
+			continue
+		}
+		if _, hi := p.span(y); hi >= i {
+			continue
+		}
+		j.inner = append(j.inner, x)
+		j.outer = append(j.outer, y)
+	}
+
+	columns := row.IndexColumns(p.frames[i].Indexer())
+	keys := make([]expr, len(columns))
+	for k, col := range columns {
+		for e, x := range j.inner {
+			if r, ok := x.(*columnRef); ok && r.column == col {
+				keys[k] = j.outer[e]
+			}
+		}
+		if keys[k] == nil {
+			return j
+		}
+	}
+	if len(columns) > 0 {
+		j.lookup, j.columns, j.keys = true, columns, keys
+		j.types = value.TypesOf(first(p.frames[i]), columns)
+	}
+	return j
+}
+
+// forEach calls the action for the rows of the Frame in the range, if given.
+func forEach(f *godata.Frame, greaterOrEqual, lessThan row.Data, action func(row.Data) error) error {
+	switch {
+	case greaterOrEqual != nil && lessThan != nil:
+		return f.ForEach(action, godata.GreaterOrEqual(greaterOrEqual), godata.LessThan(lessThan))
+	case greaterOrEqual != nil:
+		return f.ForEach(action, godata.GreaterOrEqual(greaterOrEqual))
+	case lessThan != nil:
+		return f.ForEach(action, godata.LessThan(lessThan))
+	}
+	return f.ForEach(action)
+}
+
+// result is a row of the result, with the context it was computed in.
+type result struct {
+	c      *context
+	names  []string
+	values []interface{}
+
+	// keys are the values of the ORDER BY expressions.
+	keys []interface{}
+}
+
+func (p *plan) run() ([]row.Data, error) {
+	tuples, err := p.scan()
+	for i := 1; i < len(p.frames) && err == nil; i++ {
+		tuples, err = p.join(i, tuples)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*result
+	if p.grouped {
+		results, err = p.group(tuples)
+	} else {
+		for _, tuple := range tuples {
+			var r *result
+			if r, err = p.project(&context{aliases: p.aliases, rows: tuple}); err != nil {
+				break
+			}
+			results = append(results, r)
+		}
+	}
+	if err == nil {
+		err = p.sort(results)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.q.offset < len(results) {
+		results = results[p.q.offset:]
+	} else {
+		results = nil
+	}
+	if p.q.limit >= 0 && p.q.limit < len(results) {
+		results = results[:p.q.limit]
+	}
+	rows := make([]row.Data, len(results))
+	for i, r := range results {
+		rows[i] = make(row.Data, len(r.names))
+		for k, name := range r.names {
+			if r.values[k] != nil {
+				rows[i][name] = r.values[k]
+			} else {
+				delete(rows[i], name)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// filter returns true if the joined rows satisfy the filters applied once the
+// ith table is joined.
+func (p *plan) filter(i int, tuple []row.Data) (bool, error) {
+	c := &context{aliases: p.aliases[:len(tuple)], rows: tuple}
+	for _, f := range p.filters[i] {
+		if v, err := truth(f, c); err != nil || v != true {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// scan returns the rows of the first table that satisfy its filters.
+func (p *plan) scan() ([][]row.Data, error) {
+	// Without joins, groups or ordering, the scan stops at the limit.
+	limit := -1
+	if len(p.frames) == 1 && !p.grouped && p.q.orderBy == nil && p.q.limit >= 0 {
+		limit = p.q.offset + p.q.limit
+	}
+	var tuples [][]row.Data
+	err := forEach(p.frames[0], p.greaterOrEqual, p.lessThan, func(data row.Data) error {
+		if len(tuples) == limit {
+			return errStop
+		}
+		tuple := []row.Data{data}
+		ok, err := p.filter(0, tuple)
+		if ok {
+			tuples = append(tuples, tuple)
+		}
+		return err
+	})
+	if err == errStop {
+		err = nil
+	}
+	return tuples, err
+}
+
+// join joins the ith table to the rows of the previous tables.
+func (p *plan) join(i int, tuples [][]row.Data) ([][]row.Data, error) {
+	var (
+		j      = p.joins[i]
+		f      = p.frames[i]
+		all    []row.Data
+		hashed map[string][]row.Data
+		err    error
+	)
+	switch {
+	case j.lookup:
+	case j.inner != nil:
+		hashed = make(map[string][]row.Data)
+		err = f.ForEach(func(data row.Data) error {
+			rows := make([]row.Data, i+1)
+			rows[i] = data
+			key, ok, err := hashValues(j.inner, &context{aliases: p.aliases[:i+1], rows: rows})
+			if ok {
+				hashed[key] = append(hashed[key], data)
+			}
+			return err
+		})
+	default:
+		all, err = f.GetRange()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var joined [][]row.Data
+	for _, tuple := range tuples {
+		candidates := all
+		switch {
+		case j.lookup:
+			candidates, err = p.lookup(j, i, tuple)
+		case hashed != nil:
+			var (
+				key string
+				ok  bool
+			)
+			key, ok, err = hashValues(j.outer, &context{aliases: p.aliases[:i], rows: tuple})
+			candidates = nil
+			if ok {
+				candidates = hashed[key]
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		matched := false
+		for _, data := range candidates {
+			next := append(tuple[:i:i], data)
+			v, err := truth(j.on, &context{aliases: p.aliases[:i+1], rows: next})
+			if err != nil {
+				return nil, err
+			}
+			if v != true {
+				continue
+			}
+			matched = true
+			ok, err := p.filter(i, next)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				joined = append(joined, next)
+			}
+		}
+		if !matched && j.left {
+			next := append(tuple[:i:i], nil)
+			ok, err := p.filter(i, next)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				joined = append(joined, next)
+			}
+		}
+	}
+	return joined, nil
+}
+
+// lookup returns the rows of the ith table whose index matches the rows of the
+// previous tables.
+func (p *plan) lookup(j *join, i int, tuple []row.Data) ([]row.Data, error) {
+	c := &context{aliases: p.aliases[:i], rows: tuple}
+	key := make(row.Data)
+	for k, col := range j.columns {
+		v, err := j.keys[k].eval(c)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := j.types.Convert(col, v)
+		if !ok {
+			return nil, nil
+		}
+		key[col] = v
+	}
+	return p.frames[i].GetAll(key)
+}
+
+// hashValues returns the value.Key of the values of the expressions, and false if
+// any value is NULL.
+func hashValues(exprs []expr, c *context) (string, bool, error) {
+	vals := make([]interface{}, len(exprs))
+	for k, e := range exprs {
+		v, err := e.eval(c)
+		if err != nil || v == nil {
+			return "", false, err
+		}
+		vals[k] = v
+	}
+	return value.Key(vals), true, nil
+}
+
+// group computes the groups of the rows and their aggregates, and returns a
+// result for each group that satisfies the HAVING clause.
+func (p *plan) group(tuples [][]row.Data) ([]*result, error) {
+	type state struct {
+		first []row.Data
+		accs  []*value.Accumulator
+	}
+	newState := func(first []row.Data) *state {
+		s := &state{first: first}
+		for _, a := range p.q.aggregates {
+			s.accs = append(s.accs, &value.Accumulator{Op: ops[a.fn]})
+		}
+		return s
+	}
+
+	var (
+		groups = make(map[string]*state)
+		order  []*state
+		vals   = make([]interface{}, len(p.q.groupBy))
+	)
+	for _, tuple := range tuples {
+		c := &context{aliases: p.aliases, rows: tuple}
+		for k, e := range p.q.groupBy {
+			v, err := e.eval(c)
+			if err != nil {
+				return nil, err
+			}
+			vals[k] = v
+		}
+		key := value.Key(vals)
+		s, ok := groups[key]
+		if !ok {
+			s = newState(tuple)
+			groups[key] = s
+			order = append(order, s)
+		}
+		for k, a := range p.q.aggregates {
+			var v interface{} = true
+			if a.arg != nil {
+				var err error
+				if v, err = a.arg.eval(c); err != nil {
+					return nil, err
+				}
+			}
+			if err := s.accs[k].Add(v); err != nil {
+				return nil, fmt.Errorf("query: %v", err)
+			}
+		}
+	}
+	// Aggregates without GROUP BY return a row even if there are no rows.
+	if order == nil && p.q.groupBy == nil {
+		order = append(order, newState(make([]row.Data, len(p.aliases))))
+	}
+
+	var results []*result
+	for _, s := range order {
+		c := &context{aliases: p.aliases, rows: s.first, aggs: make([]interface{}, len(s.accs))}
+		for k, acc := range s.accs {
+			c.aggs[k] = acc.Result()
+		}
+		r, err := p.project(c)
+		if err != nil {
+			return nil, err
+		}
+		if p.q.having != nil {
+			c.selected = r
+			v, err := truth(p.q.having, c)
+			if err != nil {
+				return nil, err
+			}
+			if v != true {
+				continue
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// project computes the selected columns in the context.
+func (p *plan) project(c *context) (*result, error) {
+	r := &result{c: c}
+	for _, item := range p.q.items {
+		if !item.star {
+			v, err := item.expr.eval(c)
+			if err != nil {
+				return nil, err
+			}
+			r.names = append(r.names, item.name)
+			r.values = append(r.values, v)
+			continue
+		}
+		for i, data := range c.rows {
+			if item.table != "" && item.table != p.aliases[i] {
+				continue
+			}
+			for col, v := range data {
+				if item.table == "" && len(c.rows) > 1 {
+					col = p.aliases[i] + "." + col
+				}
+				r.names = append(r.names, col)
+				r.values = append(r.values, v)
+			}
+		}
+	}
+	return r, nil
+}
+
+// sort sorts the results by the ORDER BY clause. NULL sorts first.
+func (p *plan) sort(results []*result) error {
+	if p.q.orderBy == nil {
+		return nil
+	}
+	for _, r := range results {
+		r.c.selected = r
+		for _, item := range p.q.orderBy {
+			v, err := item.expr.eval(r.c)
+			if err != nil {
+				return err
+			}
+			r.keys = append(r.keys, v)
+		}
+	}
+
+	var err error
+	sort.SliceStable(results, func(a, b int) bool {
+		for k, item := range p.q.orderBy {
+			x, y := results[a].keys[k], results[b].keys[k]
+			var cmp int
+			switch {
+			case x == nil && y == nil:
+			case x == nil:
+				cmp = -1
+			case y == nil:
+				cmp = 1
+			default:
+				var e error
+				if cmp, e = compare(x, y); e != nil && err == nil {
+					err = e
+				}
+			}
+			if item.desc {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+	return err
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package query runs SQL queries over named Frames. A subset of SELECT is
+// supported:
+//
+//	SELECT * | table.* | expr [[AS] name], ...
+//	FROM table [[AS] alias]
+//	[[INNER | LEFT [OUTER]] JOIN table [[AS] alias] ON expr] ...
+//	[WHERE expr]
+//	[GROUP BY expr, ...]
+//	[HAVING expr]
+//	[ORDER BY expr [ASC | DESC], ...]
+//	[LIMIT count [OFFSET count]]
+//
+// Expressions are built from column references, optionally qualified by the
+// table alias, integer, floating point, 'string', TRUE, FALSE and NULL
+// literals, the operators OR, AND, NOT, =, <> (or !=), <, <=, >, >=, IS [NOT]
+// NULL, +, -, *, /, % and || (string concatenation), and the aggregates
+// COUNT(*), COUNT, SUM, AVG, MIN and MAX.
+//
+// Missing columns and nil values are NULL. Integers of every size are
+// computed as int, and mixed with floating point numbers as float64. Numbers
+// are compared exactly by value, with NaN less than every other number.
+// Comparing values of other different types is an error. Logic is
+// three-valued, and rows are kept by WHERE, HAVING and ON only if the
+// condition is TRUE.
+//
+// Unqualified columns are looked up in every joined table, and are an error
+// if more than one of the joined rows contains them. Columns selected by an
+// expression are named by the alias, by the column for column references, and
+// by the text of the expression otherwise. * selects every column, named
+// "alias.column" if the query joins several tables. Values that are NULL are
+// left out of the result rows.
+//
+// Queries are run directly on the Frames. If the first table is indexed by a
+// ColumnIndexer, then the conjuncts of the WHERE clause that compare its
+// leading index columns with literals restrict the rows scanned to a range
+// of the index. Joined tables are looked up by index if the ON clause equates
+// every column of their ColumnIndexer with the previous tables, and are
+// otherwise hashed on the equalities of the ON clause, or scanned for every
+// row. Groups are returned in the order of their first row unless the query
+// is ordered.
+package query
+
+import (
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+)
+
+// Query is a parsed query, which may be run any number of times.
+type Query struct {
+	items   []selectItem
+	tables  []tableRef
+	where   expr
+	groupBy []expr
+	having  expr
+	orderBy []orderItem
+
+	// limit is -1 if the query has no LIMIT.
+	limit, offset int
+
+	// aggregates are the aggregates of the query, by id.
+	aggregates []*aggregateExpr
+}
+
+// selectItem is an expression of the SELECT clause.
+type selectItem struct {
+	expr expr
+	name string
+
+	// star is true for * and table.*, which select every column of every
+	// table or of the given table.
+	star  bool
+	table string
+}
+
+// tableRef is the FROM table, or a joined table.
+type tableRef struct {
+	name, alias string
+	left        bool
+	on          expr
+}
+
+type orderItem struct {
+	expr expr
+	desc bool
+}
+
+// Parse parses the query. Returns an *ErrSyntax if the query is invalid.
+func Parse(query string) (q *Query, err error) {
+	toks, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: query, toks: toks, q: &Query{limit: -1}}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*ErrSyntax)
+			if !ok {
+				panic(r)
+			}
+			q, err = nil, e
+		}
+	}()
+	p.parseQuery()
+	return p.q, nil
+}
+
+// Run parses the query and runs it over the Frames, which are named by the
+// tables map. See Query.Run.
+func Run(query string, tables map[string]*godata.Frame) ([]row.Data, error) {
+	q, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return q.Run(tables)
+}
+
+// Run runs the query over the Frames, which are named by the tables map, and
+// returns the result rows in order. The Frames must not be modified while the
+// query runs.
+func (q *Query) Run(tables map[string]*godata.Frame) ([]row.Data, error) {
+	p, err := q.plan(tables)
+	if err != nil {
+		return nil, err
+	}
+	return p.run()
+}
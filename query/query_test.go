@@ -0,0 +1,215 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package query
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+)
+
+// testTables returns a users table indexed by id, and an orders table indexed
+// by user and order number.
+func testTables() map[string]*godata.Frame {
+	users := godata.NewFrame(row.NewColumnIndexer("id"))
+	users.Put(row.Of("id", 1, "name", "ann", "region", "EU"))
+	users.Put(row.Of("id", 2, "name", "bob", "region", "US"))
+	users.Put(row.Of("id", 3, "name", "cat", "region", "EU"))
+	users.Put(row.Of("id", 4, "name", "dan"))
+
+	orders := godata.NewFrame(row.NewColumnIndexer("user", "n"))
+	orders.Put(row.Of("user", 1, "n", 1, "price", 10.0, "qty", 2))
+	orders.Put(row.Of("user", 1, "n", 2, "price", 5.5, "qty", 1))
+	orders.Put(row.Of("user", 2, "n", 1, "price", 100.0, "qty", 3))
+	orders.Put(row.Of("user", 3, "n", 1, "price", 1.0, "qty", 7))
+	orders.Put(row.Of("user", 3, "n", 2, "price", 2.0, "qty", int32(1)))
+	return map[string]*godata.Frame{"users": users, "orders": orders}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []row.Data
+	}{
+		{
+			"SELECT * FROM users WHERE id >= 3",
+			[]row.Data{
+				row.Of("id", 3, "name", "cat", "region", "EU"),
+				row.Of("id", 4, "name", "dan"),
+			},
+		},
+		{
+			"SELECT name, id * 10 AS x FROM users WHERE region = 'EU' OR region IS NULL ORDER BY name DESC",
+			[]row.Data{
+				row.Of("name", "dan", "x", 40),
+				row.Of("name", "cat", "x", 30),
+				row.Of("name", "ann", "x", 10),
+			},
+		},
+		{
+			"select name from users where not region = 'EU' limit 5",
+			[]row.Data{row.Of("name", "bob")},
+		},
+		{
+			"SELECT id FROM users ORDER BY id DESC LIMIT 2 OFFSET 1",
+			[]row.Data{row.Of("id", 3), row.Of("id", 2)},
+		},
+		{
+			"SELECT user, COUNT(*), SUM(price * qty) AS total FROM orders GROUP BY user HAVING total > 10",
+			[]row.Data{
+				row.Of("user", 1, "COUNT(*)", 2, "total", 25.5),
+				row.Of("user", 2, "COUNT(*)", 1, "total", 300.0),
+			},
+		},
+		{
+			"SELECT COUNT(*) AS n, SUM(qty) AS q, AVG(qty) AS a, MIN(price) AS lo, MAX(price) AS hi FROM orders",
+			[]row.Data{row.Of("n", 5, "q", 14, "a", 2.8, "lo", 1.0, "hi", 100.0)},
+		},
+		{
+			"SELECT COUNT(*) AS n, SUM(qty) AS q FROM orders WHERE user > 10",
+			[]row.Data{row.Of("n", 0)},
+		},
+		{
+			"SELECT u.name, o.n FROM users u JOIN orders o ON o.user = u.id WHERE o.price < 10 ORDER BY o.price",
+			[]row.Data{
+				row.Of("name", "cat", "n", 1),
+				row.Of("name", "cat", "n", 2),
+				row.Of("name", "ann", "n", 2),
+			},
+		},
+		{
+			"SELECT u.name, COUNT(o.n) AS orders FROM users AS u LEFT JOIN orders AS o ON u.id = o.user GROUP BY u.id ORDER BY orders, u.name",
+			[]row.Data{
+				row.Of("name", "dan", "orders", 0),
+				row.Of("name", "bob", "orders", 1),
+				row.Of("name", "ann", "orders", 2),
+				row.Of("name", "cat", "orders", 2),
+			},
+		},
+		{
+			"SELECT a.name || '/' || b.name AS pair FROM users a JOIN users b ON a.region = b.region AND a.id < b.id",
+			[]row.Data{row.Of("pair", "ann/cat")},
+		},
+		{
+			"SELECT * FROM users a JOIN orders b ON b.n > a.id AND b.user = 1",
+			[]row.Data{row.Of(
+				"a.id", 1, "a.name", "ann", "a.region", "EU",
+				"b.user", 1, "b.n", 2, "b.price", 5.5, "b.qty", 1,
+			)},
+		},
+	}
+	tables := testTables()
+	for _, test := range tests {
+		got, err := Run(test.query, tables)
+		if err != nil {
+			t.Errorf("Run(%q) failed: %v", test.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Run(%q) = %v; want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []string{
+		"SELECT",
+		"SELECT * FROM users WHERE",
+		"SELECT * FROM users WHERE name = 'ann",
+		"SELECT * FROM users WHERE COUNT(*) > 1",
+		"SELECT SUM(COUNT(*)) FROM users",
+		"SELECT LENGTH(name) FROM users",
+		"SELECT * FROM users LIMIT -1",
+		"SELECT * FROM missing",
+		"SELECT * FROM users JOIN users ON id = id",
+		"SELECT x.id FROM users",
+		"SELECT * FROM users GROUP BY region",
+		"SELECT * FROM users WHERE name > 1",
+		"SELECT id / 0 FROM users",
+		"SELECT SUM(name) FROM users",
+		"SELECT name FROM users a JOIN orders b ON a.id = b.user JOIN users c ON c.id = a.id",
+	}
+	tables := testTables()
+	for _, query := range tests {
+		if got, err := Run(query, tables); err == nil {
+			t.Errorf("Run(%q) = %v; want error", query, got)
+		}
+	}
+}
+
+func TestIndexRange(t *testing.T) {
+	tests := []struct {
+		where                    string
+		greaterOrEqual, lessThan row.Data
+	}{
+		{"", nil, nil},
+		{"price > 1", nil, nil},
+		{"user = 2", row.Of("user", 2, "n", math.MinInt), row.Of("user", 3, "n", math.MinInt)},
+		{"2 <= user AND user < 3", row.Of("user", 2, "n", math.MinInt), row.Of("user", 3, "n", math.MinInt)},
+		{"user > 1 AND user > 2 AND user <= 3", row.Of("user", 3, "n", math.MinInt), row.Of("user", 4, "n", math.MinInt)},
+		{"user = 1 AND n >= 2", row.Of("user", 1, "n", 2), row.Of("user", 2, "n", math.MinInt)},
+		{"user = 1 AND n = 2", row.Of("user", 1, "n", 2), row.Of("user", 1, "n", 3)},
+		{"user = 1.0 OR n = 2", nil, nil},
+		{"n = 2", nil, nil},
+		{"user = 'a'", nil, nil},
+		{"user < -1", nil, row.Of("user", -1, "n", math.MinInt)},
+	}
+	tables := testTables()
+	for _, test := range tests {
+		query := "SELECT * FROM orders"
+		if test.where != "" {
+			query += " WHERE " + test.where
+		}
+		q, err := Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", query, err)
+		}
+		p, err := q.plan(tables)
+		if err != nil {
+			t.Fatalf("plan(%q) failed: %v", query, err)
+		}
+		if !reflect.DeepEqual(p.greaterOrEqual, test.greaterOrEqual) || !reflect.DeepEqual(p.lessThan, test.lessThan) {
+			t.Errorf("plan(%q) scans [%v, %v); want [%v, %v)", query, p.greaterOrEqual, p.lessThan, test.greaterOrEqual, test.lessThan)
+		}
+	}
+
+	got, err := Run("SELECT n FROM orders WHERE user = 3 AND n > 1", tables)
+	if want := []row.Data{row.Of("n", 2)}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Run = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestJoinPlan(t *testing.T) {
+	tables := testTables()
+	for query, lookup := range map[string]bool{
+		"SELECT * FROM orders o JOIN users u ON u.id = o.user":             true,
+		"SELECT * FROM users u JOIN orders o ON o.user = u.id":             false,
+		"SELECT * FROM users u JOIN orders o ON o.user = u.id AND o.n = 1": true,
+	} {
+		q, err := Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", query, err)
+		}
+		p, err := q.plan(tables)
+		if err != nil {
+			t.Fatalf("plan(%q) failed: %v", query, err)
+		}
+		if j := p.joins[1]; j.lookup != lookup || j.inner == nil {
+			t.Errorf("plan(%q) looks up rows: %v; want %v", query, j.lookup, lookup)
+		}
+	}
+}
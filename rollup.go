@@ -0,0 +1,57 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"fmt"
+
+	"github.com/google/btree"
+	"github.com/google/godata/group"
+	"github.com/google/godata/row"
+)
+
+// Rollup returns a new Frame indexed by a group.SubtotalIndexer on the grouping
+// columns, containing the rows of group.Rollup for the rows of the Frame, which
+// aggregate each combination of values of the columns and add subtotals for
+// every prefix of the columns, marked by nil values.
+func (f *Frame) Rollup(columns []string, aggs map[string]group.Aggregate) (*Frame, error) {
+	return f.subtotals("Rollup", group.Rollup, columns, aggs)
+}
+
+// Cube returns a new Frame like Rollup, containing the rows of group.Cube,
+// which add subtotals for every subset of the grouping columns.
+func (f *Frame) Cube(columns []string, aggs map[string]group.Aggregate) (*Frame, error) {
+	return f.subtotals("Cube", group.Cube, columns, aggs)
+}
+
+// subtotals returns a new Frame containing the rows returned by the named
+// function for the rows of the Frame.
+func (f *Frame) subtotals(name string, subtotals func(group.Group, []string, map[string]group.Aggregate) (group.Group, error), columns []string, aggs map[string]group.Aggregate) (*Frame, error) {
+	g := make(group.Group, 0, f.Len())
+	f.bt.Ascend(func(item btree.Item) bool {
+		g = append(g, f.out(item.(row.Row).Data))
+		return true
+	})
+	rows, err := subtotals(g, columns, aggs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	b := NewBuilder(group.SubtotalIndexer{Columns: columns}, SizeHint(len(rows)), Degree(f.degree))
+	b.Add(rows...)
+	nf, err := b.Frame()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return nf, nil
+}
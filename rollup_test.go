@@ -0,0 +1,52 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"testing"
+
+	"github.com/google/godata/group"
+	"github.com/google/godata/row"
+)
+
+func TestRollup(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("id"))
+	f.Put(row.Of("id", 0, "region", "EU", "country", "FR", "amount", 1))
+	f.Put(row.Of("id", 1, "region", "EU", "country", "DE", "amount", 2))
+	f.Put(row.Of("id", 2, "region", "US", "country", "US", "amount", 4))
+
+	aggs := map[string]group.Aggregate{"total": group.Sum("amount"), "n": group.Count()}
+	rollup, err := f.Rollup([]string{"region", "country"}, aggs)
+	if err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+	if rollup.Len() != 6 {
+		t.Errorf("Rollup.Len() = %d; want 6", rollup.Len())
+	}
+	got, err := rollup.Get(row.Of("region", "EU", "country", nil))
+	if err != nil || got["total"] != 3 || got["n"] != 2 {
+		t.Errorf("Rollup.Get(EU, ALL) = %v, %v; want total 3 of 2 rows", got, err)
+	}
+
+	cube, err := f.Cube([]string{"region", "country"}, aggs)
+	if err != nil {
+		t.Fatalf("Cube: %v", err)
+	}
+	if got, _ := cube.Get(row.Of("region", nil, "country", "DE")); got["total"] != 2 {
+		t.Errorf("Cube.Get(ALL, DE) = %v; want total 2", got)
+	}
+	if _, err := f.Cube([]string{"amount", "region"}, map[string]group.Aggregate{"x": group.Sum("region")}); err == nil {
+		t.Errorf("Cube with a failing aggregate = nil error; want error")
+	}
+}
@@ -14,12 +14,21 @@ limitations under the License.
 package row
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"log"
 
 	"github.com/google/btree"
 )
 
+func init() {
+	gob.Register(NullIndex{})
+	gob.Register(MultiIndex{})
+	gob.Register(StringIndex(""))
+	gob.Register(IntIndex(0))
+}
+
 // Index compares rows.
 type Index interface {
 	// Less returns true if the index is less than the given Index or Row object.
@@ -38,8 +47,20 @@ func (n NullIndex) Less(btree.Item) bool {
 	return true
 }
 
+// GobEncode encodes the NullIndex, which has no contents.
+func (n NullIndex) GobEncode() ([]byte, error) {
+	return []byte{}, nil
+}
+
+// GobDecode decodes a NullIndex encoded by GobEncode.
+func (n *NullIndex) GobDecode([]byte) error {
+	return nil
+}
+
 // NewIndex returns an index for the given generic values. Returns error if the
-// values cannot be automatically converted to an index.
+// values cannot be automatically converted to an index. Only ints and strings
+// are supported, so packages that read data from other formats read integers
+// of every size as int, so that they may be indexed.
 func NewIndex(vals ...interface{}) (Index, error) {
 	var indices []Index
 
@@ -115,6 +136,21 @@ func (m MultiIndex) String() string {
 	return fmt.Sprintf("%v", m.indices)
 }
 
+// GobEncode encodes the constituent indices of the MultiIndex, which must be
+// registered with gob.
+func (m MultiIndex) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m.indices); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode decodes a MultiIndex encoded by GobEncode.
+func (m *MultiIndex) GobDecode(b []byte) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(&m.indices)
+}
+
 // StringIndex is a string.
 type StringIndex string
 
@@ -14,15 +14,33 @@ limitations under the License.
 package row
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"reflect"
 )
 
+func init() {
+	gob.Register(&ColumnIndexer{})
+}
+
 // Indexer returns an Index for a given row of data.
 type Indexer interface {
 	Index(data Data) (Index, error)
 }
 
+// IndexColumns returns the columns of the indexer if it is a ColumnIndexer, or
+// nil otherwise.
+func IndexColumns(indexer Indexer) []string {
+	switch c := indexer.(type) {
+	case *ColumnIndexer:
+		return c.Columns()
+	case ColumnIndexer:
+		return c.Columns()
+	}
+	return nil
+}
+
 // ColumnIndexer indexes the given column names using the default indexing
 // behavior of NewIndex. If a column does not exist for a given row, then the
 // column indexer fails. The indexer keeps track of the types associated with
@@ -42,6 +60,11 @@ func NewColumnIndexer(columns ...string) *ColumnIndexer {
 	}
 }
 
+// Columns returns the indexed columns in index order.
+func (c ColumnIndexer) Columns() []string {
+	return append([]string(nil), c.columns...)
+}
+
 // Index returns the index value for the given row. Returns error if the row
 // doesn't contain all necessary columns, or if the row contains values that
 // cannot be automatically converted into indices.
@@ -63,3 +86,23 @@ func (c ColumnIndexer) Index(data Data) (Index, error) {
 	}
 	return NewIndex(vals...)
 }
+
+// GobEncode encodes the columns of the ColumnIndexer. The column types seen so
+// far are not encoded.
+func (c ColumnIndexer) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(c.columns); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode decodes a ColumnIndexer encoded by GobEncode.
+func (c *ColumnIndexer) GobDecode(b []byte) error {
+	var columns []string
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&columns); err != nil {
+		return err
+	}
+	*c = *NewColumnIndexer(columns...)
+	return nil
+}
@@ -41,6 +41,19 @@ func Of(args ...interface{}) Data {
 	return data
 }
 
+// Copy returns a shallow copy of the Data. Rows in a Frame must not be mutated,
+// so a row is changed by putting a modified copy in its place.
+func (d Data) Copy() Data {
+	if d == nil {
+		return nil
+	}
+	data := make(map[string]interface{}, len(d))
+	for k, v := range d {
+		data[k] = v
+	}
+	return data
+}
+
 // Row represents a single entry in a Frame.
 type Row struct {
 	// Index contains the index for the row.
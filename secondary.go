@@ -0,0 +1,223 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"fmt"
+
+	"github.com/google/btree"
+	"github.com/google/godata/row"
+)
+
+// secondaryIndex orders the rows of a Frame by an additional indexer.
+type secondaryIndex struct {
+	bt *btree.BTree
+
+	// keys contains a primaryKey for each row, so that the entry of a row
+	// can be removed without indexing its data again, which may have changed.
+	keys *btree.BTree
+
+	indexer row.Indexer
+}
+
+// primaryKey is the secondary index of the row with the given primary index.
+type primaryKey struct {
+	primary row.Index
+	index   row.Index
+}
+
+// Less returns true if the primary index is less than that of the given
+// primaryKey.
+func (p primaryKey) Less(item btree.Item) bool {
+	return p.primary.Less(item.(primaryKey).primary)
+}
+
+// add adds the row with the given secondary index.
+func (s *secondaryIndex) add(r row.Row, index row.Index) {
+	s.bt.ReplaceOrInsert(secondaryItem{
+		index:   index,
+		primary: r.Index,
+		data:    r.Data,
+	})
+	s.keys.ReplaceOrInsert(primaryKey{primary: r.Index, index: index})
+}
+
+// remove removes the row with the given primary index.
+func (s *secondaryIndex) remove(primary row.Index) {
+	got := s.keys.Delete(primaryKey{primary: primary})
+	if got == nil {
+		return
+	}
+	s.bt.Delete(secondaryItem{
+		index:   got.(primaryKey).index,
+		primary: primary,
+	})
+}
+
+// secondaryItem is an entry of a secondaryIndex. Entries are ordered by the
+// secondary index, and then by the primary index, so that multiple rows may
+// share a secondary index.
+type secondaryItem struct {
+	// index is the secondary index of the row.
+	index row.Index
+
+	// primary is the index of the row in the Frame. A nil primary index sorts
+	// before all entries with the same secondary index, which allows the item to
+	// be used as a range pivot.
+	primary row.Index
+
+	// data contains the columns of data for the row.
+	data row.Data
+}
+
+// Less returns true if the item is less than the given secondaryItem.
+func (s secondaryItem) Less(item btree.Item) bool {
+	other := item.(secondaryItem)
+	if s.index.Less(other.index) {
+		return true
+	}
+	if other.index.Less(s.index) {
+		return false
+	}
+	if s.primary == nil || other.primary == nil {
+		return s.primary == nil && other.primary != nil
+	}
+	return s.primary.Less(other.primary)
+}
+
+// AddIndex adds a secondary index with the given name to the Frame. The
+// secondary index is kept in sync with the Frame by Put, Pop and PopRange, and
+// may be queried with GetBy and GetRangeBy. Unlike the Frame's own indexer, the
+// indexer may give the same Index to several rows. Returns error if the name is
+// already in use or if an existing row cannot be indexed, in which case the
+// Frame is unchanged. Once a secondary index exists, Put fails for rows that
+// the secondary indexer cannot index.
+func (f *Frame) AddIndex(name string, indexer row.Indexer) error {
+	if _, ok := f.secondary[name]; ok {
+		return fmt.Errorf("AddIndex: index %q already exists", name)
+	}
+
+	s := &secondaryIndex{
+		bt:      btree.NewWithFreeList(f.degree, f.freeList),
+		keys:    btree.NewWithFreeList(f.degree, f.freeList),
+		indexer: indexer,
+	}
+	var returnErr error
+	iter := func(item btree.Item) bool {
+		r := item.(row.Row)
+		index, err := indexer.Index(r.Data)
+		if err != nil {
+			returnErr = fmt.Errorf("AddIndex: %v", err)
+			return false
+		}
+		s.add(r, index)
+		return true
+	}
+	f.bt.Ascend(iter)
+	if returnErr != nil {
+		return returnErr
+	}
+
+	if f.secondary == nil {
+		f.secondary = make(map[string]*secondaryIndex)
+	}
+	f.secondary[name] = s
+	return nil
+}
+
+// DropIndex removes the secondary index with the given name. It is a no-op if
+// the index does not exist.
+func (f *Frame) DropIndex(name string) {
+	delete(f.secondary, name)
+}
+
+// GetBy returns all rows with the given key in the named secondary index,
+// ordered by their index in the Frame. Returns error if the index does not
+// exist or the key is invalid. Returns nil if there is no data for the given
+// key.
+func (f *Frame) GetBy(name string, key row.Data) ([]row.Data, error) {
+	s, ok := f.secondary[name]
+	if !ok {
+		return nil, fmt.Errorf("GetBy: no index %q", name)
+	}
+	index, err := s.indexer.Index(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []row.Data
+	s.bt.AscendGreaterOrEqual(secondaryItem{index: index}, func(item btree.Item) bool {
+		si := item.(secondaryItem)
+		if index.Less(si.index) {
+			return false
+		}
+		rows = append(rows, f.out(si.data))
+		return true
+	})
+	return rows, nil
+}
+
+// GetRangeBy returns a list of all values in the given range of the named
+// secondary index, ordered by the secondary index and then by their index in
+// the Frame. See GetRange for details on the arguments, which are indexed by the
+// secondary indexer. Returns error if the index does not exist.
+func (f *Frame) GetRangeBy(name string, args ...rangeArg) ([]row.Data, error) {
+	s, ok := f.secondary[name]
+	if !ok {
+		return nil, fmt.Errorf("GetRangeBy: no index %q", name)
+	}
+
+	var rows []row.Data
+	pivot := func(data row.Data) (btree.Item, error) {
+		index, err := s.indexer.Index(data)
+		if err != nil {
+			return nil, err
+		}
+		return secondaryItem{index: index}, nil
+	}
+	iterator := func(item btree.Item) bool {
+		rows = append(rows, f.out(item.(secondaryItem).data))
+		return true
+	}
+	if err := ascend(s.bt, rangeArgsToOptions(args), pivot, iterator); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// secondaryKeys returns the index of the data in each secondary index.
+func (f *Frame) secondaryKeys(data row.Data) (map[string]row.Index, error) {
+	if len(f.secondary) == 0 {
+		return nil, nil
+	}
+	keys := make(map[string]row.Index, len(f.secondary))
+	for name, s := range f.secondary {
+		index, err := s.indexer.Index(data)
+		if err != nil {
+			return nil, fmt.Errorf("index %q: %v", name, err)
+		}
+		keys[name] = index
+	}
+	return keys, nil
+}
+
+// unindex removes the row from each secondary index and group view.
+func (f *Frame) unindex(r row.Row) {
+	for _, v := range f.views {
+		v.remove(r.Data)
+	}
+	for _, s := range f.secondary {
+		s.remove(r.Index)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+func TestGetBy(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("id"))
+	f.Put(row.Of("id", 1, "user", "a"))
+	f.Put(row.Of("id", 2, "user", "b"))
+	if err := f.AddIndex("user", row.NewColumnIndexer("user")); err != nil {
+		t.Fatalf("AddIndex: %v", err)
+	}
+	f.Put(row.Of("id", 3, "user", "a"))
+
+	got, err := f.GetBy("user", row.Of("user", "a"))
+	if err != nil {
+		t.Fatalf("GetBy: %v", err)
+	}
+	if len(got) != 2 || got[0]["id"] != 1 || got[1]["id"] != 3 {
+		t.Errorf("GetBy = %v; want ids 1 and 3", got)
+	}
+
+	// Replacing a row moves it within the secondary index.
+	f.Put(row.Of("id", 1, "user", "b"))
+	if got, _ := f.GetBy("user", row.Of("user", "a")); len(got) != 1 || got[0]["id"] != 3 {
+		t.Errorf("GetBy after Put = %v; want id 3", got)
+	}
+
+	f.Pop(row.Of("id", 3))
+	if got, _ := f.GetBy("user", row.Of("user", "a")); got != nil {
+		t.Errorf("GetBy after Pop = %v; want nil", got)
+	}
+
+	f.PopRange(GreaterOrEqual(row.Of("id", 2)))
+	if got, _ := f.GetBy("user", row.Of("user", "b")); len(got) != 1 || got[0]["id"] != 1 {
+		t.Errorf("GetBy after PopRange = %v; want id 1", got)
+	}
+}
+
+func TestGetByMutatedRow(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("id"))
+	if err := f.AddIndex("user", row.NewColumnIndexer("user")); err != nil {
+		t.Fatalf("AddIndex: %v", err)
+	}
+	data := row.Of("id", 1, "user", "a")
+	f.Put(data)
+
+	// The row is removed from the secondary index under the key it was added
+	// with, even though its data has since changed.
+	data["user"] = "b"
+	f.Pop(row.Of("id", 1))
+	for _, user := range []string{"a", "b"} {
+		if got, _ := f.GetBy("user", row.Of("user", user)); got != nil {
+			t.Errorf("GetBy(%q) after Pop = %v; want nil", user, got)
+		}
+	}
+}
+
+func TestGetRangeBy(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("id"))
+	if err := f.AddIndex("score", row.NewColumnIndexer("score")); err != nil {
+		t.Fatalf("AddIndex: %v", err)
+	}
+	f.Put(row.Of("id", 1, "score", 30))
+	f.Put(row.Of("id", 2, "score", 10))
+	f.Put(row.Of("id", 3, "score", 20))
+	f.Put(row.Of("id", 4, "score", 20))
+
+	got, err := f.GetRangeBy("score", GreaterOrEqual(row.Of("score", 20)), LessThan(row.Of("score", 30)))
+	if err != nil {
+		t.Fatalf("GetRangeBy: %v", err)
+	}
+	if len(got) != 2 || got[0]["id"] != 3 || got[1]["id"] != 4 {
+		t.Errorf("GetRangeBy = %v; want ids 3 and 4", got)
+	}
+
+	if _, err := f.GetRangeBy("missing"); err == nil {
+		t.Errorf("GetRangeBy(%q) succeeded; want error", "missing")
+	}
+}
+
+func TestAddIndexFails(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("id"))
+	f.Put(row.Of("id", 1))
+	if err := f.AddIndex("user", row.NewColumnIndexer("user")); err == nil {
+		t.Fatalf("AddIndex succeeded for row without column; want error")
+	}
+	if _, err := f.Put(row.Of("id", 2)); err != nil {
+		t.Errorf("Put after failed AddIndex: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import "sync/atomic"
+
+// Clone returns an independent copy of the Frame, including its secondary
+// indexes but not its group views. Clone takes constant time: the btrees are
+// shared and copied lazily as either Frame is modified. Rows are shared too,
+// but while both Frames are in use, each copies the rows given to Put and the
+// rows it shares with the other as they are returned, passed to callbacks or
+// added to derived Frames, such as by Filter or GroupBy, so that a row
+// obtained from one Frame may be changed without changing the other. Rows put
+// after the clone belong to the Frame they are put into and are not copied
+// again, and no rows are copied once the other Frames are released (see
+// Release). Rows given to Put and rows obtained before the clone, including
+// the rows of Frames derived before it, are still shared with the caller.
+//
+// Clone must not be called concurrently with other calls on the Frame. Once it
+// returns, the Frame and its clone may be used concurrently.
+func (f *Frame) Clone() *Frame {
+	if !f.shared() {
+		f.share = &share{frames: 1}
+	}
+	atomic.AddInt32(&f.share.frames, 1)
+	f.owned = nil
+	nf := *f
+	nf.bt = f.bt.Clone()
+	nf.readOnly = false
+	nf.views = nil
+	if f.secondary != nil {
+		nf.secondary = make(map[string]*secondaryIndex, len(f.secondary))
+		for name, s := range f.secondary {
+			nf.secondary[name] = &secondaryIndex{
+				bt:      s.bt.Clone(),
+				keys:    s.keys.Clone(),
+				indexer: s.indexer,
+			}
+		}
+	}
+	return &nf
+}
+
+// Release records that a Frame made or cloned by Clone is no longer used, so
+// that the Frames it shares rows with stop copying them once no other clone
+// holds them. The Frame must not be used after Release. Release is optional:
+// a Frame that is never released only keeps the other Frames copying rows.
+func (f *Frame) Release() {
+	if f.share != nil {
+		atomic.AddInt32(&f.share.frames, -1)
+		f.share = nil
+	}
+}
+
+// Snapshot returns a read-only, point-in-time view of the Frame. See Clone for
+// the cost and concurrency guarantees. Modifying the snapshot fails with
+// ErrReadOnly, although secondary indexes may still be added to it.
+func (f *Frame) Snapshot() *Frame {
+	nf := f.Clone()
+	nf.readOnly = true
+	return nf
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"testing"
+
+	"github.com/google/godata/group"
+	"github.com/google/godata/row"
+)
+
+func TestClone(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	if err := f.AddIndex("data", row.NewColumnIndexer("data")); err != nil {
+		t.Fatalf("AddIndex: %v", err)
+	}
+	f.Put(row.Of("i", 1, "data", "foo"))
+	f.Put(row.Of("i", 2, "data", "bar"))
+
+	c := f.Clone()
+	f.Put(row.Of("i", 1, "data", "baz"))
+	c.Pop(row.Of("i", 2))
+
+	if got, _ := c.Get(row.Of("i", 1)); got["data"] != "foo" {
+		t.Errorf("clone Get = %v; want data foo", got)
+	}
+	if got, _ := f.Get(row.Of("i", 2)); got == nil {
+		t.Errorf("Get = nil; want row popped from the clone only")
+	}
+	if got, _ := c.GetBy("data", row.Of("data", "baz")); got != nil {
+		t.Errorf("clone GetBy = %v; want nil", got)
+	}
+	if got, _ := f.GetBy("data", row.Of("data", "bar")); len(got) != 1 {
+		t.Errorf("GetBy = %v; want 1 row", got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 1, "data", "foo"))
+
+	s := f.Snapshot()
+	if _, err := s.Put(row.Of("i", 2)); err != ErrReadOnly {
+		t.Errorf("Put = %v; want ErrReadOnly", err)
+	}
+	if _, err := s.PopRange(); err != ErrReadOnly {
+		t.Errorf("PopRange = %v; want ErrReadOnly", err)
+	}
+
+	got, _ := f.Get(row.Of("i", 1))
+	updated := got.Copy()
+	updated["data"] = "bar"
+	f.Update(updated)
+	f.Put(row.Of("i", 2))
+
+	rows, err := s.GetRange()
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["data"] != "foo" {
+		t.Errorf("snapshot GetRange = %v; want the original row only", rows)
+	}
+	if c := s.Clone(); c.Insert(row.Of("i", 3)) != nil {
+		t.Errorf("Insert into clone of snapshot failed")
+	}
+}
+
+func TestCloneIsolatesRows(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 1, "data", "foo"))
+	s := f.Snapshot()
+
+	// Rows obtained from either Frame may be mutated without changing the
+	// other Frame.
+	got, _ := f.Get(row.Of("i", 1))
+	got["data"] = "baz"
+	rows, _ := f.GetRange()
+	rows[0]["data"] = "baz"
+	if got, _ := s.Get(row.Of("i", 1)); got["data"] != "foo" {
+		t.Errorf("snapshot Get = %v; want data foo", got)
+	}
+
+	got, _ = s.Get(row.Of("i", 1))
+	got["data"] = "qux"
+	if got, _ := f.Get(row.Of("i", 1)); got["data"] != "foo" {
+		t.Errorf("Get = %v; want data foo", got)
+	}
+
+	// Rows put after the clone are copied too.
+	data := row.Of("i", 2, "data", "foo")
+	f.Put(data)
+	c := f.Clone()
+	data["data"] = "bar"
+	if got, _ := c.Get(row.Of("i", 2)); got["data"] != "foo" {
+		t.Errorf("clone Get = %v; want data foo", got)
+	}
+}
+
+func TestSnapshotIsolatesDerivedRows(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 1, "k", "a", "data", "foo"))
+	f.Put(row.Of("i", 2, "k", "b", "data", "foo"))
+	s := f.Snapshot()
+
+	groups, err := f.GroupBy(row.NewColumnIndexer("k"))
+	if err != nil {
+		t.Fatalf("GroupBy: %v", err)
+	}
+	g, _ := groups.Get(row.Of("k", "a"))
+	g[group.Column].(group.Group)[0]["data"] = "group"
+
+	filtered, err := f.Filter(func(data row.Data) (bool, error) {
+		data["data"] = "predicate"
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+	rows, _ := filtered.GetRange()
+	rows[1]["data"] = "filter"
+
+	err = f.MergeJoin(s, InnerJoin, func(left, right row.Data) error {
+		left["data"] = "left"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("MergeJoin: %v", err)
+	}
+
+	rows, _ = s.GetRange()
+	for _, data := range rows {
+		if data["data"] != "foo" {
+			t.Errorf("snapshot row = %v; want data foo", data)
+		}
+	}
+}
+
+func TestCloneOwnsRowsPutAfterIt(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 1))
+	s := f.Snapshot()
+	f.Put(row.Of("i", 2))
+
+	// Rows held by the snapshot are copied, and rows put since are not.
+	a, _ := f.Get(row.Of("i", 1))
+	b, _ := f.Get(row.Of("i", 1))
+	if rowID(a) == rowID(b) {
+		t.Errorf("Get returned the row shared with the snapshot")
+	}
+	a, _ = f.Get(row.Of("i", 2))
+	b, _ = f.Get(row.Of("i", 2))
+	if rowID(a) != rowID(b) {
+		t.Errorf("Get copied a row put after the snapshot")
+	}
+	if s.Len() != 1 {
+		t.Errorf("snapshot Len = %d; want 1", s.Len())
+	}
+}
+
+func TestRelease(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 1))
+	f.Clone().Release()
+
+	a, _ := f.Get(row.Of("i", 1))
+	b, _ := f.Get(row.Of("i", 1))
+	if rowID(a) != rowID(b) {
+		t.Errorf("Get copied a row after the clone was released")
+	}
+}
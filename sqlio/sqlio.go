@@ -0,0 +1,419 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sqlio loads the results of SQL queries into Frames, and writes
+// Frames to SQL tables, using database/sql.
+//
+// Query results are converted using the driver types: integers are read as int
+// (see row.NewIndex), byte slices are read as string for columns of textual
+// database types, and NULL values are left out of the row. Other values are
+// read as returned by the driver.
+package sqlio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/google/godata"
+	"github.com/google/godata/internal/value"
+	"github.com/google/godata/row"
+)
+
+// DefaultBatchSize is the default number of rows written by each statement.
+const DefaultBatchSize = 100
+
+// Options configures reading and writing Frames. A nil *Options uses the
+// defaults.
+type Options struct {
+	// AllowDuplicates creates the Frame read with the godata.AllowDuplicates
+	// option.
+	AllowDuplicates bool
+
+	// Dialect is the SQL dialect of the statements written. Nil means SQLite.
+	Dialect Dialect
+
+	// BatchSize is the maximum number of rows written by each statement. Zero
+	// means DefaultBatchSize. Batches are made smaller if needed to respect
+	// the argument limit of the Dialect.
+	BatchSize int
+
+	// Columns are the columns written. If nil, then every column of the Frame
+	// is written.
+	Columns []string
+
+	// Key are the columns of the unique key of the table, on which rows are
+	// upserted. If nil, then the columns of a ColumnIndexer are used. If the
+	// Frame has another indexer, then rows are inserted.
+	Key []string
+}
+
+func (o *Options) dialect() Dialect {
+	if o == nil || o.Dialect == nil {
+		return SQLite
+	}
+	return o.Dialect
+}
+
+func (o *Options) batchSize() int {
+	if o == nil || o.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return o.BatchSize
+}
+
+// Querier is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Execer is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Query runs the query and returns its results as a Frame with the given
+// indexer. See Read.
+func Query(ctx context.Context, q Querier, indexer row.Indexer, opts *Options, query string, args ...interface{}) (*godata.Frame, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return Read(rows, indexer, opts)
+}
+
+// Read returns a Frame with the given indexer containing the remaining rows,
+// and closes the rows. Columns are named by the column names of the result.
+// Returns a godata.ErrRows if any row cannot be indexed, together with a Frame
+// containing the other rows.
+func Read(rows *sql.Rows, indexer row.Indexer, opts *Options) (*godata.Frame, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	text := make([]bool, len(types))
+	for i, t := range types {
+		text[i] = isText(t.DatabaseTypeName())
+	}
+
+	var b *godata.Builder
+	if opts != nil && opts.AllowDuplicates {
+		b = godata.NewBuilder(indexer, godata.AllowDuplicates())
+	} else {
+		b = godata.NewBuilder(indexer)
+	}
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		data := make(row.Data, len(columns))
+		for i, v := range values {
+			if v != nil {
+				data[columns[i]] = convert(v, text[i])
+			}
+		}
+		b.Add(data)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return b.Frame()
+}
+
+// isText returns true if values of the database type are text.
+func isText(typ string) bool {
+	typ = strings.ToUpper(typ)
+	for _, t := range []string{"CHAR", "TEXT", "CLOB", "STRING", "JSON", "UUID", "ENUM"} {
+		if strings.Contains(typ, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// convert converts a value returned by the driver. Byte slices returned for
+// text columns are converted to string.
+func convert(v interface{}, text bool) interface{} {
+	switch v := v.(type) {
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int(v)
+		}
+	case []byte:
+		if text {
+			return string(v)
+		}
+	}
+	return v
+}
+
+// Dialect generates the SQL statements of a database.
+type Dialect interface {
+	// Quote returns the quoted identifier.
+	Quote(name string) string
+
+	// Placeholder returns the placeholder of the nth argument of a statement,
+	// counting from 1.
+	Placeholder(n int) string
+
+	// Upsert returns the clause that follows the VALUES of an INSERT statement
+	// to update rows with the same key. The columns contain all columns,
+	// including the key columns.
+	Upsert(key, columns []string) string
+
+	// MaxArgs returns the maximum number of arguments of a statement.
+	MaxArgs() int
+}
+
+var (
+	// SQLite is the Dialect of SQLite 3.24 and later.
+	SQLite Dialect = sqlite{}
+
+	// Postgres is the Dialect of PostgreSQL 9.5 and later.
+	Postgres Dialect = postgres{}
+
+	// MySQL is the Dialect of MySQL and MariaDB.
+	MySQL Dialect = mysql{}
+)
+
+// quote quotes the identifier with the quote character, doubling any quote
+// characters in it.
+func quote(name string, q string) string {
+	return q + strings.ReplaceAll(name, q, q+q) + q
+}
+
+// quoteTable quotes each dot-separated part of the table name, which may be
+// qualified by a schema.
+func quoteTable(d Dialect, table string) string {
+	parts := strings.Split(table, ".")
+	for i, p := range parts {
+		parts[i] = d.Quote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// onConflict returns the ON CONFLICT clause of SQLite and PostgreSQL.
+func onConflict(d Dialect, key, columns []string) string {
+	quoted := make([]string, len(key))
+	isKey := make(map[string]bool)
+	for i, k := range key {
+		quoted[i] = d.Quote(k)
+		isKey[k] = true
+	}
+	var set []string
+	for _, c := range columns {
+		if !isKey[c] {
+			set = append(set, fmt.Sprintf("%s = excluded.%s", d.Quote(c), d.Quote(c)))
+		}
+	}
+	clause := fmt.Sprintf("ON CONFLICT (%s) DO ", strings.Join(quoted, ", "))
+	if set == nil {
+		return clause + "NOTHING"
+	}
+	return clause + "UPDATE SET " + strings.Join(set, ", ")
+}
+
+type sqlite struct{}
+
+func (sqlite) Quote(name string) string              { return quote(name, `"`) }
+func (sqlite) Placeholder(int) string                { return "?" }
+func (d sqlite) Upsert(key, columns []string) string { return onConflict(d, key, columns) }
+func (sqlite) MaxArgs() int                          { return 999 }
+
+type postgres struct{}
+
+func (postgres) Quote(name string) string              { return quote(name, `"`) }
+func (postgres) Placeholder(n int) string              { return fmt.Sprintf("$%d", n) }
+func (d postgres) Upsert(key, columns []string) string { return onConflict(d, key, columns) }
+func (postgres) MaxArgs() int                          { return 65535 }
+
+type mysql struct{}
+
+func (mysql) Quote(name string) string { return quote(name, "`") }
+func (mysql) Placeholder(int) string   { return "?" }
+func (mysql) MaxArgs() int             { return 65535 }
+
+// Upsert returns an ON DUPLICATE KEY UPDATE clause. MySQL determines the
+// conflicting rows from every unique key of the table, so the key is only used
+// when every column is a key column.
+func (d mysql) Upsert(key, columns []string) string {
+	isKey := make(map[string]bool)
+	for _, k := range key {
+		isKey[k] = true
+	}
+	var set []string
+	for _, c := range columns {
+		if !isKey[c] {
+			set = append(set, fmt.Sprintf("%s = VALUES(%s)", d.Quote(c), d.Quote(c)))
+		}
+	}
+	if set == nil {
+		set = []string{fmt.Sprintf("%s = %s", d.Quote(key[0]), d.Quote(key[0]))}
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+}
+
+// Write upserts the rows of the Frame into the table in index order, using
+// multi-row INSERT statements of at most Options.BatchSize rows. The table may
+// be qualified by a schema, as in "schema.table". Columns that are missing from
+// a row are written as NULL. Rows with the same key are written once per
+// statement, with the values of the last of them, since PostgreSQL cannot
+// update a row twice in one statement. Write is not atomic; pass a *sql.Tx to
+// write the Frame in a transaction.
+func Write(ctx context.Context, db Execer, table string, f *godata.Frame, opts *Options) error {
+	var columns, key []string
+	if opts != nil {
+		columns, key = opts.Columns, opts.Key
+	}
+	if key == nil {
+		key = row.IndexColumns(f.Indexer())
+	}
+	if columns == nil {
+		columns = frameColumns(f, key)
+	}
+	if len(columns) == 0 {
+		if f.Len() == 0 {
+			return nil
+		}
+		return errors.New("Write: no columns")
+	}
+
+	d := opts.dialect()
+	size := opts.batchSize()
+	if limit := d.MaxArgs() / len(columns); size > limit {
+		size = limit
+	}
+	if size == 0 {
+		return fmt.Errorf("Write: %d columns exceed the argument limit", len(columns))
+	}
+
+	var (
+		batch = 0
+		args  = make([]interface{}, 0, size*len(columns))
+
+		// keys contains the position in the batch of each key.
+		keys = make(map[string]int)
+	)
+	flush := func() error {
+		if batch == 0 {
+			return nil
+		}
+		_, err := db.ExecContext(ctx, insert(d, table, columns, key, batch), args...)
+		batch, args = 0, args[:0]
+		keys = make(map[string]int)
+		return err
+	}
+	err := f.ForEach(func(data row.Data) error {
+		if len(key) > 0 {
+			vals := make([]interface{}, len(key))
+			for i, c := range key {
+				vals[i] = data[c]
+			}
+			k := value.Key(vals)
+			if i, ok := keys[k]; ok {
+				for j, c := range columns {
+					args[i*len(columns)+j] = data[c]
+				}
+				return nil
+			}
+			keys[k] = batch
+		}
+		for _, c := range columns {
+			args = append(args, data[c])
+		}
+		if batch++; batch == size {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return fmt.Errorf("Write: %v", err)
+	}
+	return nil
+}
+
+// frameColumns returns the columns of the Frame, with the key columns first
+// followed by the other columns in name order.
+func frameColumns(f *godata.Frame, key []string) []string {
+	seen := make(map[string]bool)
+	for _, k := range key {
+		seen[k] = true
+	}
+	var other []string
+	f.ForEach(func(data row.Data) error {
+		for c := range data {
+			if !seen[c] {
+				seen[c] = true
+				other = append(other, c)
+			}
+		}
+		return nil
+	})
+	sort.Strings(other)
+	return append(append([]string(nil), key...), other...)
+}
+
+// insert returns an INSERT statement for the given number of rows, which
+// upserts the rows if a key is given.
+func insert(d Dialect, table string, columns, key []string, rows int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (", quoteTable(d, table))
+	for i, c := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(d.Quote(c))
+	}
+	b.WriteString(") VALUES ")
+	n := 0
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j := range columns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			n++
+			b.WriteString(d.Placeholder(n))
+		}
+		b.WriteByte(')')
+	}
+	if len(key) > 0 {
+		b.WriteByte(' ')
+		b.WriteString(d.Upsert(key, columns))
+	}
+	return b.String()
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlio
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+)
+
+func TestInsert(t *testing.T) {
+	for _, c := range []struct {
+		dialect Dialect
+		key     []string
+		want    string
+	}{
+		{
+			SQLite, []string{"id"},
+			`INSERT INTO "t" ("id", "a") VALUES (?, ?), (?, ?) ON CONFLICT ("id") DO UPDATE SET "a" = excluded."a"`,
+		},
+		{
+			Postgres, []string{"id"},
+			`INSERT INTO "t" ("id", "a") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "a" = excluded."a"`,
+		},
+		{
+			MySQL, []string{"id"},
+			"INSERT INTO `t` (`id`, `a`) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE `a` = VALUES(`a`)",
+		},
+		{
+			Postgres, []string{"id", "a"},
+			`INSERT INTO "t" ("id", "a") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id", "a") DO NOTHING`,
+		},
+		{
+			SQLite, nil,
+			`INSERT INTO "t" ("id", "a") VALUES (?, ?), (?, ?)`,
+		},
+	} {
+		if got := insert(c.dialect, "t", []string{"id", "a"}, c.key, 2); got != c.want {
+			t.Errorf("insert = %s; want %s", got, c.want)
+		}
+	}
+}
+
+// recorder is an Execer that records the statements executed.
+type recorder struct {
+	queries []string
+	args    [][]interface{}
+}
+
+func (r *recorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.queries = append(r.queries, query)
+	r.args = append(r.args, args)
+	return nil, nil
+}
+
+func TestWriteDuplicateKeys(t *testing.T) {
+	f := godata.NewFrame(row.NewColumnIndexer("id", "seq"))
+	f.Put(row.Of("id", 1, "seq", 1, "name", "a"))
+	f.Put(row.Of("id", 1, "seq", 2, "name", "b"))
+	f.Put(row.Of("id", 2, "seq", 1, "name", "c"))
+	f.Put(row.Of("id", 2, "seq", 2, "name", "d"))
+
+	var r recorder
+	opts := &Options{Dialect: Postgres, Key: []string{"id"}, Columns: []string{"id", "name"}, BatchSize: 3}
+	if err := Write(context.Background(), &r, "s.t", f, opts); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	want := []interface{}{1, "b", 2, "d"}
+	if len(r.args) != 1 || !reflect.DeepEqual(r.args[0], want) {
+		t.Errorf("Write args = %v; want %v", r.args, want)
+	}
+	if wantQuery := `INSERT INTO "s"."t" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name"`; len(r.queries) != 1 || r.queries[0] != wantQuery {
+		t.Errorf("Write queries = %q; want %q", r.queries, wantQuery)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlio
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+
+	_ "modernc.org/sqlite"
+)
+
+// openDB returns an in-memory SQLite database containing a users table.
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	// Each connection has its own in-memory database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`CREATE TABLE users (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		score REAL,
+		avatar BLOB
+	)`)
+	if err != nil {
+		t.Fatalf("CREATE TABLE: %v", err)
+	}
+	return db
+}
+
+func TestQuery(t *testing.T) {
+	db := openDB(t)
+	_, err := db.Exec(`INSERT INTO users VALUES
+		(2, 'bob', NULL, x'0102'),
+		(1, 'alice', 1.5, NULL)`)
+	if err != nil {
+		t.Fatalf("INSERT: %v", err)
+	}
+
+	ctx := context.Background()
+	f, err := Query(ctx, db, row.NewColumnIndexer("id"), nil, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	got, _ := f.GetRange()
+	want := []row.Data{
+		row.Of("id", 1, "name", "alice", "score", 1.5),
+		row.Of("id", 2, "name", "bob", "avatar", []byte{1, 2}),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRange = %v; want %v", got, want)
+	}
+
+	f, err = Query(ctx, db, row.NewColumnIndexer("n"), &Options{AllowDuplicates: true}, "SELECT 1 AS n FROM users")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if rows, _ := f.GetAll(row.Of("n", 1)); len(rows) != 2 {
+		t.Errorf("GetAll = %v; want 2 rows", rows)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	f := godata.NewFrame(row.NewColumnIndexer("id"))
+	for i := 0; i < 250; i++ {
+		f.Put(row.Of("id", i, "name", "before"))
+	}
+	if err := Write(ctx, db, "users", f, nil); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	f.Put(row.Of("id", 1, "name", "after", "score", 2.5))
+	f.Put(row.Of("id", 1000, "name", "new"))
+	if err := Write(ctx, db, "users", f, &Options{BatchSize: 7}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 251 {
+		t.Errorf("COUNT(*) = %d, %v; want 251", count, err)
+	}
+	nf, err := Query(ctx, db, row.NewColumnIndexer("id"), nil, "SELECT id, name, score FROM users WHERE id = 1")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got, _ := nf.Get(row.Of("id", 1)); !reflect.DeepEqual(got, row.Of("id", 1, "name", "after", "score", 2.5)) {
+		t.Errorf("Get = %v; want upserted row", got)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// ErrCorrupt is returned when a checkpoint or log record fails its checksum.
+var ErrCorrupt = errors.New("store: corrupt record")
+
+const (
+	// headerSize is the size of the length and checksum preceding each record.
+	headerSize = 8
+
+	// maxRecordSize bounds the size of a record, so that a corrupt length does
+	// not cause a huge allocation.
+	maxRecordSize = 1 << 30
+)
+
+// crcTable is the CRC-32 polynomial used to checksum records.
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// writeRecord writes the gob encoding of v as a single record, preceded by its
+// length and checksum. Each record is encoded independently, so that a record
+// can be decoded without reading the records before it.
+func writeRecord(w io.Writer, v interface{}) error {
+	b, err := encodeRecord(v)
+	if err != nil {
+		return err
+	}
+
+	// A single write ensures that a crash can only tear the last record.
+	_, err = w.Write(b)
+	return err
+}
+
+// encodeRecord returns the record written by writeRecord for v.
+func encodeRecord(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, headerSize))
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(b)-headerSize))
+	binary.LittleEndian.PutUint32(b[4:8], crc32.Checksum(b[headerSize:], crcTable))
+	return b, nil
+}
+
+// readRecord reads a record written by writeRecord into v, and returns the
+// size of the record. Returns io.EOF if there are no more records,
+// io.ErrUnexpectedEOF if the last record is incomplete, and ErrCorrupt if the
+// record does not match its checksum, in which case the size of the record is
+// still returned.
+func readRecord(r *bufio.Reader, v interface{}) (int64, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return int64(headerSize) + int64(size), ErrCorrupt
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return int64(headerSize + len(payload)), ErrCorrupt
+	}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(v); err != nil {
+		return 0, err
+	}
+	return int64(headerSize + len(payload)), nil
+}
@@ -0,0 +1,600 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package store persists a Frame on disk. Changes are appended to a
+// write-ahead log before they are applied, and the log is periodically
+// replaced by a checkpoint of the whole Frame. Open recovers the Frame,
+// including its indexer configuration, from the last checkpoint and the log.
+//
+// Indexers and the values stored in rows are encoded with encoding/gob, so their
+// concrete types must be registered with gob.Register. The indexers and column
+// types defined by godata are already registered.
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/godata"
+	"github.com/google/godata/row"
+)
+
+const (
+	// checkpointFile and logFile are the names of the files in a Store
+	// directory.
+	checkpointFile = "checkpoint"
+	logFile        = "log"
+
+	// version is the version of the checkpoint format.
+	version = 1
+
+	// checkpointBatch is the number of rows in each checkpoint record.
+	checkpointBatch = 1024
+)
+
+// SyncPolicy determines when the log is synced to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs the log before each change is acknowledged.
+	SyncAlways SyncPolicy = iota
+
+	// SyncInterval syncs the log when a change is made at least
+	// Options.SyncInterval after the last sync, and on Close. Changes made since
+	// the last sync may be lost if the machine crashes.
+	SyncInterval
+
+	// SyncNever leaves syncing the log to the operating system.
+	SyncNever
+)
+
+// Options configures a Store.
+type Options struct {
+	// Sync determines when the log is synced to disk.
+	Sync SyncPolicy
+
+	// SyncInterval is the minimum time between syncs for SyncInterval.
+	SyncInterval time.Duration
+
+	// CheckpointEvery is the number of logged changes after which a checkpoint
+	// is written automatically. Zero disables automatic checkpoints.
+	CheckpointEvery int
+}
+
+// Config describes the Frame kept by a Store. It is persisted in every
+// checkpoint.
+type Config struct {
+	// Indexer indexes the rows of the Frame.
+	Indexer row.Indexer
+
+	// AllowDuplicates configures the Frame with godata.AllowDuplicates.
+	AllowDuplicates bool
+
+	// Degree configures the Frame with godata.Degree, unless it is zero.
+	Degree int
+
+	// Indexes contains the secondary indexes of the Frame by name.
+	Indexes map[string]row.Indexer
+}
+
+// newFrame returns an empty Frame for the Config.
+func (c Config) newFrame() (*godata.Frame, error) {
+	degree := godata.DefaultDegree
+	if c.Degree != 0 {
+		degree = c.Degree
+	}
+	var f *godata.Frame
+	if c.AllowDuplicates {
+		f = godata.NewFrame(c.Indexer, godata.Degree(degree), godata.AllowDuplicates())
+	} else {
+		f = godata.NewFrame(c.Indexer, godata.Degree(degree))
+	}
+	for name, indexer := range c.Indexes {
+		if err := f.AddIndex(name, indexer); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// checkpointHeader is the first record of a checkpoint. It is followed by
+// records containing batches of rows.
+type checkpointHeader struct {
+	// Version is the version of the checkpoint format.
+	Version int
+
+	// LSN is the sequence number of the last change in the checkpoint.
+	LSN uint64
+
+	// Config describes the Frame.
+	Config Config
+}
+
+// op identifies the kind of a logged change.
+type op int
+
+const (
+	opPut op = iota + 1
+	opPop
+	opPopRange
+)
+
+// change is a record of the log.
+type change struct {
+	// LSN is the sequence number of the change.
+	LSN uint64
+
+	// Op is the kind of the change.
+	Op op
+
+	// Data contains the data for opPut, or the key for opPop.
+	Data row.Data
+
+	// GreaterOrEqual and LessThan contain the range for opPopRange.
+	GreaterOrEqual, LessThan row.Data
+}
+
+// Store is a Frame that is persisted on disk. A Store is safe for concurrent
+// use.
+type Store struct {
+	mu sync.Mutex
+
+	dir    string
+	opts   Options
+	config Config
+	frame  *godata.Frame
+	log    *os.File
+
+	// lsn is the sequence number of the last change.
+	lsn uint64
+
+	// changes is the number of changes logged since the last checkpoint.
+	changes int
+
+	// synced is the time of the last sync of the log.
+	synced time.Time
+
+	// err is set once the log cannot be written or synced, after which the
+	// log may end in a partial or unsynced record, or once an automatic
+	// checkpoint fails. All changes fail once err is set. See Err.
+	err error
+}
+
+// Create creates a Store for an empty Frame with the given configuration in
+// the given directory. Returns error if the directory already contains a
+// Store.
+func Create(dir string, config Config, opts Options) (*Store, error) {
+	if config.Indexer == nil {
+		return nil, fmt.Errorf("Create: no indexer")
+	}
+	if _, err := os.Stat(filepath.Join(dir, checkpointFile)); err == nil {
+		return nil, fmt.Errorf("Create: %s already contains a store", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	frame, err := config.newFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:    dir,
+		opts:   opts,
+		config: config,
+		frame:  frame,
+		synced: time.Now(),
+	}
+	if s.log, err = os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		return nil, err
+	}
+	if err := s.checkpoint(); err != nil {
+		s.log.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Open recovers the Store in the given directory. An incomplete record or a
+// record that fails its checksum at the end of the log, as left by a crash
+// during a write, is discarded. Returns ErrCorrupt if any other record fails
+// its checksum.
+func Open(dir string, opts Options) (*Store, error) {
+	s := &Store{
+		dir:    dir,
+		opts:   opts,
+		synced: time.Now(),
+	}
+	if err := s.readCheckpoint(); err != nil {
+		return nil, err
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// readCheckpoint loads the Frame from the checkpoint.
+func (s *Store) readCheckpoint() error {
+	f, err := os.Open(filepath.Join(s.dir, checkpointFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var header checkpointHeader
+	if _, err := readRecord(r, &header); err != nil {
+		return fmt.Errorf("checkpoint: %v", checkpointErr(err))
+	}
+	if header.Version > version {
+		return fmt.Errorf("checkpoint: unsupported version %d", header.Version)
+	}
+	s.config = header.Config
+	s.lsn = header.LSN
+	if s.frame, err = s.config.newFrame(); err != nil {
+		return err
+	}
+
+	for {
+		var batch []row.Data
+		_, err := readRecord(r, &batch)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("checkpoint: %v", checkpointErr(err))
+		}
+		if err := s.frame.PutAll(batch, godata.AllOrNothing()); err != nil {
+			return fmt.Errorf("checkpoint: %v", err)
+		}
+	}
+}
+
+// checkpointErr converts read errors for checkpoints, which are written
+// atomically and so are never legitimately incomplete.
+func checkpointErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupt
+	}
+	return err
+}
+
+// replay applies the changes in the log that are newer than the checkpoint,
+// and opens the log for appending.
+func (s *Store) replay() error {
+	log, err := os.OpenFile(filepath.Join(s.dir, logFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := log.Stat()
+	if err != nil {
+		log.Close()
+		return err
+	}
+	r := bufio.NewReader(log)
+
+	var offset int64
+	for {
+		var c change
+		n, err := readRecord(r, &c)
+		if err == io.EOF {
+			break
+		}
+		// A torn write may leave the last record incomplete, or complete in
+		// length but not in content.
+		if err == io.ErrUnexpectedEOF || (err == ErrCorrupt && offset+n >= info.Size()) {
+			if err := log.Truncate(offset); err != nil {
+				log.Close()
+				return err
+			}
+			break
+		}
+		if err != nil {
+			log.Close()
+			return fmt.Errorf("log: %v", err)
+		}
+		offset += n
+
+		// Changes may already be in the checkpoint if a crash occurred before the
+		// log was truncated.
+		if c.LSN <= s.lsn {
+			continue
+		}
+		if err := s.apply(c); err != nil {
+			log.Close()
+			return fmt.Errorf("log: change %d: %v", c.LSN, err)
+		}
+		s.lsn = c.LSN
+		s.changes++
+	}
+
+	if _, err := log.Seek(offset, io.SeekStart); err != nil {
+		log.Close()
+		return err
+	}
+	s.log = log
+	return nil
+}
+
+// apply applies a logged change to the Frame.
+func (s *Store) apply(c change) error {
+	var err error
+	switch c.Op {
+	default:
+		err = fmt.Errorf("unknown op %d", c.Op)
+	case opPut:
+		_, err = s.frame.Put(c.Data)
+	case opPop:
+		_, err = s.frame.Pop(c.Data)
+	case opPopRange:
+		_, err = s.frame.PopRange(godata.GreaterOrEqual(c.GreaterOrEqual), godata.LessThan(c.LessThan))
+	}
+	return err
+}
+
+// commit applies the change to a clone of the Frame and logs it before
+// replacing the Frame with the clone, so that the Frame never contains a change
+// that is not in the log. The change is not logged if apply fails or returns
+// false, meaning that the change has no effect. The log is synced as
+// configured before the Frame is replaced, and the change is not applied if the
+// sync fails. A checkpoint is written as configured once the change is
+// applied. Its failure does not fail the change, which is already logged, but
+// is recorded in s.err.
+func (s *Store) commit(c change, apply func(f *godata.Frame) (bool, error)) error {
+	c.LSN = s.lsn + 1
+	b, err := encodeRecord(c)
+	if err != nil {
+		return err
+	}
+	next := s.frame.Clone()
+	if ok, err := apply(next); err != nil || !ok {
+		next.Release()
+		return err
+	}
+	if _, err := s.log.Write(b); err != nil {
+		next.Release()
+		s.err = err
+		return err
+	}
+	if s.opts.Sync == SyncAlways || (s.opts.Sync == SyncInterval && time.Since(s.synced) >= s.opts.SyncInterval) {
+		if err := s.sync(); err != nil {
+			next.Release()
+			return err
+		}
+	}
+	s.frame.Release()
+	s.frame = next
+	s.lsn = c.LSN
+	s.changes++
+
+	if s.opts.CheckpointEvery > 0 && s.changes >= s.opts.CheckpointEvery {
+		if err := s.checkpoint(); err != nil {
+			s.err = fmt.Errorf("store: checkpoint: %v", err)
+		}
+	}
+	return nil
+}
+
+// sync syncs the log to disk.
+func (s *Store) sync() error {
+	if err := s.log.Sync(); err != nil {
+		s.err = err
+		return err
+	}
+	s.synced = time.Now()
+	return nil
+}
+
+// Err returns the error that stopped the Store from accepting changes, or nil.
+// The Store stops once the log cannot be written or synced, in which case the
+// change that failed is not applied but may be recovered from the log by Open,
+// or once a checkpoint written automatically by a change fails, in which case
+// the change itself succeeded.
+func (s *Store) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Frame returns a read-only snapshot of the Frame. See godata.Frame.Snapshot.
+func (s *Store) Frame() *godata.Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frame.Snapshot()
+}
+
+// Put logs the change and inserts the data into the Frame. See
+// godata.Frame.Put.
+func (s *Store) Put(data row.Data) (row.Data, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var old row.Data
+	err := s.commit(change{Op: opPut, Data: data}, func(f *godata.Frame) (bool, error) {
+		var err error
+		old, err = f.Put(data)
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// Pop logs the change and deletes the data for the given key from the Frame.
+// See godata.Frame.Pop.
+func (s *Store) Pop(key row.Data) (row.Data, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var got row.Data
+	err := s.commit(change{Op: opPop, Data: key}, func(f *godata.Frame) (bool, error) {
+		var err error
+		got, err = f.Pop(key)
+		return got != nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return got, nil
+}
+
+// PopRange logs the change and deletes the rows in the given range from the
+// Frame. A nil bound leaves that end of the range open. See
+// godata.Frame.PopRange.
+func (s *Store) PopRange(greaterOrEqual, lessThan row.Data) ([]row.Data, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var rows []row.Data
+	c := change{
+		Op:             opPopRange,
+		GreaterOrEqual: greaterOrEqual,
+		LessThan:       lessThan,
+	}
+	err := s.commit(c, func(f *godata.Frame) (bool, error) {
+		var err error
+		rows, err = f.PopRange(godata.GreaterOrEqual(greaterOrEqual), godata.LessThan(lessThan))
+		return len(rows) > 0, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// AddIndex adds a secondary index to the Frame and writes a checkpoint
+// recording it. See godata.Frame.AddIndex.
+func (s *Store) AddIndex(name string, indexer row.Indexer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+
+	if err := s.frame.AddIndex(name, indexer); err != nil {
+		return err
+	}
+	indexes := map[string]row.Indexer{name: indexer}
+	for n, i := range s.config.Indexes {
+		indexes[n] = i
+	}
+	s.config.Indexes = indexes
+	return s.checkpoint()
+}
+
+// Checkpoint writes the whole Frame to disk and truncates the log.
+func (s *Store) Checkpoint() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.checkpoint()
+}
+
+// checkpoint writes the checkpoint to a temporary file and then renames it, so
+// that a crash leaves either the old or the new checkpoint in place.
+func (s *Store) checkpoint() error {
+	path := filepath.Join(s.dir, checkpointFile)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rows, err := s.frame.GetRange()
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	header := checkpointHeader{
+		Version: version,
+		LSN:     s.lsn,
+		Config:  s.config,
+	}
+	if err := writeRecord(w, header); err != nil {
+		return err
+	}
+	for i := 0; i < len(rows); i += checkpointBatch {
+		end := i + checkpointBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := writeRecord(w, rows[i:end]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+
+	// Changes up to the checkpoint LSN are skipped on replay, so a crash before
+	// the log is truncated is harmless.
+	if err := s.log.Truncate(0); err != nil {
+		s.err = err
+		return err
+	}
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		s.err = err
+		return err
+	}
+	s.changes = 0
+	return s.sync()
+}
+
+// syncDir syncs the directory, which persists renames within it.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Close syncs and closes the log. The Store must not be used afterwards.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.log.Sync()
+	if cerr := s.log.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Create(dir, Config{Indexer: row.NewColumnIndexer("i")}, Options{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := s.Put(row.Of("i", i, "data", "foo")); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if err := s.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if err := s.AddIndex("data", row.NewColumnIndexer("data")); err != nil {
+		t.Fatalf("AddIndex: %v", err)
+	}
+	s.Put(row.Of("i", 1, "data", "bar"))
+	s.Pop(row.Of("i", 2))
+	s.PopRange(row.Of("i", 4), nil)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	rows, err := s.Frame().GetRange()
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	var got []interface{}
+	for _, r := range rows {
+		got = append(got, r["i"], r["data"])
+	}
+	want := []interface{}{0, "foo", 1, "bar", 3, "foo"}
+	if len(got) != len(want) {
+		t.Fatalf("recovered rows = %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("recovered rows = %v; want %v", got, want)
+		}
+	}
+	if bar, err := s.Frame().GetBy("data", row.Of("data", "bar")); err != nil || len(bar) != 1 {
+		t.Errorf("GetBy = %v, %v; want recovered secondary index", bar, err)
+	}
+}
+
+func TestRecoverAllowDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{
+		Indexer:         row.NewColumnIndexer("user"),
+		AllowDuplicates: true,
+	}
+	s, err := Create(dir, config, Options{Sync: SyncNever, CheckpointEvery: 2})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for _, event := range []string{"a", "b", "c"} {
+		s.Put(row.Of("user", 1, "event", event))
+	}
+	s.Close()
+
+	s, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	rows, _ := s.Frame().GetAll(row.Of("user", 1))
+	if len(rows) != 3 || rows[0]["event"] != "a" || rows[2]["event"] != "c" {
+		t.Errorf("GetAll = %v; want events a, b, c", rows)
+	}
+}
+
+func TestTornLog(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Create(dir, Config{Indexer: row.NewColumnIndexer("i")}, Options{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	s.Put(row.Of("i", 1))
+	s.Put(row.Of("i", 2))
+	s.Close()
+
+	// Simulate a crash in the middle of writing the last record.
+	path := filepath.Join(dir, logFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+
+	s, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if rows, _ := s.Frame().GetRange(); len(rows) != 1 {
+		t.Errorf("GetRange = %v; want only the complete change", rows)
+	}
+	s.Put(row.Of("i", 3))
+	s.Close()
+
+	s, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	if rows, _ := s.Frame().GetRange(); len(rows) != 2 {
+		t.Errorf("GetRange = %v; want changes before and after the torn record", rows)
+	}
+}
+
+func TestTornChecksum(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Create(dir, Config{Indexer: row.NewColumnIndexer("i")}, Options{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	s.Put(row.Of("i", 1))
+	s.Put(row.Of("i", 2))
+	s.Close()
+
+	// Simulate a crash that wrote the length of the last record but not all
+	// of its content.
+	path := filepath.Join(dir, logFile)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	b[len(b)-1] ^= 0xff
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	s, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	if rows, _ := s.Frame().GetRange(); len(rows) != 1 {
+		t.Errorf("GetRange = %v; want only the intact change", rows)
+	}
+}
+
+func TestCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Create(dir, Config{Indexer: row.NewColumnIndexer("i")}, Options{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	s.Put(row.Of("i", 1))
+	s.Put(row.Of("i", 2))
+	s.Close()
+
+	path := filepath.Join(dir, logFile)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	b[headerSize] ^= 0xff
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := Open(dir, Options{}); err == nil {
+		t.Errorf("Open succeeded for corrupt record before the end of the log; want error")
+	}
+}
+
+func TestPutUnencodable(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Create(dir, Config{Indexer: row.NewColumnIndexer("i")}, Options{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer s.Close()
+
+	// The change cannot be logged, so it must not be applied.
+	if _, err := s.Put(row.Of("i", 1, "data", make(chan int))); err == nil {
+		t.Fatalf("Put succeeded for unencodable data; want error")
+	}
+	if got, _ := s.Frame().Get(row.Of("i", 1)); got != nil {
+		t.Errorf("Get = %v; want nil for change that was not logged", got)
+	}
+	if _, err := s.Put(row.Of("i", 2)); err != nil {
+		t.Errorf("Put after failed Put: %v", err)
+	}
+}
+
+func TestCheckpointFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Create(dir, Config{Indexer: row.NewColumnIndexer("i")}, Options{CheckpointEvery: 1})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// The temporary checkpoint cannot be created over a directory.
+	if err := os.Mkdir(filepath.Join(dir, checkpointFile+".tmp"), 0755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if _, err := s.Put(row.Of("i", 1)); err != nil {
+		t.Fatalf("Put = %v; want the logged change to succeed", err)
+	}
+	if s.Err() == nil {
+		t.Errorf("Err = nil; want the checkpoint error")
+	}
+	if got, _ := s.Frame().Get(row.Of("i", 1)); got == nil {
+		t.Errorf("Get = nil; want the logged change")
+	}
+	if _, err := s.Put(row.Of("i", 2)); err == nil {
+		t.Errorf("Put after failed checkpoint succeeded; want error")
+	}
+	s.Close()
+
+	s, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	if got, _ := s.Frame().Get(row.Of("i", 1)); got == nil {
+		t.Errorf("recovered Get = nil; want the logged change")
+	}
+}
+
+func TestCorruptCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Create(dir, Config{Indexer: row.NewColumnIndexer("i")}, Options{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	s.Put(row.Of("i", 1, "data", "foo"))
+	s.Checkpoint()
+	s.Close()
+
+	path := filepath.Join(dir, checkpointFile)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	b[len(b)-1] ^= 0xff
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := Open(dir, Options{}); err == nil {
+		t.Errorf("Open succeeded for corrupt checkpoint; want error")
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Create(dir, Config{Indexer: row.NewColumnIndexer("i")}, Options{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	s.Close()
+	if _, err := Create(dir, Config{Indexer: row.NewColumnIndexer("i")}, Options{}); err == nil {
+		t.Errorf("Create succeeded over an existing store; want error")
+	}
+}
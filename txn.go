@@ -0,0 +1,213 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import "github.com/google/godata/row"
+
+// Txn is a set of changes to a Frame that is applied atomically. A Txn reads
+// its own writes, and is isolated from changes made to the Frame after Begin.
+// Conflicts are detected optimistically: Commit fails if any key or range that
+// the Txn read or wrote was changed in the Frame since Begin.
+type Txn struct {
+	// frame is the Frame that the Txn commits to.
+	frame *Frame
+
+	// base is the state of the Frame at Begin, and view contains the changes of
+	// the Txn on top of base.
+	base, view *Frame
+
+	// keys and ranges contain every index and range touched by the Txn.
+	keys   []row.Index
+	ranges []*rangeOptions
+
+	// done is true once the Txn is committed or rolled back.
+	done bool
+}
+
+// Begin starts a transaction on the Frame. Begin takes constant time, and the
+// Txn may be used from a different goroutine than the Frame. Begin and Commit
+// must not be called concurrently with other calls on the Frame. Once the Txn
+// is committed or rolled back, the Frame no longer shares rows with it.
+func (f *Frame) Begin() *Txn {
+	base := f.Snapshot()
+	return &Txn{
+		frame: f,
+		base:  base,
+		view:  base.Clone(),
+	}
+}
+
+// touch records that the Txn depends on the rows with the index of the key.
+func (t *Txn) touch(key row.Data) error {
+	index, err := t.view.indexer.Index(key)
+	if err != nil {
+		return err
+	}
+	t.keys = append(t.keys, index)
+	return nil
+}
+
+// Get returns the data for the given key, including changes made by the Txn.
+// See Frame.Get.
+func (t *Txn) Get(key row.Data) (row.Data, error) {
+	if t.done {
+		return nil, ErrTxnDone
+	}
+	if err := t.touch(key); err != nil {
+		return nil, err
+	}
+	return t.view.Get(key)
+}
+
+// Put inserts the data into the Txn. See Frame.Put.
+func (t *Txn) Put(data row.Data) (row.Data, error) {
+	if t.done {
+		return nil, ErrTxnDone
+	}
+	if err := t.touch(data); err != nil {
+		return nil, err
+	}
+	return t.view.Put(data)
+}
+
+// Pop returns the data for the given key and deletes it in the Txn. See
+// Frame.Pop.
+func (t *Txn) Pop(key row.Data) (row.Data, error) {
+	if t.done {
+		return nil, ErrTxnDone
+	}
+	if err := t.touch(key); err != nil {
+		return nil, err
+	}
+	return t.view.Pop(key)
+}
+
+// PopRange returns all values in the given range and deletes them in the Txn.
+// See Frame.PopRange.
+func (t *Txn) PopRange(args ...rangeArg) ([]row.Data, error) {
+	if t.done {
+		return nil, ErrTxnDone
+	}
+	t.ranges = append(t.ranges, rangeArgsToOptions(args))
+	return t.view.PopRange(args...)
+}
+
+// Rollback discards the changes of the Txn.
+func (t *Txn) Rollback() {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.base.Release()
+	t.view.Release()
+	t.base, t.view = nil, nil
+}
+
+// Commit applies the changes of the Txn to the Frame. Returns ErrConflict if a
+// key or range touched by the Txn was changed in the Frame since Begin, in which
+// case the Frame is unchanged and the Txn is rolled back. Changes are detected
+// by row identity, so putting the same row.Data back into the Frame is not a
+// change.
+func (t *Txn) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	defer t.Rollback()
+
+	f := t.frame
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	// Collect the rows of the Frame and of the Txn for each touched key and
+	// range, failing on any conflict before the Frame is modified.
+	var (
+		old     []row.Row
+		updated []indexedRow
+	)
+	collect := func(baseRows, frameRows, viewRows []row.Row) error {
+		if !sameRows(baseRows, frameRows) {
+			return ErrConflict
+		}
+		old = append(old, frameRows...)
+		for _, r := range viewRows {
+			keys, err := f.secondaryKeys(r.Data)
+			if err != nil {
+				return err
+			}
+			if err := f.checkViews(r.Data); err != nil {
+				return err
+			}
+			updated = append(updated, indexedRow{Row: r, keys: keys})
+		}
+		return nil
+	}
+	for _, index := range t.keys {
+		err := collect(t.base.find(index, 0), f.find(index, 0), t.view.find(index, 0))
+		if err != nil {
+			return err
+		}
+	}
+	for _, opts := range t.ranges {
+		var rows [3][]row.Row
+		for i, fr := range []*Frame{t.base, f, t.view} {
+			var err error
+			if rows[i], err = fr.rowsInRange(opts); err != nil {
+				return err
+			}
+		}
+		if err := collect(rows[0], rows[1], rows[2]); err != nil {
+			return err
+		}
+	}
+
+	// Touched keys and ranges may overlap, so all rows are deleted before any
+	// are inserted.
+	for _, r := range old {
+		f.delete(r.Index)
+	}
+	for _, r := range updated {
+		f.insert(r.Row, r.keys)
+		if t.view.owned[rowID(r.Data)] {
+			f.own(r.Data)
+		}
+	}
+	if t.view.seq > f.seq {
+		f.seq = t.view.seq
+	}
+	return nil
+}
+
+// rowsInRange returns the rows in the given range.
+func (f *Frame) rowsInRange(opts *rangeOptions) ([]row.Row, error) {
+	var rows []row.Row
+	_, err := f.forRange(opts, func(r row.Row) (interface{}, error) {
+		rows = append(rows, r)
+		return nil, nil
+	})
+	return rows, err
+}
+
+// sameRows returns true if the lists contain identical rows in the same order.
+func sameRows(a, b []row.Row) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if rowID(a[i].Data) != rowID(b[i].Data) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2014 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godata
+
+import (
+	"testing"
+
+	"github.com/google/godata/row"
+)
+
+func TestTxnCommit(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.AddIndex("data", row.NewColumnIndexer("data"))
+	f.Put(row.Of("i", 1, "data", "foo"))
+	f.Put(row.Of("i", 2, "data", "bar"))
+	f.Put(row.Of("i", 5, "data", "qux"))
+
+	txn := f.Begin()
+	txn.Put(row.Of("i", 1, "data", "baz"))
+	txn.Pop(row.Of("i", 2))
+	txn.Put(row.Of("i", 3, "data", "new"))
+	if got, _ := txn.Get(row.Of("i", 1)); got["data"] != "baz" {
+		t.Errorf("Txn.Get = %v; want own write", got)
+	}
+	if got, _ := f.Get(row.Of("i", 1)); got["data"] != "foo" {
+		t.Errorf("Get before Commit = %v; want data foo", got)
+	}
+	// Unrelated changes do not conflict.
+	f.Put(row.Of("i", 4, "data", "other"))
+
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	rows, _ := f.GetRange()
+	var data []interface{}
+	for _, r := range rows {
+		data = append(data, r["data"])
+	}
+	if len(data) != 4 || data[0] != "baz" || data[1] != "new" || data[2] != "other" || data[3] != "qux" {
+		t.Errorf("GetRange after Commit = %v; want baz, new, other, qux", data)
+	}
+	if got, _ := f.GetBy("data", row.Of("data", "bar")); got != nil {
+		t.Errorf("GetBy popped row = %v; want nil", got)
+	}
+	if err := txn.Commit(); err != ErrTxnDone {
+		t.Errorf("second Commit = %v; want ErrTxnDone", err)
+	}
+}
+
+func TestTxnRollback(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 1))
+
+	txn := f.Begin()
+	txn.PopRange()
+	txn.Rollback()
+	if got, _ := f.Get(row.Of("i", 1)); got == nil {
+		t.Errorf("Get after Rollback = nil; want row")
+	}
+	if _, err := txn.Put(row.Of("i", 2)); err != ErrTxnDone {
+		t.Errorf("Put after Rollback = %v; want ErrTxnDone", err)
+	}
+}
+
+func TestTxnReleasesRows(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 1))
+
+	txn := f.Begin()
+	txn.Put(row.Of("i", 2))
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	f.Begin().Rollback()
+
+	// Once the Txns are done, no rows are shared, so none are copied.
+	for _, i := range []int{1, 2} {
+		a, _ := f.Get(row.Of("i", i))
+		b, _ := f.Get(row.Of("i", i))
+		if rowID(a) != rowID(b) {
+			t.Errorf("Get copied row %d after the Txns finished", i)
+		}
+	}
+}
+
+func TestTxnConflict(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("i"))
+	f.Put(row.Of("i", 1, "data", "foo"))
+
+	t1 := f.Begin()
+	t2 := f.Begin()
+	t1.Put(row.Of("i", 1, "data", "bar"))
+	t2.Get(row.Of("i", 1))
+	t2.Put(row.Of("i", 2, "data", "baz"))
+	if err := t1.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := t2.Commit(); err != ErrConflict {
+		t.Errorf("Commit = %v; want ErrConflict", err)
+	}
+	if got, _ := f.Get(row.Of("i", 2)); got != nil {
+		t.Errorf("Get = %v; want conflicting Txn not applied", got)
+	}
+
+	// Ranges conflict with rows added to them.
+	t3 := f.Begin()
+	t3.PopRange(GreaterOrEqual(row.Of("i", 5)))
+	f.Put(row.Of("i", 7))
+	if err := t3.Commit(); err != ErrConflict {
+		t.Errorf("Commit = %v; want ErrConflict", err)
+	}
+}
+
+func TestTxnAllowDuplicates(t *testing.T) {
+	f := NewFrame(row.NewColumnIndexer("user"), AllowDuplicates())
+	f.Put(row.Of("user", 1, "event", "a"))
+
+	txn := f.Begin()
+	txn.Put(row.Of("user", 1, "event", "b"))
+	f.Put(row.Of("user", 2, "event", "c"))
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	f.Put(row.Of("user", 1, "event", "d"))
+
+	rows, _ := f.GetAll(row.Of("user", 1))
+	if len(rows) != 3 || rows[0]["event"] != "a" || rows[1]["event"] != "b" || rows[2]["event"] != "d" {
+		t.Errorf("GetAll = %v; want events a, b, d", rows)
+	}
+}